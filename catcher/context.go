@@ -0,0 +1,107 @@
+package catcher
+
+import (
+	"context"
+	"maps"
+)
+
+// contextKey is the type of the keys of the values stored by this package in a context.
+type contextKey int
+
+const (
+	traceIDKey contextKey = iota
+	requestIDKey
+)
+
+// WithTraceID returns a copy of ctx carrying the given trace ID, which LoggerCtx adds to every log entry.
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey, traceID)
+}
+
+// WithRequestID returns a copy of ctx carrying the given request ID, which LoggerCtx adds to every log entry.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// TraceID returns the trace ID carried by ctx, or an empty string.
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey).(string)
+	return id
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// ContextLogger logs errors and informational events enriched with the trace and request IDs of a context.
+type ContextLogger struct {
+	ids map[string]any
+}
+
+// LoggerCtx returns a logger adding the trace and request IDs carried by ctx, if any, to the args of every
+// entry it logs, under the traceId and requestId keys. It allows correlating the log lines produced while
+// processing the same event or request.
+//
+// Example:
+//
+//	ctx = catcher.WithTraceID(ctx, traceID)
+//	log := catcher.LoggerCtx(ctx)
+//	err := log.Error("failed to enrich event", cause, map[string]any{"plugin": "geolocation"})
+func LoggerCtx(ctx context.Context) *ContextLogger {
+	ids := make(map[string]any, 2)
+
+	if ctx != nil {
+		if id := TraceID(ctx); id != "" {
+			ids["traceId"] = id
+		}
+
+		if id := RequestID(ctx); id != "" {
+			ids["requestId"] = id
+		}
+	}
+
+	return &ContextLogger{ids: ids}
+}
+
+// With returns a copy of the logger also adding the given fields to the args of every entry it logs, e.g. the
+// URL of the request being processed. Fields with the same key as the trace and request IDs are ignored.
+func (l *ContextLogger) With(fields map[string]any) *ContextLogger {
+	ids := maps.Clone(fields)
+	if ids == nil {
+		ids = make(map[string]any, len(l.ids))
+	}
+
+	maps.Copy(ids, l.ids)
+
+	return &ContextLogger{ids: ids}
+}
+
+// Error behaves like the package-level Error, adding the IDs of the logger to args.
+// The args map of the caller is not modified.
+func (l *ContextLogger) Error(msg string, cause error, args map[string]any) *SdkError {
+	return newError(3, msg, cause, l.withIDs(args))
+}
+
+// Info behaves like the package-level Info, adding the IDs of the logger to args.
+// The args map of the caller is not modified.
+func (l *ContextLogger) Info(msg string, args map[string]any) {
+	logInfo(3, msg, l.withIDs(args))
+}
+
+// withIDs returns a copy of args including the IDs and fields of the logger.
+func (l *ContextLogger) withIDs(args map[string]any) map[string]any {
+	if len(l.ids) == 0 {
+		return args
+	}
+
+	merged := maps.Clone(args)
+	if merged == nil {
+		merged = make(map[string]any, len(l.ids))
+	}
+
+	maps.Copy(merged, l.ids)
+
+	return merged
+}
@@ -0,0 +1,76 @@
+package catcher
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLoggerCtx(t *testing.T) {
+	ctx := WithRequestID(WithTraceID(context.Background(), "trace-1"), "req-1")
+
+	if TraceID(ctx) != "trace-1" || RequestID(ctx) != "req-1" {
+		t.Fatalf("expected IDs to be stored in the context, got %q and %q", TraceID(ctx), RequestID(ctx))
+	}
+
+	args := map[string]any{"plugin": "geolocation"}
+	err := LoggerCtx(ctx).Error("enrichment failed", nil, args)
+
+	if err.Args["traceId"] != "trace-1" || err.Args["requestId"] != "req-1" {
+		t.Errorf("expected IDs in args, got %v", err.Args)
+	}
+
+	if err.Args["plugin"] != "geolocation" {
+		t.Errorf("expected original args to be kept, got %v", err.Args)
+	}
+
+	if _, ok := args["traceId"]; ok {
+		t.Error("expected the args of the caller not to be modified")
+	}
+
+	if !strings.HasPrefix(err.Trace[0], "github.com/threatwinds/go-sdk/catcher.TestLoggerCtx ") {
+		t.Errorf("expected the trace to start at the caller, got %s", err.Trace[0])
+	}
+
+	err = LoggerCtx(context.Background()).Error("no ids", nil, nil)
+	if err.Args != nil {
+		t.Errorf("expected no args without IDs, got %v", err.Args)
+	}
+
+	err = LoggerCtx(WithTraceID(context.Background(), "trace-2")).Error("only trace", nil, nil)
+	if err.Args["traceId"] != "trace-2" {
+		t.Errorf("expected trace ID in args, got %v", err.Args)
+	}
+
+	if _, ok := err.Args["requestId"]; ok {
+		t.Errorf("expected no request ID in args, got %v", err.Args)
+	}
+
+	LoggerCtx(ctx).Info("enriched", nil)
+}
+
+func TestErrorTraceStartsAtCaller(t *testing.T) {
+	err := Error("any error", nil, nil)
+	if !strings.HasPrefix(err.Trace[0], "github.com/threatwinds/go-sdk/catcher.TestErrorTraceStartsAtCaller ") {
+		t.Errorf("expected the trace to start at the caller, got %s", err.Trace[0])
+	}
+}
+
+func TestLoggerCtxWith(t *testing.T) {
+	base := LoggerCtx(WithTraceID(context.Background(), "trace-1"))
+	log := base.With(map[string]any{"url": "https://example.com", "traceId": "ignored"})
+
+	err := log.With(map[string]any{"attempts": 2}).Error("request failed", nil, map[string]any{"status": 502})
+	if err.Args["url"] != "https://example.com" || err.Args["attempts"] != 2 || err.Args["status"] != 502 {
+		t.Errorf("expected fields and args, got %v", err.Args)
+	}
+
+	if err.Args["traceId"] != "trace-1" {
+		t.Errorf("expected the trace ID to take precedence over fields, got %v", err.Args["traceId"])
+	}
+
+	err = base.Error("request failed", nil, nil)
+	if _, ok := err.Args["url"]; ok {
+		t.Errorf("expected the original logger not to be modified, got %v", err.Args)
+	}
+}
@@ -46,8 +46,13 @@ func (e SdkError) Error() string {
 // Returns:
 // *SdkError: the error. This type implements the Go error interface.
 func Error(msg string, cause error, args map[string]any) *SdkError {
+	return newError(3, msg, cause, args)
+}
+
+// newError implements Error, skip is the number of stack frames to omit from the trace.
+func newError(skip int, msg string, cause error, args map[string]any) *SdkError {
 	pc := make([]uintptr, 25)
-	n := runtime.Callers(2, pc)
+	n := runtime.Callers(skip, pc)
 	frames := runtime.CallersFrames(pc[:n])
 
 	var trace = make([]string, 0, 10)
@@ -21,8 +21,13 @@ type SdkLog struct {
 
 // Info logs a message with a unique code, stack trace, and optional contextual arguments in a structured format.
 func Info(msg string, args map[string]any) {
+	logInfo(3, msg, args)
+}
+
+// logInfo implements Info, skip is the number of stack frames to omit from the trace.
+func logInfo(skip int, msg string, args map[string]any) {
 	pc := make([]uintptr, 25)
-	n := runtime.Callers(2, pc)
+	n := runtime.Callers(skip, pc)
 	frames := runtime.CallersFrames(pc[:n])
 
 	var trace = make([]string, 0, 10)
@@ -0,0 +1,110 @@
+package plugins
+
+import (
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// AssetWithTenant is an asset of the configuration paired with the tenant declaring it.
+type AssetWithTenant struct {
+	TenantName string
+	TenantID   string
+	Asset      *Asset
+}
+
+// AllAssets returns every asset of the configuration together with its tenant, in configuration order.
+// The assets are copies taken under the configuration read lock, so the result is a stable snapshot that
+// is not affected by later reloads and can be modified by the caller.
+func (c *Config) AllAssets() []AssetWithTenant {
+	cfgMutex.RLock()
+	defer cfgMutex.RUnlock()
+
+	var assets []AssetWithTenant
+	for _, tenant := range c.Tenants {
+		for _, asset := range tenant.Assets {
+			assets = append(assets, AssetWithTenant{
+				TenantName: tenant.Name,
+				TenantID:   tenant.Id,
+				Asset:      proto.Clone(asset).(*Asset),
+			})
+		}
+	}
+
+	return assets
+}
+
+// assetIndex resolves IP addresses to the name of the tenant owning the matching asset.
+type assetIndex struct {
+	ips      map[netip.Addr]string
+	prefixes []assetPrefix
+}
+
+// assetPrefix is a CIDR declared in an asset together with the name of its tenant.
+type assetPrefix struct {
+	prefix netip.Prefix
+	tenant string
+}
+
+// currentAssetIndex is the index of the assets of the current configuration, rebuilt on every reload.
+var currentAssetIndex atomic.Pointer[assetIndex]
+
+// newAssetIndex builds the index of the IPs and CIDRs declared in the assets of every tenant.
+// Invalid entries are ignored. When an address belongs to the assets of several tenants, the first
+// tenant in the configuration wins.
+func newAssetIndex(c *Config) *assetIndex {
+	index := &assetIndex{ips: make(map[netip.Addr]string)}
+
+	for _, tenant := range c.Tenants {
+		for _, asset := range tenant.Assets {
+			for _, entry := range asset.Ips {
+				if strings.Contains(entry, "/") {
+					prefix, err := netip.ParsePrefix(entry)
+					if err == nil {
+						index.prefixes = append(index.prefixes, assetPrefix{prefix: prefix.Masked(), tenant: tenant.Name})
+					}
+					continue
+				}
+
+				addr, err := netip.ParseAddr(entry)
+				if err != nil {
+					continue
+				}
+
+				if _, ok := index.ips[addr.Unmap()]; !ok {
+					index.ips[addr.Unmap()] = tenant.Name
+				}
+			}
+		}
+	}
+
+	return index
+}
+
+// lookup returns the name of the tenant owning the asset that matches ip.
+func (i *assetIndex) lookup(ip string) (string, bool) {
+	if i == nil {
+		return "", false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+
+	addr = addr.Unmap()
+
+	if tenant, ok := i.ips[addr]; ok {
+		return tenant, true
+	}
+
+	for _, p := range i.prefixes {
+		if p.prefix.Contains(addr) {
+			return p.tenant, true
+		}
+	}
+
+	return "", false
+}
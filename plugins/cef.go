@@ -0,0 +1,156 @@
+package plugins
+
+import (
+	"strconv"
+	"strings"
+)
+
+// cefHeaderFields are the names of the fields of a CEF header, in order.
+var cefHeaderFields = []string{"version", "deviceVendor", "deviceProduct", "deviceVersion", "signatureId", "name", "severity"}
+
+// parseCEF parses a CEF message (CEF:Version|Vendor|Product|Version|SignatureID|Name|Severity|Extension),
+// optionally preceded by a syslog header, into its header fields and extensions. Header fields are named as in
+// cefHeaderFields and take precedence over extensions with the same key. Escaped characters are unescaped.
+// It returns false when the string is not a CEF message or its header is incomplete.
+func parseCEF(str string) (map[string]string, bool) {
+	start := strings.Index(str, "CEF:")
+	if start < 0 {
+		return nil, false
+	}
+
+	fields := make(map[string]string)
+
+	rest := str[start+len("CEF:"):]
+	for _, name := range cefHeaderFields {
+		value, end, ok := cefHeaderField(rest)
+		if !ok {
+			return nil, false
+		}
+
+		fields[name] = value
+		rest = rest[end:]
+	}
+
+	for key, value := range cefExtensions(rest) {
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
+		}
+	}
+
+	return fields, true
+}
+
+// cefHeaderField returns the unescaped value of the header field at the start of the string, and the position
+// following its unescaped '|' separator. It returns false when the separator is missing.
+func cefHeaderField(str string) (string, int, bool) {
+	var value strings.Builder
+
+	for i := 0; i < len(str); i++ {
+		switch {
+		case str[i] == '\\' && i+1 < len(str) && (str[i+1] == '|' || str[i+1] == '\\'):
+			i++
+			value.WriteByte(str[i])
+		case str[i] == '|':
+			return value.String(), i + 1, true
+		default:
+			value.WriteByte(str[i])
+		}
+	}
+
+	return "", 0, false
+}
+
+// cefExtensions parses the space-separated key=value pairs of a CEF extension. Values can contain spaces,
+// running up to the key of the next pair.
+func cefExtensions(str string) map[string]string {
+	type pair struct{ keyStart, eq int }
+
+	var pairs []pair
+	lastSpace := -1
+	for i := 0; i < len(str); i++ {
+		switch {
+		case str[i] == '\\':
+			if i+1 < len(str) && str[i+1] == ' ' {
+				lastSpace = i + 1
+			}
+			i++
+			continue
+		case str[i] == ' ':
+			lastSpace = i
+			continue
+		case str[i] != '=':
+			continue
+		}
+
+		// The key starts after the last space, which is tracked in the same pass to keep parsing linear
+		keyStart := lastSpace + 1
+		if len(pairs) > 0 && keyStart <= pairs[len(pairs)-1].eq {
+			// No space since the previous '=', it is part of its value
+			continue
+		}
+
+		if keyStart < i {
+			pairs = append(pairs, pair{keyStart: keyStart, eq: i})
+		}
+	}
+
+	extensions := make(map[string]string, len(pairs))
+	for i, p := range pairs {
+		end := len(str)
+		if i+1 < len(pairs) {
+			end = pairs[i+1].keyStart
+		}
+
+		extensions[str[p.keyStart:p.eq]] = cefUnescape(strings.TrimRight(str[p.eq+1:end], " "))
+	}
+
+	return extensions
+}
+
+// cefUnescape unescapes the value of a CEF extension.
+func cefUnescape(str string) string {
+	if !strings.Contains(str, `\`) {
+		return str
+	}
+
+	var value strings.Builder
+	for i := 0; i < len(str); i++ {
+		if str[i] != '\\' || i+1 == len(str) {
+			value.WriteByte(str[i])
+			continue
+		}
+
+		i++
+		switch str[i] {
+		case 'n':
+			value.WriteByte('\n')
+		case 'r':
+			value.WriteByte('\r')
+		default:
+			value.WriteByte(str[i])
+		}
+	}
+
+	return value.String()
+}
+
+// syslogSeverityOf returns the severity encoded in the <PRI> prefix of a syslog message, or -1 when the
+// prefix is missing or invalid.
+func syslogSeverityOf(str string) int64 {
+	str = strings.TrimLeft(str, " ")
+	if !strings.HasPrefix(str, "<") {
+		return -1
+	}
+
+	end := strings.IndexByte(str, '>')
+	if end < 2 || end > 4 {
+		return -1
+	}
+
+	pri, err := strconv.ParseUint(str[1:end], 10, 8)
+	if err != nil || pri > 191 {
+		return -1
+	}
+
+	return int64(pri % 8)
+}
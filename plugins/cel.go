@@ -1,78 +1,398 @@
 package plugins
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
 	"github.com/threatwinds/go-sdk/catcher"
+	"github.com/threatwinds/go-sdk/utils"
 	"github.com/tidwall/gjson"
+	"golang.org/x/net/idna"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/structpb"
 
+	"fmt"
+	"net/mail"
+	"net/url"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
+// interruptCheckFrequency is the number of comprehension iterations between checks of the evaluation context.
+const interruptCheckFrequency = 100
+
+var globalEnvOptions []cel.EnvOption
+var globalEnvOptionsMutex sync.RWMutex
+
 // Evaluate evaluates a CEL expression against the given data and returns the boolean result if successful.
 // Returns true/false or an error in case of failure during evaluation or invalid output type.
+// Expressions that do not reference any variable, e.g. those only using the gjson-based functions
+// (safe, exists, etc.), are evaluated without unmarshalling the data.
 func Evaluate(data *string, expression string, envOption ...cel.EnvOption) (bool, error) {
+	return EvaluateContext(context.Background(), data, expression, envOption...)
+}
+
+// EvaluateContext behaves like Evaluate but bounds the evaluation by the context. The context is passed to
+// the functions performing I/O, such as lookup on tables registered with RegisterLookupFunc, so they honour
+// its deadline and cancellation, and long-running comprehensions are interrupted when it is done.
+func EvaluateContext(ctx context.Context, data *string, expression string, envOption ...cel.EnvOption) (bool, error) {
+	return evaluateBool(ctx, data, expression, nil, envOption)
+}
+
+// EvaluateWithVars behaves like Evaluate but also binds the given variables, taking precedence over the
+// fields of the data with the same name, e.g. a baseline map maintained by the caller for changed:
+// EvaluateWithVars(&data, `changed("config.hash", baseline, "hash")`, map[string]any{"baseline": baseline}).
+// Values must be of the types found in unmarshalled JSON, e.g. map[string]any, []any, string, float64 or bool.
+func EvaluateWithVars(data *string, expression string, vars map[string]any, envOption ...cel.EnvOption) (bool, error) {
+	return evaluateBool(context.Background(), data, expression, vars, envOption)
+}
+
+// evaluateBool evaluates an expression like evaluateValue, failing if its value is not a boolean.
+func evaluateBool(ctx context.Context, data *string, expression string, vars map[string]any, envOption []cel.EnvOption) (bool, error) {
+	out, err := evaluateValue(ctx, data, expression, vars, envOption)
+	if err != nil {
+		return false, err
+	}
+
+	if out.Type() == cel.BoolType {
+		return out.Value().(bool), nil
+	}
+
+	return false, catcher.LoggerCtx(ctx).Error("output type is not boolean", nil, map[string]any{
+		"expression": expression,
+	})
+}
+
+// EvaluateValue evaluates a CEL expression against the given data like Evaluate, with the same variables and
+// functions, but returns the value of the expression whatever its type, e.g. to extract or transform fields
+// with expressions like safe("user.name", "") or [src.ip, dst.ip].
+//
+// The Value method of the result returns its native Go value for the scalar types: bool for bool, int64
+// for int, uint64 for uint, float64 for double, string for string, []byte for bytes, time.Time for
+// google.protobuf.Timestamp, time.Duration for google.protobuf.Duration and structpb.NullValue for null.
+// Lists and maps implement traits.Lister and traits.Mapper, and Value returns their backing value, which
+// differs between lists or maps taken from the data and the ones built by the expression; convert them with
+// ConvertToNative instead, e.g. out.ConvertToNative(reflect.TypeOf([]any{})) or
+// out.ConvertToNative(reflect.TypeOf(map[string]any{})). The type of the result is given by out.Type(),
+// e.g. out.Type() == cel.StringType, and numbers in the data are doubles, as in JSON.
+//
+// Parameters:
+//   - data: The JSON object the expression is evaluated against.
+//   - expression: The CEL expression.
+//   - envOption: Additional options of the CEL environment.
+//
+// Returns:
+//   - ref.Val: The value of the expression.
+//   - error: An error if the expression cannot be compiled or evaluated.
+func EvaluateValue(data *string, expression string, envOption ...cel.EnvOption) (ref.Val, error) {
+	return evaluateValue(context.Background(), data, expression, nil, envOption)
+}
+
+// evaluateValue compiles an expression in the environment built for the data and evaluates it, bounded by the
+// context, returning its value whatever its type. The variables, if any, are bound besides the fields of the data.
+func evaluateValue(ctx context.Context, data *string, expression string, vars map[string]any, envOption []cel.EnvOption) (ref.Val, error) {
+	log := catcher.LoggerCtx(ctx)
+
 	if data == nil {
-		return false, catcher.Error("data is nil", nil, map[string]any{})
+		return nil, log.Error("data is nil", nil, map[string]any{})
 	}
 
-	var valuesMap map[string]interface{}
+	if err := ctx.Err(); err != nil {
+		return nil, log.Error("evaluation context is done", err, map[string]any{"expression": expression})
+	}
 
-	err := json.Unmarshal([]byte(*data), &valuesMap)
+	// Add the provided environment options first (including cel.Types)
+	celEnv, err := cel.NewEnv(buildEnvOptions(ctx, data, envOption)...)
 	if err != nil {
-		return false, catcher.Error("cannot unmarshal data", err, map[string]any{})
+		return nil, log.Error("failed to start CEL environment", err, map[string]any{})
 	}
 
-	envOptions := []cel.EnvOption{
-		celExists(data),
-		safeBool(data),
-		safeString(data),
-		safeNum(data),
+	parsed, issues := celEnv.Parse(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, log.Error("failed to compile expression", nil, map[string]any{"expression": expression, "issues": issues.Errors()})
 	}
 
-	// Add the provided environment options first (including cel.Types)
-	envOptions = append(envOptions, envOption...)
+	var activation any = cel.NoVars()
+
+	if referencesVariables(parsed) {
+		var valuesMap map[string]interface{}
+
+		err = json.Unmarshal([]byte(*data), &valuesMap)
+		if err != nil {
+			return nil, log.Error("cannot unmarshal data", err, map[string]any{})
+		}
+
+		if len(vars) > 0 {
+			if valuesMap == nil {
+				valuesMap = make(map[string]interface{}, len(vars))
+			}
+
+			for k, v := range vars {
+				valuesMap[k] = v
+			}
+		}
+
+		variables := make([]cel.EnvOption, 0, len(valuesMap))
+		for k, v := range valuesMap {
+			variables = append(variables, cel.Variable(k, valueToCelType(v)))
+		}
+
+		celEnv, err = celEnv.Extend(variables...)
+		if err != nil {
+			return nil, log.Error("failed to start CEL environment", err, map[string]any{})
+		}
+
+		activation = valuesMap
+	} else if result := gjson.Parse(*data); !gjson.Valid(*data) || !(result.IsObject() || result.Type == gjson.Null) {
+		return nil, log.Error("cannot unmarshal data", nil, map[string]any{})
+	}
+
+	ast, issues := celEnv.Check(parsed)
+	if issues != nil && issues.Err() != nil {
+		return nil, log.Error("failed to compile expression", nil, map[string]any{"expression": expression, "issues": issues.Errors()})
+	}
+
+	prg, err := celEnv.Program(ast, cel.InterruptCheckFrequency(interruptCheckFrequency))
+	if err != nil {
+		return nil, log.Error("failed to create program", err, map[string]any{
+			"expression": expression,
+		})
+	}
+
+	out, _, err := prg.ContextEval(ctx, activation)
+	if err != nil {
+		return nil, log.Error("failed to evaluate program", err, map[string]any{
+			"expression": expression,
+		})
+	}
+
+	return out, nil
+}
+
+// referencesVariables reports whether a parsed expression contains any identifier, which may refer to a
+// variable declared from the data. Identifiers introduced by macros or naming types are also reported,
+// making the check conservative.
+func referencesVariables(parsed *cel.Ast) bool {
+	found := false
+
+	celast.PostOrderVisit(parsed.NativeRep().Expr(), celast.NewExprVisitor(func(e celast.Expr) {
+		if e.Kind() == celast.IdentKind {
+			found = true
+		}
+	}))
+
+	return found
+}
+
+// EvaluateArray evaluates a CEL expression against each element of the JSON array found at arrayPath
+// and returns the indices of the elements for which the expression is true.
+// The expression is compiled once: the fields of every element are declared as variables, and the
+// gjson-based functions (safe, exists, etc.) read from the element being evaluated.
+// Elements that are not JSON objects, or whose evaluation fails (e.g. because a referenced field is
+// absent from that element), are treated as not matching.
+//
+// Parameters:
+//   - data: The JSON document containing the array.
+//   - arrayPath: The gjson path of the array to iterate.
+//   - expression: The CEL expression to evaluate per element.
+//   - envOption: Additional CEL environment options.
+//
+// Returns:
+//   - []int: The indices of the matching elements, in ascending order.
+//   - error: An error if the data is invalid or the expression cannot be compiled.
+func EvaluateArray(data *string, arrayPath string, expression string, envOption ...cel.EnvOption) ([]int, error) {
+	if data == nil {
+		return nil, catcher.Error("data is nil", nil, map[string]any{})
+	}
+
+	array := gjson.Get(*data, arrayPath)
+	if !array.IsArray() {
+		return nil, catcher.Error("path is not an array", nil, map[string]any{"path": arrayPath})
+	}
 
-	for k, v := range valuesMap {
-		envOptions = append(envOptions, cel.Variable(k, valueToCelType(v)))
+	items := array.Array()
+	elements := make([]map[string]interface{}, len(items))
+	varTypes := make(map[string]*cel.Type)
+
+	for i, item := range items {
+		if !item.IsObject() {
+			continue
+		}
+
+		err := json.Unmarshal([]byte(item.Raw), &elements[i])
+		if err != nil {
+			return nil, catcher.Error("cannot unmarshal array element", err, map[string]any{"index": i})
+		}
+
+		for k, v := range elements[i] {
+			t := valueToCelType(v)
+			if prev, ok := varTypes[k]; ok && !prev.IsExactType(t) {
+				t = cel.DynType
+			}
+			varTypes[k] = t
+		}
+	}
+
+	current := new(string)
+
+	envOptions := buildEnvOptions(context.Background(), current, envOption)
+
+	for k, t := range varTypes {
+		envOptions = append(envOptions, cel.Variable(k, t))
 	}
 
 	celEnv, err := cel.NewEnv(envOptions...)
 	if err != nil {
-		return false, catcher.Error("failed to start CEL environment", err, map[string]any{})
+		return nil, catcher.Error("failed to start CEL environment", err, map[string]any{})
 	}
 
 	ast, issues := celEnv.Compile(expression)
 	if issues != nil && issues.Err() != nil {
-		return false, catcher.Error("failed to compile expression", nil, map[string]any{"expression": expression, "issues": issues.Errors()})
+		return nil, catcher.Error("failed to compile expression", nil, map[string]any{"expression": expression, "issues": issues.Errors()})
 	}
 
-	prg, err := celEnv.Program(ast)
-	if err != nil {
-		return false, catcher.Error("failed to create program", err, map[string]any{
-			"expression": expression,
-		})
+	if ast.OutputType() != cel.BoolType {
+		return nil, catcher.Error("output type is not boolean", nil, map[string]any{"expression": expression})
 	}
 
-	out, _, err := prg.Eval(valuesMap)
+	prg, err := celEnv.Program(ast)
 	if err != nil {
-		return false, catcher.Error("failed to evaluate program", err, map[string]any{
+		return nil, catcher.Error("failed to create program", err, map[string]any{
 			"expression": expression,
 		})
 	}
 
-	if out.Type() == cel.BoolType {
-		return out.Value().(bool), nil
+	matches := make([]int, 0)
+	for i, item := range items {
+		if elements[i] == nil {
+			continue
+		}
+
+		*current = item.Raw
+
+		out, _, err := prg.Eval(elements[i])
+		if err != nil {
+			continue
+		}
+
+		if matched, ok := out.Value().(bool); ok && matched {
+			matches = append(matches, i)
+		}
 	}
 
-	return false, catcher.Error("output type is not boolean", err, map[string]any{
-		"expression": expression,
-	})
+	return matches, nil
+}
+
+// RegisterGlobalEnvOption registers a CEL environment option, such as a custom function, that is
+// automatically applied to every evaluation. Global options are applied after the built-in functions
+// and before the options passed to each call. It is safe for concurrent use, but options should be
+// registered once at startup.
+func RegisterGlobalEnvOption(opt cel.EnvOption) {
+	globalEnvOptionsMutex.Lock()
+	defer globalEnvOptionsMutex.Unlock()
+
+	globalEnvOptions = append(globalEnvOptions, opt)
+}
+
+// buildEnvOptions returns the built-in functions bound to data, followed by the global options
+// and the per-call options.
+func buildEnvOptions(ctx context.Context, data *string, envOption []cel.EnvOption) []cel.EnvOption {
+	envOptions := defaultEnvOptions(ctx, data)
+
+	globalEnvOptionsMutex.RLock()
+	envOptions = append(envOptions, globalEnvOptions...)
+	globalEnvOptionsMutex.RUnlock()
+
+	return append(envOptions, envOption...)
+}
+
+// defaultEnvOptions returns the CEL functions available to every expression, bound to the given data.
+// Functions performing I/O are also bound to the context of the evaluation.
+func defaultEnvOptions(ctx context.Context, data *string) []cel.EnvOption {
+	return []cel.EnvOption{
+		celExists(data),
+		safeBool(data),
+		safeString(data),
+		safeNum(data),
+		containsAny(data),
+		containsAll(data),
+		containsAnyCI(data),
+		equalsAnyCI(data),
+		arrayAt(data),
+		withinLast(data),
+		kvGet(data),
+		cefField(data),
+		syslogSeverity(data),
+		qsGet(data),
+		portClass(data),
+		isWellKnown(data),
+		fileExt(data),
+		fileCategoryOf(data),
+		urlDecode(data),
+		queryDecode(data),
+		isBase64(data),
+		b64Len(data),
+		hasAll(data),
+		hasAny(data),
+		firstPath(data),
+		corrKey(data),
+		gjsonQuery(data),
+		timeDiff(data),
+		timeBucket(data),
+		weekday(data),
+		hourOfDay(data),
+		isWeekend(data),
+		isHoliday(data),
+		inAsset(data),
+		isAsset(data),
+		blocklist(data),
+		indicator(data),
+		ipScore(data),
+		macOUI(data),
+		macVendor(data),
+		inList(data),
+		emailDomain(data),
+		emailLocal(data),
+		isValidEmail(data),
+		domainASCII(data),
+		domainUnicode(data),
+		isJSON(data),
+		jsonGet(data),
+		lookup(ctx, data),
+		changed(data),
+		truncate(data),
+		charRatio(data),
+		overlap(data),
+		overlapRatio(data),
+		matchesPattern(data),
+		ruleEnabled(data),
+		reCaptures(data),
+		reList(data, "re_any", false),
+		reList(data, "re_all", true),
+		keysCount(data),
+		objectKeys(data),
+		joinField(data),
+		mapEval(ctx, data),
+		numericAggregate(data, "sum", sumFloats),
+		numericAggregate(data, "avg", avgFloats),
+		numericAggregate(data, "max", slices.Max[[]float64]),
+		numericAggregate(data, "min", slices.Min[[]float64]),
+		toBytes(data),
+		humanBytes(data),
+	}
 }
 
 func celExists(s *string) cel.EnvOption {
@@ -123,34 +443,1630 @@ func safeBool(s *string) cel.EnvOption {
 	))
 }
 
-func valueToCelType(value interface{}) *cel.Type {
-	switch value.(type) {
-	case bool:
-		return cel.BoolType
-	case string:
-		return cel.StringType
-	case int, int32, int64:
-		return cel.IntType
-	case uint, uint32, uint64:
-		return cel.UintType
-	case float32, float64:
-		return cel.DoubleType
-	case []byte:
-		return cel.BytesType
-	case time.Time:
-		return cel.TimestampType
-	case map[string]interface{}:
-		return cel.MapType(cel.StringType, cel.DynType)
-	case map[string]*structpb.Value:
-		return cel.MapType(cel.StringType, cel.DynType)
-	case []interface{}:
-		return cel.ListType(cel.DynType)
-	case nil:
-		return cel.NullType
-	case proto.Message:
-		return cel.DynType
-	default:
-		t := reflect.TypeOf(value)
-		return cel.ObjectType(t.String())
-	}
+// containsAny returns true if any element of the JSON array at the given path is present in the provided list.
+// Elements are compared by their string representation. Missing or non-array fields return false.
+func containsAny(s *string) cel.EnvOption {
+	return cel.Function("contains_any", cel.Overload("string_list_contains_any_bool",
+		[]*cel.Type{cel.StringType, cel.ListType(cel.DynType)}, cel.BoolType,
+		cel.BinaryBinding(func(key ref.Val, list ref.Val) ref.Val {
+			v := gjson.Get(*s, key.Value().(string))
+			if !v.IsArray() {
+				return types.False
+			}
+
+			set := listToSet(list)
+			for _, item := range v.Array() {
+				if _, ok := set[item.String()]; ok {
+					return types.True
+				}
+			}
+
+			return types.False
+		}),
+	))
+}
+
+// containsAll returns true if every element of the provided list is present in the JSON array at the given path.
+// Elements are compared by their string representation. Missing or non-array fields return false.
+func containsAll(s *string) cel.EnvOption {
+	return cel.Function("contains_all", cel.Overload("string_list_contains_all_bool",
+		[]*cel.Type{cel.StringType, cel.ListType(cel.DynType)}, cel.BoolType,
+		cel.BinaryBinding(func(key ref.Val, list ref.Val) ref.Val {
+			v := gjson.Get(*s, key.Value().(string))
+			if !v.IsArray() {
+				return types.False
+			}
+
+			present := make(map[string]struct{})
+			for _, item := range v.Array() {
+				present[item.String()] = struct{}{}
+			}
+
+			for item := range listToSet(list) {
+				if _, ok := present[item]; !ok {
+					return types.False
+				}
+			}
+
+			return types.True
+		}),
+	))
+}
+
+// containsAnyCI returns true if the string at the given path contains any of the substrings of the list,
+// ignoring case, e.g. contains_any_ci("user_agent", ["curl", "python-requests"]).
+// Unlike contains_any, it matches substrings of a string field. Missing fields return false.
+func containsAnyCI(s *string) cel.EnvOption {
+	return cel.Function("contains_any_ci", cel.Overload("string_list_contains_any_ci_bool",
+		[]*cel.Type{cel.StringType, cel.ListType(cel.StringType)}, cel.BoolType,
+		cel.BinaryBinding(func(key ref.Val, list ref.Val) ref.Val {
+			v := gjson.Get(*s, key.Value().(string))
+			if !v.Exists() {
+				return types.False
+			}
+
+			value := strings.ToLower(v.String())
+			for substr := range listToSet(list) {
+				if strings.Contains(value, strings.ToLower(substr)) {
+					return types.True
+				}
+			}
+
+			return types.False
+		}),
+	))
+}
+
+// equalsAnyCI returns true if the string at the given path is equal to any of the values of the list,
+// ignoring case, e.g. equals_any_ci("action", ["deny", "drop"]). Missing fields return false.
+func equalsAnyCI(s *string) cel.EnvOption {
+	return cel.Function("equals_any_ci", cel.Overload("string_list_equals_any_ci_bool",
+		[]*cel.Type{cel.StringType, cel.ListType(cel.StringType)}, cel.BoolType,
+		cel.BinaryBinding(func(key ref.Val, list ref.Val) ref.Val {
+			v := gjson.Get(*s, key.Value().(string))
+			if !v.Exists() {
+				return types.False
+			}
+
+			value := v.String()
+			for candidate := range listToSet(list) {
+				if strings.EqualFold(value, candidate) {
+					return types.True
+				}
+			}
+
+			return types.False
+		}),
+	))
+}
+
+// gjsonQuery runs a full gjson path against the data and returns the result as a string, or the default
+// value when the path doesn't match anything. Besides plain dotted paths, the whole gjson syntax is supported:
+//   - array indexes and lengths: "items.0.name", "items.#"
+//   - queries over arrays: "items.#(type==\"x\").value" for the first match, "items.#(size>10)#.id" for all matches
+//   - wildcards: "user.na*", "user.n?me"
+//   - modifiers: "tags|@reverse", "items.@flatten"
+//   - multipaths: "{src.ip,dst.ip}"
+//
+// Objects and arrays are returned as their raw JSON text.
+func gjsonQuery(s *string) cel.EnvOption {
+	return cel.Function("gjson", cel.Overload("string_string_gjson_string",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.StringType,
+		cel.BinaryBinding(func(path ref.Val, def ref.Val) ref.Val {
+			v := gjson.Get(*s, path.Value().(string))
+			if !v.Exists() {
+				return def
+			}
+
+			return types.String(v.String())
+		}),
+	))
+}
+
+// inAsset returns the name of the tenant owning the asset that matches the IP at the given path, comparing
+// it with the exact IPs and CIDRs declared in Asset.Ips. Returns an empty string for unknown hosts, invalid IPs
+// and when no configuration has been loaded. The asset index is rebuilt on every configuration reload.
+func inAsset(s *string) cel.EnvOption {
+	return cel.Function("in_asset", cel.Overload("string_in_asset_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			tenant, _ := currentAssetIndex.Load().lookup(gjson.Get(*s, field.Value().(string)).String())
+			return types.String(tenant)
+		}),
+	))
+}
+
+// isAsset returns true if the IP at the given path belongs to any configured tenant asset, see in_asset.
+func isAsset(s *string) cel.EnvOption {
+	return cel.Function("is_asset", cel.Overload("string_is_asset_bool",
+		[]*cel.Type{cel.StringType}, cel.BoolType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			_, ok := currentAssetIndex.Load().lookup(gjson.Get(*s, field.Value().(string)).String())
+			return types.Bool(ok)
+		}),
+	))
+}
+
+// blocklist returns true if the IP at the given path matches any address or CIDR of the named set
+// loaded with LoadIPSet, e.g. blocklist("tor_exit_nodes", "origin.ip"). Unknown sets never match.
+func blocklist(s *string) cel.EnvOption {
+	return cel.Function("blocklist", cel.Overload("string_string_blocklist_bool",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+		cel.BinaryBinding(func(name ref.Val, field ref.Val) ref.Val {
+			set := getIPSet(name.Value().(string))
+			return types.Bool(set.contains(gjson.Get(*s, field.Value().(string)).String()))
+		}),
+	))
+}
+
+// indicator returns true if the value at the given path is in the named set loaded with LoadIndicatorSet or
+// LoadIndicatorBloomFilter, e.g. indicator("malware_hashes", "file.sha256"). Unknown sets never match.
+func indicator(s *string) cel.EnvOption {
+	return cel.Function("indicator", cel.Overload("string_string_indicator_bool",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+		cel.BinaryBinding(func(name ref.Val, field ref.Val) ref.Val {
+			set := getIndicatorSet(name.Value().(string))
+			if set == nil {
+				return types.False
+			}
+
+			return types.Bool(set.contains(gjson.Get(*s, field.Value().(string)).String()))
+		}),
+	))
+}
+
+// ipScore returns the reputation score of an IP address registered with RegisterIPScores, taken from the most
+// specific matching address or CIDR, e.g. ip_score(safe("src.ip", "")) > 80. Unknown or invalid addresses,
+// and any address when no scores are registered, return -1.
+func ipScore(_ *string) cel.EnvOption {
+	return cel.Function("ip_score", cel.Overload("string_ip_score_int",
+		[]*cel.Type{cel.StringType}, cel.IntType,
+		cel.UnaryBinding(func(ip ref.Val) ref.Val {
+			score, ok := currentIPScores.Load().lookup(ip.Value().(string))
+			if !ok {
+				return types.Int(-1)
+			}
+
+			return types.Int(score)
+		}),
+	))
+}
+
+// macOUI returns the OUI of the MAC address at the given path as uppercase hexadecimal separated by ':',
+// e.g. mac_oui("dhcp.chaddr") == "00:1C:B3". Addresses are accepted in the formats of net.ParseMAC or as 12
+// hexadecimal digits. Missing or invalid addresses return an empty string.
+func macOUI(s *string) cel.EnvOption {
+	return cel.Function("mac_oui", cel.Overload("string_mac_oui_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			oui, _ := macOUIOf(gjson.Get(*s, field.Value().(string)).String())
+			return types.String(oui)
+		}),
+	))
+}
+
+// macVendor returns the vendor of the MAC address at the given path from the database loaded with LoadOUIDB,
+// e.g. mac_vendor("dhcp.chaddr") == "Apple, Inc.". Missing, invalid or unknown addresses, and any address
+// when no database is loaded, return an empty string.
+func macVendor(s *string) cel.EnvOption {
+	return cel.Function("mac_vendor", cel.Overload("string_mac_vendor_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			oui, ok := macOUIOf(gjson.Get(*s, field.Value().(string)).String())
+			if !ok {
+				return types.String("")
+			}
+
+			vendor, _ := lookupVendor(oui)
+
+			return types.String(vendor)
+		}),
+	))
+}
+
+// inList returns true if the IP at the given path belongs to the named list of the networkLists section
+// of the configuration, e.g. in_network_list("trusted", "origin.ip"). Unknown lists never match.
+// It is not named in_list because CEL reserves that name for the overload of the in operator on lists.
+func inList(s *string) cel.EnvOption {
+	return cel.Function("in_network_list", cel.Overload("string_string_in_network_list_bool",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+		cel.BinaryBinding(func(name ref.Val, field ref.Val) ref.Val {
+			ip := gjson.Get(*s, field.Value().(string)).String()
+			return types.Bool(currentNetworkLists.Load().contains(name.Value().(string), ip))
+		}),
+	))
+}
+
+// emailDomain returns the lower-cased domain part of the email address at the given path,
+// e.g. email_domain("from") returns "example.com" for "John <John@Example.com>".
+// Malformed addresses return an empty string.
+func emailDomain(s *string) cel.EnvOption {
+	return cel.Function("email_domain", cel.Overload("string_email_domain_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			_, domain, _ := parseEmail(gjson.Get(*s, field.Value().(string)).String())
+			return types.String(domain)
+		}),
+	))
+}
+
+// emailLocal returns the local part of the email address at the given path, e.g. email_local("from")
+// returns "John" for "John <John@Example.com>". Malformed addresses return an empty string.
+func emailLocal(s *string) cel.EnvOption {
+	return cel.Function("email_local", cel.Overload("string_email_local_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			local, _, _ := parseEmail(gjson.Get(*s, field.Value().(string)).String())
+			return types.String(local)
+		}),
+	))
+}
+
+// isValidEmail returns true if the value at the given path is an RFC 5322 email address,
+// with or without a display name.
+func isValidEmail(s *string) cel.EnvOption {
+	return cel.Function("is_valid_email", cel.Overload("string_is_valid_email_bool",
+		[]*cel.Type{cel.StringType}, cel.BoolType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			_, _, ok := parseEmail(gjson.Get(*s, field.Value().(string)).String())
+			return types.Bool(ok)
+		}),
+	))
+}
+
+// domainASCII returns the ASCII (punycode) form of the domain at the given path, lowercased, e.g.
+// domain_ascii("url.host") returns "xn--pple-43d.com" for "аpple.com" written with a Cyrillic "а", so
+// look-alike domains can be compared in a canonical form. Invalid domains return an empty string.
+func domainASCII(s *string) cel.EnvOption {
+	return cel.Function("domain_ascii", cel.Overload("string_domain_ascii_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			domain, err := idna.Lookup.ToASCII(gjson.Get(*s, field.Value().(string)).String())
+			if err != nil {
+				return types.String("")
+			}
+
+			return types.String(domain)
+		}),
+	))
+}
+
+// domainUnicode returns the Unicode form of the domain at the given path, lowercased, e.g.
+// domain_unicode("url.host") returns "bücher.de" for "xn--bcher-kva.de". Invalid domains return an empty string.
+func domainUnicode(s *string) cel.EnvOption {
+	return cel.Function("domain_unicode", cel.Overload("string_domain_unicode_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			domain, err := idna.Lookup.ToUnicode(gjson.Get(*s, field.Value().(string)).String())
+			if err != nil {
+				return types.String("")
+			}
+
+			return types.String(domain)
+		}),
+	))
+}
+
+// isJSON returns true if the value at the given path is a string holding a valid JSON document,
+// e.g. is_json("message") for {"message": "{\"user\":\"alice\"}"}.
+func isJSON(s *string) cel.EnvOption {
+	return cel.Function("is_json", cel.Overload("string_is_json_bool",
+		[]*cel.Type{cel.StringType}, cel.BoolType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			_, ok := embeddedJSON(*s, field.Value().(string))
+			return types.Bool(ok)
+		}),
+	))
+}
+
+// jsonGet treats the string at the given field as a JSON document and returns the value at a gjson path
+// inside it as a string, e.g. json_get("message", "user.name"). Returns an empty string if the field does
+// not hold valid JSON or the inner path does not exist.
+func jsonGet(s *string) cel.EnvOption {
+	return cel.Function("json_get", cel.Overload("string_string_json_get_string",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.StringType,
+		cel.BinaryBinding(func(field ref.Val, path ref.Val) ref.Val {
+			doc, ok := embeddedJSON(*s, field.Value().(string))
+			if !ok {
+				return types.String("")
+			}
+			return types.String(gjson.Get(doc, path.Value().(string)).String())
+		}),
+	))
+}
+
+// changed returns true if the value at the given path differs from the value of the key in a baseline map
+// supplied with the expression, e.g. changed("config.hash", baseline, "hash") detects configuration drift
+// when the event carries the expected values in its baseline field, or when the caller binds them to the
+// baseline variable with EvaluateWithVars. Values are compared as JSON values: numbers are equal when they
+// have the same value, regardless of being integers or doubles, strings are never equal to numbers or
+// booleans, and objects and arrays are compared deeply. A missing field or key is treated as null, so it is
+// unchanged only when the other side is also missing or null.
+func changed(s *string) cel.EnvOption {
+	return cel.Function("changed", cel.Overload("string_map_string_changed_bool",
+		[]*cel.Type{cel.StringType, cel.MapType(cel.StringType, cel.DynType), cel.StringType}, cel.BoolType,
+		cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+			current := gjson.Get(*s, args[0].Value().(string)).Value()
+
+			var baseline any
+			if v, found := args[1].(traits.Mapper).Find(args[2]); found {
+				native, err := v.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+				if err != nil {
+					return types.NewErr("unsupported baseline value for key %q: %s", args[2].Value(), err)
+				}
+
+				baseline = native.(*structpb.Value).AsInterface()
+			}
+
+			return types.Bool(!reflect.DeepEqual(current, baseline))
+		}),
+	))
+}
+
+// lookup returns the value mapped to the key found at the given path in the named table registered
+// with RegisterLookup or RegisterLookupFunc, or the default value if the table, the field or the key
+// does not exist, e.g. lookup("host_criticality", "origin.host", "low"). Failed lookups on tables
+// registered with RegisterLookupFunc, including those cut short by the context, fail the evaluation.
+func lookup(ctx context.Context, s *string) cel.EnvOption {
+	return cel.Function("lookup", cel.Overload("string_string_string_lookup_string",
+		[]*cel.Type{cel.StringType, cel.StringType, cel.StringType}, cel.StringType,
+		cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+			key := gjson.Get(*s, args[1].Value().(string))
+			if !key.Exists() {
+				return args[2]
+			}
+
+			value, ok, err := lookupValue(ctx, args[0].Value().(string), key.String())
+			if err != nil {
+				return types.NewErr("lookup in %q failed: %s", args[0].Value().(string), err)
+			}
+
+			if !ok {
+				return args[2]
+			}
+
+			return types.String(value)
+		}),
+	))
+}
+
+// charClasses are the character classes of char_ratio. Vowels are the ASCII vowels, in any case, and special
+// characters are the ones that are neither letters nor digits, including spaces.
+var charClasses = map[string]func(rune) bool{
+	"upper":   unicode.IsUpper,
+	"digit":   unicode.IsDigit,
+	"special": func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) },
+	"vowel":   func(r rune) bool { return strings.ContainsRune("aeiouAEIOU", r) },
+}
+
+// overlap returns the length, in characters, of the longest common substring of the strings at the given
+// paths, e.g. overlap("req.param", "resp.body") > 20 to detect a value echoed back. Missing fields return 0.
+// Only the first 64Ki characters of the shorter string and 1Mi characters of the longer one are compared.
+func overlap(s *string) cel.EnvOption {
+	return cel.Function("overlap", cel.Overload("string_string_overlap_int",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.IntType,
+		cel.BinaryBinding(func(fieldA ref.Val, fieldB ref.Val) ref.Val {
+			a := gjson.Get(*s, fieldA.Value().(string)).String()
+			b := gjson.Get(*s, fieldB.Value().(string)).String()
+
+			return types.Int(longestCommonSubstring(a, b))
+		}),
+	))
+}
+
+// overlapRatio returns the length of the longest common substring of the strings at the given paths divided
+// by the length of the shorter one, from 0 to 1, e.g. overlap_ratio("req.param", "resp.body") > 0.8 flags a
+// parameter reflected almost entirely. Missing or empty fields return 0. Strings are compared within the
+// limits of overlap, and the ratio is relative to the compared part of the shorter string.
+func overlapRatio(s *string) cel.EnvOption {
+	return cel.Function("overlap_ratio", cel.Overload("string_string_overlap_ratio_double",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.DoubleType,
+		cel.BinaryBinding(func(fieldA ref.Val, fieldB ref.Val) ref.Val {
+			a := gjson.Get(*s, fieldA.Value().(string)).String()
+			b := gjson.Get(*s, fieldB.Value().(string)).String()
+
+			common, shorter := overlapOf(a, b)
+			if shorter == 0 {
+				return types.Double(0)
+			}
+
+			return types.Double(float64(common) / float64(shorter))
+		}),
+	))
+}
+
+// charRatio returns the fraction, from 0.0 to 1.0, of the characters of the string at the given path that
+// belong to a class: "upper", "digit", "special" or "vowel", e.g. char_ratio("dns.query", "digit") > 0.3 helps
+// spotting randomly generated names. Characters are counted as runes. Missing fields and empty strings return
+// 0.0, and unknown classes make the evaluation fail.
+func charRatio(s *string) cel.EnvOption {
+	return cel.Function("char_ratio", cel.Overload("string_string_char_ratio_double",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.DoubleType,
+		cel.BinaryBinding(func(field ref.Val, class ref.Val) ref.Val {
+			inClass, ok := charClasses[class.Value().(string)]
+			if !ok {
+				return types.NewErr("unknown character class %q", class.Value())
+			}
+
+			var total, matched int
+			for _, r := range gjson.Get(*s, field.Value().(string)).String() {
+				total++
+				if inClass(r) {
+					matched++
+				}
+			}
+
+			if total == 0 {
+				return types.Double(0)
+			}
+
+			return types.Double(float64(matched) / float64(total))
+		}),
+	))
+}
+
+// truncate returns the string at the given path truncated to at most maxLen runes, e.g. truncate("message", 256).
+// The three-argument form appends a suffix when the value is truncated, keeping the result within maxLen runes,
+// e.g. truncate("message", 256, "..."). Missing fields return an empty string.
+func truncate(s *string) cel.EnvOption {
+	return cel.Function("truncate",
+		cel.Overload("string_int_truncate_string",
+			[]*cel.Type{cel.StringType, cel.IntType}, cel.StringType,
+			cel.BinaryBinding(func(field ref.Val, maxLen ref.Val) ref.Val {
+				value := gjson.Get(*s, field.Value().(string)).String()
+				return types.String(truncateRunes(value, int(maxLen.Value().(int64)), ""))
+			}),
+		),
+		cel.Overload("string_int_string_truncate_string",
+			[]*cel.Type{cel.StringType, cel.IntType, cel.StringType}, cel.StringType,
+			cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+				value := gjson.Get(*s, args[0].Value().(string)).String()
+				return types.String(truncateRunes(value, int(args[1].Value().(int64)), args[2].Value().(string)))
+			}),
+		),
+	)
+}
+
+// numericAggregate declares a function reducing the numbers of the array at the given path to a double,
+// as used by sum, avg, max and min, e.g. max("latencies") > 1000.0. Elements that are not numbers are skipped,
+// and an empty or missing array returns 0.
+func numericAggregate(s *string, name string, reduce func([]float64) float64) cel.EnvOption {
+	return cel.Function(name, cel.Overload(fmt.Sprintf("string_%s_double", name),
+		[]*cel.Type{cel.StringType}, cel.DoubleType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			var values []float64
+			for _, item := range gjson.Get(*s, field.Value().(string)).Array() {
+				if item.Type == gjson.Number {
+					values = append(values, item.Num)
+				}
+			}
+
+			if len(values) == 0 {
+				return types.Double(0)
+			}
+
+			return types.Double(reduce(values))
+		}),
+	))
+}
+
+// keysCount returns the number of keys of the JSON object at the given path, e.g. keys_count("headers") > 50.
+// Missing or non-object fields return 0.
+func keysCount(s *string) cel.EnvOption {
+	return cel.Function("keys_count", cel.Overload("string_keys_count_int",
+		[]*cel.Type{cel.StringType}, cel.IntType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			value := gjson.Get(*s, field.Value().(string))
+			if !value.IsObject() {
+				return types.Int(0)
+			}
+
+			var count int64
+			value.ForEach(func(_, _ gjson.Result) bool {
+				count++
+				return true
+			})
+
+			return types.Int(count)
+		}),
+	))
+}
+
+// joinField returns the elements of the JSON array at the given path joined with a separator, e.g.
+// join_field("dns.answers", ",") returns "10.0.0.1,10.0.0.2". Strings are joined as they are, other elements
+// by their JSON representation and nulls as empty strings. Missing or non-array fields return an empty string.
+func joinField(s *string) cel.EnvOption {
+	return cel.Function("join_field", cel.Overload("string_string_join_field_string",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.StringType,
+		cel.BinaryBinding(func(field ref.Val, sep ref.Val) ref.Val {
+			v := gjson.Get(*s, field.Value().(string))
+			if !v.IsArray() {
+				return types.String("")
+			}
+
+			items := v.Array()
+			values := make([]string, len(items))
+			for i, item := range items {
+				values[i] = item.String()
+			}
+
+			return types.String(strings.Join(values, sep.Value().(string)))
+		}),
+	))
+}
+
+// objectKeys returns the key names of the JSON object at the given path in document order,
+// e.g. "authorization" in keys("headers"). Missing or non-object fields return an empty list.
+func objectKeys(s *string) cel.EnvOption {
+	return cel.Function("keys", cel.Overload("string_keys_list",
+		[]*cel.Type{cel.StringType}, cel.ListType(cel.StringType),
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			keys := []string{}
+
+			value := gjson.Get(*s, field.Value().(string))
+			if value.IsObject() {
+				value.ForEach(func(key, _ gjson.Result) bool {
+					keys = append(keys, key.String())
+					return true
+				})
+			}
+
+			return types.DefaultTypeAdapter.NativeToValue(keys)
+		}),
+	))
+}
+
+// matchesPattern returns true if the string at the given path matches the named entry of the patterns
+// section of the configuration, e.g. matches_pattern("origin.user", "corp_username"). Patterns are compiled
+// once per configuration reload. Unknown or invalid patterns make the evaluation fail.
+func matchesPattern(s *string) cel.EnvOption {
+	return cel.Function("matches_pattern", cel.Overload("string_string_matches_pattern_bool",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+		cel.BinaryBinding(func(field ref.Val, name ref.Val) ref.Val {
+			patternName := name.Value().(string)
+
+			cache := currentPatternCache.Load()
+			if cache == nil {
+				return types.NewErr("unknown pattern %q: configuration not loaded", patternName)
+			}
+
+			re, err := cache.get("", patternName)
+			if err != nil {
+				return types.NewErr("cannot use pattern %q: %s", patternName, catcher.ToSdkError(err).Msg)
+			}
+
+			return types.Bool(re.MatchString(gjson.Get(*s, field.Value().(string)).String()))
+		}),
+	))
+}
+
+// ruleEnabled returns true if the rule is enabled for the tenant whose ID is at the given path, according to
+// the disabled rules of the configuration, e.g. rule_enabled(1042, "dataSource.tenant"). Rules disabled
+// globally are disabled for every tenant, while tenants missing from the event or the configuration have no
+// specific disabled rules, so their rules default to enabled. It fails when the configuration is not loaded.
+func ruleEnabled(s *string) cel.EnvOption {
+	return cel.Function("rule_enabled", cel.Overload("int_string_rule_enabled_bool",
+		[]*cel.Type{cel.IntType, cel.StringType}, cel.BoolType,
+		cel.BinaryBinding(func(ruleID ref.Val, tenantField ref.Val) ref.Val {
+			id := ruleID.Value().(int64)
+
+			snapshot := currentCfgSnapshot.Load()
+			if snapshot == nil {
+				return types.NewErr("cannot check rule %d: configuration not loaded", id)
+			}
+
+			if id < 0 {
+				return types.True
+			}
+
+			tenantID := gjson.Get(*s, tenantField.Value().(string)).String()
+
+			cfgMutex.RLock()
+			defer cfgMutex.RUnlock()
+
+			return types.Bool(!snapshot.cfg.IsRuleDisabled(tenantID, uint64(id)))
+		}),
+	))
+}
+
+// reCaptures returns the capture groups of the first match of a regular expression in a string as a map,
+// indexed by group name, or by group number for unnamed groups, e.g.
+// re_captures(safe("msg", ""), "user=(?P<user>\\w+) port=(\\d+)").user. Groups that did not participate in
+// the match are empty strings, and no match returns an empty map. Patterns are compiled once and cached.
+func reCaptures(_ *string) cel.EnvOption {
+	return cel.Function("re_captures", cel.Overload("string_string_re_captures_map",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.MapType(cel.StringType, cel.StringType),
+		cel.BinaryBinding(func(value ref.Val, pattern ref.Val) ref.Val {
+			compiled := compileRegex(pattern.Value().(string))
+			if compiled.err != nil {
+				return types.NewErr("invalid regular expression %q: %s", pattern.Value().(string), compiled.err)
+			}
+
+			captures := make(map[string]string)
+
+			match := compiled.re.FindStringSubmatch(value.Value().(string))
+			for i, name := range compiled.re.SubexpNames() {
+				if i == 0 || match == nil {
+					continue
+				}
+
+				if name == "" {
+					name = strconv.Itoa(i)
+				}
+
+				captures[name] = match[i]
+			}
+
+			return types.DefaultTypeAdapter.NativeToValue(captures)
+		}),
+	))
+}
+
+// reList returns re_any, or re_all when all is true, which return true if the string at the given path
+// matches any, or every, regular expression of the list, e.g. re_any("msg", ["(?i)mimikatz", "sekurlsa::"]).
+// Patterns are compiled once and cached. Malformed patterns written as literals fail when the expression is
+// checked, while the ones computed at runtime make the evaluation fail. Missing fields are matched as an
+// empty string. With an empty list, re_any returns false and re_all returns true.
+func reList(s *string, name string, all bool) cel.EnvOption {
+	function := cel.Function(name, cel.Overload("string_list_"+name+"_bool",
+		[]*cel.Type{cel.StringType, cel.ListType(cel.StringType)}, cel.BoolType,
+		cel.BinaryBinding(func(field ref.Val, patterns ref.Val) ref.Val {
+			value := gjson.Get(*s, field.Value().(string)).String()
+
+			it := patterns.(traits.Lister).Iterator()
+			for it.HasNext() == types.True {
+				pattern := it.Next().Value().(string)
+
+				compiled := compileRegex(pattern)
+				if compiled.err != nil {
+					return types.NewErr("invalid %s pattern %q: %s", name, pattern, compiled.err)
+				}
+
+				if compiled.re.MatchString(value) != all {
+					return types.Bool(!all)
+				}
+			}
+
+			return types.Bool(all)
+		}),
+	))
+
+	return func(e *cel.Env) (*cel.Env, error) {
+		e, err := function(e)
+		if err != nil {
+			return nil, err
+		}
+
+		return cel.ASTValidators(regexListValidator{function: name})(e)
+	}
+}
+
+// mapEval evaluates a boolean sub-expression against each element of the JSON array at the given path, bound
+// to the item variable, and returns the list of results, e.g. map_eval("procs", "item.cpu > 90").exists(x, x).
+// Elements whose evaluation fails or does not return a boolean yield false, and missing or non-array fields
+// return an empty list. Sub-expressions can only use the standard CEL functions. Each distinct sub-expression
+// is compiled on first use and cached, but evaluating it once per element still costs far more than the
+// gjson-based functions, so large arrays are better filtered with EvaluateArray. Invalid sub-expressions make
+// the evaluation fail, as does the end of the evaluation context.
+func mapEval(ctx context.Context, s *string) cel.EnvOption {
+	return cel.Function("map_eval", cel.Overload("string_string_map_eval_list",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.ListType(cel.BoolType),
+		cel.BinaryBinding(func(field ref.Val, expression ref.Val) ref.Val {
+			compiled := compileSubExpression(expression.Value().(string))
+			if compiled.err != nil {
+				return types.NewErr("invalid sub-expression %q: %s", expression.Value().(string), compiled.err)
+			}
+
+			v := gjson.Get(*s, field.Value().(string))
+			if !v.IsArray() {
+				return types.DefaultTypeAdapter.NativeToValue([]bool{})
+			}
+
+			items := v.Array()
+			results := make([]bool, len(items))
+			for i, item := range items {
+				if err := ctx.Err(); err != nil {
+					return types.NewErr("map_eval of %q interrupted: %s", expression.Value().(string), err)
+				}
+
+				out, _, err := compiled.prg.ContextEval(ctx, map[string]any{"item": item.Value()})
+				if err != nil {
+					if ctx.Err() != nil {
+						return types.NewErr("map_eval of %q interrupted: %s", expression.Value().(string), ctx.Err())
+					}
+					continue
+				}
+
+				results[i], _ = out.Value().(bool)
+			}
+
+			return types.DefaultTypeAdapter.NativeToValue(results)
+		}),
+	))
+}
+
+// hasAll returns true if every path of the list exists in the data, e.g. has_all(["src.ip", "dst.ip"]).
+// An empty list returns true.
+func hasAll(s *string) cel.EnvOption {
+	return cel.Function("has_all", cel.Overload("list_has_all_bool",
+		[]*cel.Type{cel.ListType(cel.StringType)}, cel.BoolType,
+		cel.UnaryBinding(func(paths ref.Val) ref.Val {
+			for path := range listToSet(paths) {
+				if !gjson.Get(*s, path).Exists() {
+					return types.False
+				}
+			}
+
+			return types.True
+		}),
+	))
+}
+
+// hasAny returns true if at least one path of the list exists in the data, e.g. has_any(["user", "username"]).
+// An empty list returns false.
+func hasAny(s *string) cel.EnvOption {
+	return cel.Function("has_any", cel.Overload("list_has_any_bool",
+		[]*cel.Type{cel.ListType(cel.StringType)}, cel.BoolType,
+		cel.UnaryBinding(func(paths ref.Val) ref.Val {
+			for path := range listToSet(paths) {
+				if gjson.Get(*s, path).Exists() {
+					return types.True
+				}
+			}
+
+			return types.False
+		}),
+	))
+}
+
+// firstPath returns the value of the first of the given paths that exists in the data, keeping its native type,
+// or the default value (the last argument) when none exists, e.g. first_path("src.port", "source.port", 0).
+// Up to four paths can be passed as arguments, or any number of them as a list: first_path(["a", "b"], "").
+// The result is dynamically typed: JSON numbers are doubles, objects maps and arrays lists, so comparisons
+// must use a matching type (e.g. first_path("port", "src.port", 0) == 22.0), and a path holding a value of
+// another type than the default is still returned. Null values exist and are returned as null.
+func firstPath(s *string) cel.EnvOption {
+	first := func(paths []ref.Val, def ref.Val) ref.Val {
+		for _, path := range paths {
+			if v := gjson.Get(*s, path.Value().(string)); v.Exists() {
+				return gjsonToVal(v)
+			}
+		}
+
+		return def
+	}
+
+	return cel.Function("first_path",
+		cel.Overload("list_dyn_first_path_dyn",
+			[]*cel.Type{cel.ListType(cel.StringType), cel.DynType}, cel.DynType,
+			cel.BinaryBinding(func(paths ref.Val, def ref.Val) ref.Val {
+				var items []ref.Val
+
+				it := paths.(traits.Lister).Iterator()
+				for it.HasNext() == types.True {
+					items = append(items, it.Next())
+				}
+
+				return first(items, def)
+			}),
+		),
+		cel.Overload("string_string_dyn_first_path_dyn",
+			[]*cel.Type{cel.StringType, cel.StringType, cel.DynType}, cel.DynType,
+			cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+				return first(args[:2], args[2])
+			}),
+		),
+		cel.Overload("string_string_string_dyn_first_path_dyn",
+			[]*cel.Type{cel.StringType, cel.StringType, cel.StringType, cel.DynType}, cel.DynType,
+			cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+				return first(args[:3], args[3])
+			}),
+		),
+		cel.Overload("string_string_string_string_dyn_first_path_dyn",
+			[]*cel.Type{cel.StringType, cel.StringType, cel.StringType, cel.StringType, cel.DynType}, cel.DynType,
+			cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+				return first(args[:4], args[4])
+			}),
+		),
+	)
+}
+
+// maxCorrKeyFields is the maximum number of paths passed as arguments to corr_key, more can be passed as a list.
+const maxCorrKeyFields = 6
+
+// corrKey returns a deterministic correlation key for the values at the given paths, e.g.
+// corr_key("src.ip", "dst.ip", "dst.port"), as the first 16 hex characters of the SHA-256 of the values joined
+// with a separator. Values are normalized by trimming spaces and lower-casing their string representation, and
+// missing fields contribute an empty value, so each value keeps its position in the key. Up to six paths can be
+// passed as arguments, or any number of them as a list: corr_key(["src.ip", "dst.ip"]).
+func corrKey(s *string) cel.EnvOption {
+	key := func(paths []ref.Val) ref.Val {
+		hash := sha256.New()
+		for i, path := range paths {
+			if i > 0 {
+				hash.Write([]byte{0x1f})
+			}
+
+			value := gjson.Get(*s, path.Value().(string)).String()
+			hash.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+		}
+
+		return types.String(hex.EncodeToString(hash.Sum(nil))[:16])
+	}
+
+	overloads := []cel.FunctionOpt{
+		cel.Overload("list_corr_key_string",
+			[]*cel.Type{cel.ListType(cel.StringType)}, cel.StringType,
+			cel.UnaryBinding(func(paths ref.Val) ref.Val {
+				var items []ref.Val
+
+				it := paths.(traits.Lister).Iterator()
+				for it.HasNext() == types.True {
+					items = append(items, it.Next())
+				}
+
+				return key(items)
+			}),
+		),
+	}
+
+	for n := 1; n <= maxCorrKeyFields; n++ {
+		overloads = append(overloads, cel.Overload(strings.Repeat("string_", n)+"corr_key_string",
+			slices.Repeat([]*cel.Type{cel.StringType}, n), cel.StringType,
+			cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+				return key(args)
+			}),
+		))
+	}
+
+	return cel.Function("corr_key", overloads...)
+}
+
+// arrayAt returns the element at the given index of the JSON array at the given path, or the default value
+// when the field is missing, is not an array, or the index is out of range.
+// Negative indices count from the end of the array, so -1 returns the last element.
+func arrayAt(s *string) cel.EnvOption {
+	return cel.Function("at", cel.Overload("string_int_dyn_at_dyn",
+		[]*cel.Type{cel.StringType, cel.IntType, cel.DynType}, cel.DynType,
+		cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+			v := gjson.Get(*s, args[0].Value().(string))
+			if !v.IsArray() {
+				return args[2]
+			}
+
+			items := v.Array()
+			index := int(args[1].Value().(int64))
+			if index < 0 {
+				index += len(items)
+			}
+
+			if index < 0 || index >= len(items) {
+				return args[2]
+			}
+
+			return gjsonToVal(items[index])
+		}),
+	))
+}
+
+// defaultClockSkew is the tolerance applied by within_last to timestamps slightly in the future.
+const defaultClockSkew = 1 * time.Minute
+
+// withinLast returns true if the timestamp at the given path is not older than the given duration.
+// Durations use the Go syntax (e.g. "5m", "1h30m"). Timestamps up to one minute in the future are
+// accepted to tolerate clock skew; a custom tolerance can be passed as a third argument.
+// Missing or invalid timestamps and durations return false.
+func withinLast(s *string) cel.EnvOption {
+	within := func(field, window, skew string) ref.Val {
+		ts, ok := parseTime(gjson.Get(*s, field))
+		if !ok {
+			return types.False
+		}
+
+		w, err := time.ParseDuration(window)
+		if err != nil {
+			return types.False
+		}
+
+		tolerance := defaultClockSkew
+		if skew != "" {
+			tolerance, err = time.ParseDuration(skew)
+			if err != nil {
+				return types.False
+			}
+		}
+
+		age := time.Since(ts)
+		return types.Bool(age <= w && age >= -tolerance)
+	}
+
+	return cel.Function("within_last",
+		cel.Overload("string_string_within_last_bool",
+			[]*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+			cel.BinaryBinding(func(field ref.Val, window ref.Val) ref.Val {
+				return within(field.Value().(string), window.Value().(string), "")
+			}),
+		),
+		cel.Overload("string_string_string_within_last_bool",
+			[]*cel.Type{cel.StringType, cel.StringType, cel.StringType}, cel.BoolType,
+			cel.FunctionBinding(func(args ...ref.Val) ref.Val {
+				return within(args[0].Value().(string), args[1].Value().(string), args[2].Value().(string))
+			}),
+		),
+	)
+}
+
+// timeDiff returns the number of seconds elapsed from the timestamp at startField to the one at endField,
+// negative when the end precedes the start. Timestamps are parsed like in within_last (RFC3339 or epoch).
+// Caveat: 0 is returned when either field is missing or invalid, which is indistinguishable from equal
+// timestamps; guard with exists() or has_all() when that matters.
+func timeDiff(s *string) cel.EnvOption {
+	return cel.Function("time_diff", cel.Overload("string_string_time_diff_double",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.DoubleType,
+		cel.BinaryBinding(func(startField ref.Val, endField ref.Val) ref.Val {
+			start, ok := parseTime(gjson.Get(*s, startField.Value().(string)))
+			if !ok {
+				return types.Double(0)
+			}
+
+			end, ok := parseTime(gjson.Get(*s, endField.Value().(string)))
+			if !ok {
+				return types.Double(0)
+			}
+
+			return types.Double(end.Sub(start).Seconds())
+		}),
+	))
+}
+
+// timeBucket returns the timestamp at the given path floored to a multiple of the interval since the Unix epoch,
+// e.g. time_bucket("ts", "5m") returns 2024-05-01T10:05:00Z for "2024-05-01T12:07:31+02:00". Buckets are computed
+// in UTC, so intervals of days or longer start at midnight UTC rather than at the local midnight of the event.
+// Timestamps are parsed like in within_last and intervals use the Go syntax; missing or invalid timestamps and
+// non-positive or invalid intervals return the zero timestamp (the Unix epoch).
+func timeBucket(s *string) cel.EnvOption {
+	return cel.Function("time_bucket", cel.Overload("string_string_time_bucket_timestamp",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.TimestampType,
+		cel.BinaryBinding(func(field ref.Val, interval ref.Val) ref.Val {
+			zero := types.Timestamp{Time: time.Unix(0, 0).UTC()}
+
+			ts, ok := parseTime(gjson.Get(*s, field.Value().(string)))
+			if !ok {
+				return zero
+			}
+
+			d, err := time.ParseDuration(interval.Value().(string))
+			if err != nil || d <= 0 {
+				return zero
+			}
+
+			ns := ts.UnixNano()
+			bucket := ns - ns%int64(d)
+			if ns%int64(d) < 0 {
+				bucket -= int64(d)
+			}
+
+			return types.Timestamp{Time: time.Unix(0, bucket).UTC()}
+		}),
+	))
+}
+
+// weekday returns the day of the week, from 0 (Sunday) to 6 (Saturday), of the timestamp at the given path in
+// the given IANA time zone, e.g. weekday("login.ts", "Europe/Madrid") == 0. Timestamps are parsed like in
+// within_last. Unknown time zones fall back to UTC with a warning, missing or invalid timestamps return -1.
+func weekday(s *string) cel.EnvOption {
+	return cel.Function("weekday", cel.Overload("string_string_weekday_int",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.IntType,
+		cel.BinaryBinding(func(field ref.Val, tz ref.Val) ref.Val {
+			ts, ok := localTime(s, field.Value().(string), tz.Value().(string))
+			if !ok {
+				return types.Int(-1)
+			}
+
+			return types.Int(ts.Weekday())
+		}),
+	))
+}
+
+// hourOfDay returns the hour, from 0 to 23, of the timestamp at the given path in the given IANA time zone,
+// e.g. hour("login.ts", "America/New_York") >= 22. Timestamps are parsed like in within_last. Unknown time
+// zones fall back to UTC with a warning, missing or invalid timestamps return -1.
+func hourOfDay(s *string) cel.EnvOption {
+	return cel.Function("hour", cel.Overload("string_string_hour_int",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.IntType,
+		cel.BinaryBinding(func(field ref.Val, tz ref.Val) ref.Val {
+			ts, ok := localTime(s, field.Value().(string), tz.Value().(string))
+			if !ok {
+				return types.Int(-1)
+			}
+
+			return types.Int(ts.Hour())
+		}),
+	))
+}
+
+// isWeekend returns true if the timestamp at the given path falls on a Saturday or Sunday in the given IANA
+// time zone, e.g. is_weekend("login.ts", "Europe/Madrid"). Timestamps are parsed like in within_last. Unknown
+// time zones fall back to UTC with a warning, missing or invalid timestamps return false.
+func isWeekend(s *string) cel.EnvOption {
+	return cel.Function("is_weekend", cel.Overload("string_string_is_weekend_bool",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+		cel.BinaryBinding(func(field ref.Val, tz ref.Val) ref.Val {
+			ts, ok := localTime(s, field.Value().(string), tz.Value().(string))
+			if !ok {
+				return types.False
+			}
+
+			return types.Bool(ts.Weekday() == time.Saturday || ts.Weekday() == time.Sunday)
+		}),
+	))
+}
+
+// isHoliday returns true if the date of the timestamp at the given path is in the named list registered with
+// RegisterHolidays, e.g. is_holiday("login.ts", "es"). The date is taken in the offset of the timestamp, UTC
+// for epoch timestamps. Missing or invalid timestamps return false, and an unknown list is an error.
+func isHoliday(s *string) cel.EnvOption {
+	return cel.Function("is_holiday", cel.Overload("string_string_is_holiday_bool",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+		cel.BinaryBinding(func(field ref.Val, name ref.Val) ref.Val {
+			ts, valid := parseTime(gjson.Get(*s, field.Value().(string)))
+
+			holiday, ok := isHolidayDate(name.Value().(string), ts)
+			if !ok {
+				return types.NewErr("unknown holiday list %q, register it with RegisterHolidays", name.Value())
+			}
+
+			return types.Bool(valid && holiday)
+		}),
+	))
+}
+
+// localTime parses the timestamp at the given path and converts it to the given time zone.
+func localTime(s *string, field, tz string) (time.Time, bool) {
+	ts, ok := parseTime(gjson.Get(*s, field))
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return ts.In(loadLocation(tz)), true
+}
+
+// locationCacheTTL and locationCacheSize bound the cache of the time zones used by the CEL functions.
+const (
+	locationCacheTTL  = time.Hour
+	locationCacheSize = 100
+)
+
+// loadLocation loads a time zone of the IANA database, falling back to UTC with a warning when it is unknown.
+// Results are cached, so an unknown time zone is reported once per cache period rather than on every evaluation.
+var loadLocation = utils.MemoizeWithLimit(func(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		catcher.Info("unknown time zone, using UTC", map[string]any{
+			"timezone": name,
+			"cause":    err.Error(),
+			"status":   400,
+		})
+		return time.UTC
+	}
+
+	return loc
+}, locationCacheTTL, locationCacheSize)
+
+// parseTime parses a timestamp from a gjson value. Strings are parsed as RFC3339 (with or without
+// fractional seconds) or as a number; numbers are treated as epoch seconds, or epoch milliseconds
+// when they are too large to be seconds.
+func parseTime(v gjson.Result) (time.Time, bool) {
+	switch v.Type {
+	case gjson.String:
+		if ts, err := time.Parse(time.RFC3339Nano, v.Str); err == nil {
+			return ts, true
+		}
+
+		n := gjson.Parse(v.Str)
+		if n.Type != gjson.Number {
+			return time.Time{}, false
+		}
+
+		return parseTime(n)
+	case gjson.Number:
+		epoch := v.Float()
+		if epoch > 1e11 || epoch < -1e11 {
+			return time.UnixMilli(int64(epoch)).UTC(), true
+		}
+
+		sec := int64(epoch)
+		return time.Unix(sec, int64((epoch-float64(sec))*1e9)).UTC(), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// kvGet returns the value of a key from the space-separated key=value pairs found in the string at the given path,
+// e.g. kv_get("message", "src") returns "10.0.0.1" for `src=10.0.0.1 dst=10.0.0.2`. Values may be double-quoted
+// to include spaces. Returns an empty string if the field or the key are missing.
+func kvGet(s *string) cel.EnvOption {
+	return cel.Function("kv_get", cel.Overload("string_string_kv_get_string",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.StringType,
+		cel.BinaryBinding(func(field ref.Val, key ref.Val) ref.Val {
+			v := gjson.Get(*s, field.Value().(string))
+			if v.Type != gjson.String {
+				return types.String("")
+			}
+
+			return types.String(kvLookup(v.Str, key.Value().(string)))
+		}),
+	))
+}
+
+// cefField returns a header field or extension of the CEF message at the given path, e.g.
+// cef_field("message", "src") returns "10.0.0.1" for "CEF:0|Vendor|Product|1.0|100|Login|5|src=10.0.0.1".
+// Header fields are named version, deviceVendor, deviceProduct, deviceVersion, signatureId, name and severity.
+// A syslog header before "CEF:" is ignored. Malformed messages and missing keys return an empty string.
+func cefField(s *string) cel.EnvOption {
+	return cel.Function("cef_field", cel.Overload("string_string_cef_field_string",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.StringType,
+		cel.BinaryBinding(func(field ref.Val, key ref.Val) ref.Val {
+			v := gjson.Get(*s, field.Value().(string))
+			if v.Type != gjson.String {
+				return types.String("")
+			}
+
+			fields, ok := parseCEF(v.Str)
+			if !ok {
+				return types.String("")
+			}
+
+			return types.String(fields[key.Value().(string)])
+		}),
+	))
+}
+
+// syslogSeverity returns the severity (0 emergency to 7 debug) encoded in the <PRI> prefix of the syslog message
+// at the given path, e.g. syslog_severity("message") returns 3 for "<131>Oct 11 22:14:15 host app: failed".
+// Missing fields and messages without a valid prefix return -1.
+func syslogSeverity(s *string) cel.EnvOption {
+	return cel.Function("syslog_severity", cel.Overload("string_syslog_severity_int",
+		[]*cel.Type{cel.StringType}, cel.IntType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			v := gjson.Get(*s, field.Value().(string))
+			if v.Type != gjson.String {
+				return types.Int(-1)
+			}
+
+			return types.Int(syslogSeverityOf(v.Str))
+		}),
+	))
+}
+
+// kvLookup scans a string of space-separated key=value pairs and returns the value of the first pair matching key.
+func kvLookup(str, key string) string {
+	for i := 0; i < len(str); {
+		// Skip separators
+		for i < len(str) && str[i] == ' ' {
+			i++
+		}
+
+		start := i
+		for i < len(str) && str[i] != '=' && str[i] != ' ' {
+			i++
+		}
+		k := str[start:i]
+
+		if i >= len(str) || str[i] != '=' {
+			continue
+		}
+		i++
+
+		var value string
+		if i < len(str) && str[i] == '"' {
+			end := strings.IndexByte(str[i+1:], '"')
+			if end < 0 {
+				value, i = str[i+1:], len(str)
+			} else {
+				value, i = str[i+1:i+1+end], i+end+2
+			}
+		} else {
+			start = i
+			for i < len(str) && str[i] != ' ' {
+				i++
+			}
+			value = str[start:i]
+		}
+
+		if k == key {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// qsGet returns the first value of a parameter from the URL query string found at the given path.
+// The field may hold a bare query string (a=1&b=2) or a URL, in which case the part after "?" is used.
+// Returns an empty string if the field or the parameter are missing.
+func qsGet(s *string) cel.EnvOption {
+	return cel.Function("qs_get", cel.Overload("string_string_qs_get_string",
+		[]*cel.Type{cel.StringType, cel.StringType}, cel.StringType,
+		cel.BinaryBinding(func(field ref.Val, key ref.Val) ref.Val {
+			v := gjson.Get(*s, field.Value().(string))
+			if v.Type != gjson.String {
+				return types.String("")
+			}
+
+			query := v.Str
+			if i := strings.IndexByte(query, '?'); i >= 0 {
+				query = query[i+1:]
+			}
+
+			// Malformed pairs are skipped, the valid ones are still returned
+			values, _ := url.ParseQuery(query)
+
+			return types.String(values.Get(key.Value().(string)))
+		}),
+	))
+}
+
+// portNumber returns the port number at the given path, accepting numbers and numeric strings,
+// or false when it is missing, not an integer or out of the 0-65535 range.
+func portNumber(s *string, field string) (int64, bool) {
+	v := gjson.Get(*s, field)
+	if v.Type != gjson.Number && v.Type != gjson.String {
+		return 0, false
+	}
+
+	port, err := strconv.ParseInt(strings.TrimSpace(v.String()), 10, 64)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, false
+	}
+
+	return port, true
+}
+
+// portClass returns the IANA range of the port number at the given path: "well-known" (0-1023),
+// "registered" (1024-49151) or "ephemeral" (49152-65535), e.g. port_class("dst.port") == "ephemeral".
+// Numeric strings are accepted; missing, non-integer and out-of-range values return "invalid".
+func portClass(s *string) cel.EnvOption {
+	return cel.Function("port_class", cel.Overload("string_port_class_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			port, ok := portNumber(s, field.Value().(string))
+
+			switch {
+			case !ok:
+				return types.String("invalid")
+			case port <= 1023:
+				return types.String("well-known")
+			case port <= 49151:
+				return types.String("registered")
+			default:
+				return types.String("ephemeral")
+			}
+		}),
+	))
+}
+
+// isWellKnown returns true if the port number at the given path is a well-known port (0-1023), e.g.
+// is_well_known("dst.port"). Missing, non-integer and out-of-range values return false.
+func isWellKnown(s *string) cel.EnvOption {
+	return cel.Function("is_well_known", cel.Overload("string_is_well_known_bool",
+		[]*cel.Type{cel.StringType}, cel.BoolType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			port, ok := portNumber(s, field.Value().(string))
+			return types.Bool(ok && port <= 1023)
+		}),
+	))
+}
+
+// fileExt returns the lowercase extension, without the dot, of the file name or path at the given path, e.g.
+// file_ext("attachment.name") returns "exe" for "Invoice.PDF.exe". Missing fields and names without an
+// extension return an empty string.
+func fileExt(s *string) cel.EnvOption {
+	return cel.Function("file_ext", cel.Overload("string_file_ext_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			return types.String(fileExtension(gjson.Get(*s, field.Value().(string)).String()))
+		}),
+	))
+}
+
+// fileCategoryOf returns the category of the file name or path at the given path according to its extension:
+// "executable", "script", "document", "archive" or "other", e.g. file_category("attachment.name") == "executable".
+// Missing fields and unknown extensions return "other".
+func fileCategoryOf(s *string) cel.EnvOption {
+	return cel.Function("file_category", cel.Overload("string_file_category_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			return types.String(fileCategory(fileExtension(gjson.Get(*s, field.Value().(string)).String())))
+		}),
+	))
+}
+
+// urlDecode returns the percent-decoded string at the given path, e.g. url_decode("url.path") returns
+// "/static/../etc/passwd" for "/static/%2e%2e%2fetc/passwd". A "+" is kept as is, use query_decode for
+// query strings and form bodies. Invalid encodings return the original string, missing fields an empty string.
+func urlDecode(s *string) cel.EnvOption {
+	return cel.Function("url_decode", cel.Overload("string_url_decode_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			value := gjson.Get(*s, field.Value().(string)).String()
+
+			decoded, err := url.PathUnescape(value)
+			if err != nil {
+				return types.String(value)
+			}
+
+			return types.String(decoded)
+		}),
+	))
+}
+
+// queryDecode behaves like url_decode but also decodes "+" as a space, as used in query strings and form
+// bodies, e.g. query_decode("url.query") returns "q=a b" for "q=a+b".
+func queryDecode(s *string) cel.EnvOption {
+	return cel.Function("query_decode", cel.Overload("string_query_decode_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			value := gjson.Get(*s, field.Value().(string)).String()
+
+			decoded, err := url.QueryUnescape(value)
+			if err != nil {
+				return types.String(value)
+			}
+
+			return types.String(decoded)
+		}),
+	))
+}
+
+// minBase64Length is the minimum length of the strings considered base64 by is_base64 and b64_len, since
+// shorter alphanumeric strings, e.g. hostnames and identifiers, are often valid base64 by chance.
+const minBase64Length = 16
+
+// decodeBase64 decodes a padded string of the standard base64 alphabet, ignoring surrounding spaces. It
+// returns false for strings shorter than minBase64Length, with a wrong padding or out of the alphabet.
+func decodeBase64(str string) ([]byte, bool) {
+	str = strings.TrimSpace(str)
+	if len(str) < minBase64Length || len(str)%4 != 0 {
+		return nil, false
+	}
+
+	decoded, err := base64.StdEncoding.Strict().DecodeString(str)
+	if err != nil {
+		return nil, false
+	}
+
+	return decoded, true
+}
+
+// isBase64 returns true if a string is plausibly base64-encoded data, e.g. is_base64(safe("dns.txt", "")).
+// The string must be correctly padded, use the standard alphabet and be at least minBase64Length long.
+func isBase64(_ *string) cel.EnvOption {
+	return cel.Function("is_base64", cel.Overload("string_is_base64_bool",
+		[]*cel.Type{cel.StringType}, cel.BoolType,
+		cel.UnaryBinding(func(value ref.Val) ref.Val {
+			_, ok := decodeBase64(value.Value().(string))
+			return types.Bool(ok)
+		}),
+	))
+}
+
+// b64Len returns the length in bytes of the data encoded in a base64 string, e.g.
+// b64_len(safe("dns.txt", "")) > 1000. Strings rejected by is_base64 return 0.
+func b64Len(_ *string) cel.EnvOption {
+	return cel.Function("b64_len", cel.Overload("string_b64_len_int",
+		[]*cel.Type{cel.StringType}, cel.IntType,
+		cel.UnaryBinding(func(value ref.Val) ref.Val {
+			decoded, _ := decodeBase64(value.Value().(string))
+			return types.Int(len(decoded))
+		}),
+	))
+}
+
+// byteUnits are the multipliers of the data size units, in powers of 1024, indexed by upper-cased unit.
+var byteUnits = map[string]float64{
+	"B":   1,
+	"KB":  1 << 10,
+	"KIB": 1 << 10,
+	"MB":  1 << 20,
+	"MIB": 1 << 20,
+	"GB":  1 << 30,
+	"GIB": 1 << 30,
+	"TB":  1 << 40,
+	"TIB": 1 << 40,
+	"PB":  1 << 50,
+	"PIB": 1 << 50,
+}
+
+// toBytes converts a size in the given unit to bytes, e.g. bytes > to_bytes(10, "MB") compares with 10485760.
+// Units are B, KB, MB, GB, TB and PB in powers of 1024 (KiB, MiB, etc. are accepted as aliases), ignoring case.
+// The size can be a number or the path of a numeric field, e.g. to_bytes("quota.value", "GB"). Missing or
+// non-numeric fields and unknown units return 0.
+func toBytes(s *string) cel.EnvOption {
+	convert := func(size float64, unit ref.Val) ref.Val {
+		multiplier, ok := byteUnits[strings.ToUpper(strings.TrimSpace(unit.Value().(string)))]
+		if !ok {
+			return types.Double(0)
+		}
+
+		return types.Double(size * multiplier)
+	}
+
+	return cel.Function("to_bytes",
+		cel.Overload("int_string_to_bytes_double",
+			[]*cel.Type{cel.IntType, cel.StringType}, cel.DoubleType,
+			cel.BinaryBinding(func(size ref.Val, unit ref.Val) ref.Val {
+				return convert(float64(size.Value().(int64)), unit)
+			}),
+		),
+		cel.Overload("double_string_to_bytes_double",
+			[]*cel.Type{cel.DoubleType, cel.StringType}, cel.DoubleType,
+			cel.BinaryBinding(func(size ref.Val, unit ref.Val) ref.Val {
+				return convert(size.Value().(float64), unit)
+			}),
+		),
+		cel.Overload("string_string_to_bytes_double",
+			[]*cel.Type{cel.StringType, cel.StringType}, cel.DoubleType,
+			cel.BinaryBinding(func(field ref.Val, unit ref.Val) ref.Val {
+				v := gjson.Get(*s, field.Value().(string))
+				if v.Type != gjson.Number {
+					return types.Double(0)
+				}
+
+				return convert(v.Float(), unit)
+			}),
+		),
+	)
+}
+
+// humanBytes formats the byte count at the given path with the largest unit keeping it at or above 1, e.g.
+// human_bytes("size") returns "1.5 MB" for 1572864. Units are powers of 1024 and values are rounded to one
+// decimal. Missing, non-numeric or negative fields return an empty string.
+func humanBytes(s *string) cel.EnvOption {
+	return cel.Function("human_bytes", cel.Overload("string_human_bytes_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(field ref.Val) ref.Val {
+			v := gjson.Get(*s, field.Value().(string))
+			if v.Type != gjson.Number || v.Float() < 0 {
+				return types.String("")
+			}
+
+			size := v.Float()
+
+			units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+			unit := 0
+			for size >= 1024 && unit < len(units)-1 {
+				size /= 1024
+				unit++
+			}
+
+			formatted := strings.TrimSuffix(strconv.FormatFloat(size, 'f', 1, 64), ".0")
+
+			return types.String(formatted + " " + units[unit])
+		}),
+	))
+}
+
+// gjsonToVal converts a gjson result into its CEL representation.
+func gjsonToVal(v gjson.Result) ref.Val {
+	return types.DefaultTypeAdapter.NativeToValue(v.Value())
+}
+
+// listToSet converts a CEL list into a set of the string representations of its elements.
+func listToSet(list ref.Val) map[string]struct{} {
+	set := make(map[string]struct{})
+
+	lister, ok := list.(traits.Lister)
+	if !ok {
+		return set
+	}
+
+	it := lister.Iterator()
+	for it.HasNext() == types.True {
+		item := it.Next()
+		if str, ok := item.Value().(string); ok {
+			set[str] = struct{}{}
+		} else {
+			set[fmt.Sprint(item.Value())] = struct{}{}
+		}
+	}
+
+	return set
+}
+
+func valueToCelType(value interface{}) *cel.Type {
+	switch value.(type) {
+	case bool:
+		return cel.BoolType
+	case string:
+		return cel.StringType
+	case int, int32, int64:
+		return cel.IntType
+	case uint, uint32, uint64:
+		return cel.UintType
+	case float32, float64:
+		return cel.DoubleType
+	case []byte:
+		return cel.BytesType
+	case time.Time:
+		return cel.TimestampType
+	case map[string]interface{}:
+		return cel.MapType(cel.StringType, cel.DynType)
+	case map[string]*structpb.Value:
+		return cel.MapType(cel.StringType, cel.DynType)
+	case []interface{}:
+		return cel.ListType(cel.DynType)
+	case nil:
+		return cel.NullType
+	case proto.Message:
+		return cel.DynType
+	default:
+		t := reflect.TypeOf(value)
+		return cel.ObjectType(t.String())
+	}
+}
+
+// parseEmail splits an RFC 5322 address into its local part and its lower-cased domain.
+func parseEmail(value string) (local, domain string, ok bool) {
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return "", "", false
+	}
+
+	at := strings.LastIndexByte(addr.Address, '@')
+	if at <= 0 || at == len(addr.Address)-1 {
+		return "", "", false
+	}
+
+	return addr.Address[:at], strings.ToLower(addr.Address[at+1:]), true
+}
+
+// embeddedJSON returns the JSON document encoded in the string at the given path.
+func embeddedJSON(data, path string) (string, bool) {
+	value := gjson.Get(data, path)
+	if value.Type != gjson.String || !gjson.Valid(value.Str) {
+		return "", false
+	}
+	return value.Str, true
+}
+
+// truncateRunes truncates value to at most maxLen runes, ending it with suffix when truncated. The suffix is
+// dropped if it does not fit in maxLen.
+func truncateRunes(value string, maxLen int, suffix string) string {
+	if maxLen <= 0 {
+		return ""
+	}
+
+	if utf8.RuneCountInString(value) <= maxLen {
+		return value
+	}
+
+	keep := maxLen - utf8.RuneCountInString(suffix)
+	if keep < 0 {
+		keep, suffix = maxLen, ""
+	}
+
+	i := 0
+	for pos := range value {
+		if i == keep {
+			return value[:pos] + suffix
+		}
+		i++
+	}
+
+	return value + suffix
+}
+
+// sumFloats returns the sum of the values.
+func sumFloats(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+// avgFloats returns the arithmetic mean of a non-empty list of values.
+func avgFloats(values []float64) float64 {
+	return sumFloats(values) / float64(len(values))
 }
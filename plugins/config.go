@@ -1,17 +1,22 @@
 package plugins
 
 import (
+	"errors"
 	"fmt"
 	"github.com/threatwinds/go-sdk/catcher"
 	"github.com/threatwinds/go-sdk/utils"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tidwall/gjson"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 var cfg *Config
@@ -109,48 +114,219 @@ func startLockMonitor() {
 	}()
 }
 
-// loadCfg loads configuration files from the "pipeline" directory within the working directory.
-// It reads all YAML files, decodes them into Config objects, and merges their contents into the receiver Config object.
-// The function updates the Pipeline, DisabledRules, Tenants, Patterns, and Plugins fields of the receiver Config object.
-// If an error occurs while reading or unmarshalling a file, the function logs the error and continues with the next file.
-func (c *Config) loadCfg() {
-	pipelineFolder, err := utils.MkdirJoin(WorkDir, "pipeline")
+// loadCfg loads the given configuration files, listed by cfgFiles from the "pipeline" directories of the
+// working directories grouped by root, see cfgRoots, and the Env into the receiver Config object.
+// It streams all YAML files document by document, decodes them into Config objects, and merges their contents into the receiver Config object.
+// The function updates the Pipeline, DisabledRules, Tenants, Patterns, Plugins, and NetworkLists fields of the receiver Config object.
+// If an error occurs while reading or unmarshalling a file, the function logs the error and continues with the next file,
+// none of the documents of that file being merged.
+// Files beyond the limits are skipped with a warning.
+// It returns the files from which at least one document was merged, and the errors of the files that could not
+// be read joined, so the caller can back off while files are broken.
+func (c *Config) loadCfg(layers [][]string, limits CfgLimits) ([]string, error) {
+	sourceFiles, err := c.loadCfgFiles(layers, limits)
+
+	c.Env = getEnv()
+
+	return sourceFiles, err
+}
+
+// cfgRoots returns the working directories whose pipeline directories are loaded, read from WORK_DIRS as a
+// comma-separated list, e.g. "/opt/base,/workdir". It defaults to WorkDir, which always holds the lock file.
+// Roots are listed from the lowest to the highest precedence: pipelines, disabled rules and tenants of every
+// root are appended in order, while patterns, plugins and network lists with the same name, and tenants with
+// the same ID, are replaced by the later roots, see overlay. Repeated roots are only loaded once.
+func cfgRoots() []string {
+	dirs, _ := getEnvStrSlice("WORK_DIRS", "", false)
+
+	var roots []string
+	for _, dir := range dirs {
+		if dir != "" && !slices.Contains(roots, dir) {
+			roots = append(roots, dir)
+		}
+	}
+
+	if len(roots) == 0 {
+		return []string{WorkDir}
+	}
+
+	return roots
+}
+
+// cfgFiles lists the YAML files of the pipeline directories of the given roots, including their
+// subdirectories, grouped by root in precedence order. Missing directories yield no files.
+func cfgFiles(roots []string) [][]string {
+	layers := make([][]string, 0, len(roots))
+	for _, root := range roots {
+		layers = append(layers, utils.ListFiles(filepath.Join(root, "pipeline"), ".yaml"))
+	}
+
+	return layers
+}
+
+// loadCfgFiles merges the given layers of YAML files into the receiver, skipping the files beyond the limits
+// and the ones with any document that cannot be read, and returns the files from which at least one document
+// was merged. The errors of the files that cannot be read, already logged, are returned joined.
+// Each group of files, e.g. the ones of a root listed by cfgFiles, forms a layer merged into the receiver with
+// overlay, so the files of a root are merged together, whatever their subdirectory, while later roots override.
+func (c *Config) loadCfgFiles(layers [][]string, limits CfgLimits) ([]string, error) {
+	var sourceFiles []string
+	var errs []error
+	var files int
+	var totalBytes int64
+
+	for _, cFiles := range layers {
+		layer := newCfg()
+
+		for _, cFile := range cFiles {
+			info, err := os.Stat(cFile)
+			if err != nil {
+				errs = append(errs, catcher.Error("error reading YAML file", err, map[string]interface{}{"file": cFile}))
+				continue
+			}
+
+			if reason := limits.exceeds(files, totalBytes, info.Size()); reason != "" {
+				catcher.Info("skipping pipeline file", map[string]any{
+					"file":   cFile,
+					"size":   info.Size(),
+					"reason": reason,
+					"limits": limits,
+					"status": 413,
+				})
+				continue
+			}
+
+			files++
+			totalBytes += info.Size()
+
+			// Documents are merged into a scratch configuration first, so a file failing halfway is not applied
+			fileCfg := newCfg()
+			documents := 0
+
+			err = utils.StreamPbYaml(cFile, func(b []byte) error {
+				err := fileCfg.mergeCfgDocument(b)
+				if err != nil {
+					return err
+				}
+
+				documents++
+
+				return nil
+			})
+			if err != nil {
+				errs = append(errs, catcher.Error("error reading YAML file", err, map[string]interface{}{"file": cFile}))
+				continue
+			}
+
+			if documents > 0 {
+				layer.merge(fileCfg)
+				sourceFiles = append(sourceFiles, cFile)
+			}
+		}
+
+		c.overlay(layer)
+	}
+
+	return sourceFiles, errors.Join(errs...)
+}
+
+// newCfg returns an empty Config whose maps are ready to be merged into.
+func newCfg() *Config {
+	return &Config{
+		Plugins:      make(map[string]*Value),
+		Patterns:     make(map[string]string),
+		NetworkLists: make(map[string]*NetworkList),
+	}
+}
+
+// mergeCfgDocument decodes a JSON configuration document and merges it into the receiver, see merge.
+func (c *Config) mergeCfgDocument(b []byte) error {
+	var nCfg = new(Config)
+
+	err := protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(b, nCfg)
 	if err != nil {
-		_ = catcher.Error("failed to create pipeline folder", err, map[string]interface{}{"dir": pipelineFolder})
-		os.Exit(1)
+		return err
 	}
 
-	cFiles := utils.ListFiles(pipelineFolder.String(), ".yaml")
-	for _, cFile := range cFiles {
-		var nCfg = new(Config)
-		b, err := utils.ReadPbYaml(cFile)
-		if err != nil {
-			_ = catcher.Error("error reading YAML file", err, map[string]interface{}{"file": cFile})
-			continue
+	c.merge(nCfg)
+
+	return nil
+}
+
+// merge merges another configuration into the receiver, whose maps must be initialized. Pipelines and
+// tenants are appended, disabled rules are appended skipping the ones already disabled, while patterns,
+// plugins and network lists are replaced by name.
+func (c *Config) merge(nCfg *Config) {
+	c.Pipeline = append(c.Pipeline, nCfg.Pipeline...)
+
+	for _, id := range nCfg.DisabledRules {
+		if !slices.Contains(c.DisabledRules, id) {
+			c.DisabledRules = append(c.DisabledRules, id)
 		}
+	}
 
-		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(b, nCfg)
-		if err != nil {
-			_ = catcher.Error("error reading YAML file", err, map[string]interface{}{"file": cFile})
+	c.Tenants = append(c.Tenants, nCfg.Tenants...)
+
+	for name, pattern := range nCfg.Patterns {
+		c.Patterns[name] = pattern
+	}
+
+	for name, plugin := range nCfg.Plugins {
+		c.Plugins[name] = plugin
+	}
+
+	for name, list := range nCfg.NetworkLists {
+		c.NetworkLists[name] = list
+	}
+}
+
+// overlay merges a configuration of higher precedence, e.g. loaded from a later root, into the receiver like
+// merge, except that its tenants replace the ones with the same ID instead of being appended. Tenants without
+// ID are always appended. The tenants of nCfg are moved to the receiver, so nCfg must not be used afterwards.
+func (c *Config) overlay(nCfg *Config) {
+	var added []*Tenant
+	for _, tenant := range nCfg.Tenants {
+		i := slices.IndexFunc(c.Tenants, func(t *Tenant) bool {
+			return tenant.GetId() != "" && t.GetId() == tenant.GetId()
+		})
+		if i < 0 {
+			added = append(added, tenant)
 			continue
 		}
 
-		c.Pipeline = append(c.Pipeline, nCfg.Pipeline...)
+		c.Tenants[i] = tenant
+	}
 
-		c.DisabledRules = append(c.DisabledRules, nCfg.DisabledRules...)
+	nCfg.Tenants = added
 
-		c.Tenants = append(c.Tenants, nCfg.Tenants...)
+	c.merge(nCfg)
+}
 
-		for name, pattern := range nCfg.Patterns {
-			c.Patterns[name] = pattern
+// MergeConfig merges two configurations in memory with the semantics used to load the configuration files,
+// e.g. to build the merged view of several configuration packages in tests or generation tools, the overlay
+// behaving like a later root of WORK_DIRS. Pipelines of the overlay are appended to the ones of the base, and
+// disabled rules are appended without duplicates. Patterns, plugins and network lists are merged by name and
+// tenants by ID, the overlay taking precedence when both declare the same one; tenants without ID are
+// appended. The Env of the overlay is used when set. The inputs are not modified and the result does not
+// share memory with them. Nil inputs are treated as empty configurations.
+func MergeConfig(base, overlay *Config) *Config {
+	merged := newCfg()
+
+	for _, c := range []*Config{base, overlay} {
+		if c == nil {
+			continue
 		}
 
-		for name, plugin := range nCfg.Plugins {
-			c.Plugins[name] = plugin
+		c = proto.Clone(c).(*Config)
+
+		merged.overlay(c)
+
+		if c.Env != nil {
+			merged.Env = c.Env
 		}
 	}
 
-	c.Env = getEnv()
+	return merged
 }
 
 // RandomDuration returns a random time.Duration between min and max seconds. It panics if max <= 0.
@@ -172,7 +348,10 @@ func RandomDuration(min, max int) time.Duration {
 // configuration with the new one. It ensures thread safety by using
 // a mutex lock and a lockfile mechanism to prevent race conditions
 // with other components that might modify the configuration.
-func updateCfg() {
+// It returns an error when the loaded configuration is invalid, or fewer files than CfgLimits.MinFiles
+// contributed to it, and was not applied. The outcome is reported by CfgHealth. It also returns the errors of
+// the files that could not be read, while applying the remaining ones, so reloads back off until they are fixed.
+func updateCfg() error {
 	// Try to acquire the lock
 	maxRetries := 5
 
@@ -189,7 +368,7 @@ func updateCfg() {
 			time.Sleep(RandomDuration(10, 60))
 		} else {
 			_ = catcher.Error("failed to acquire lock after multiple retries", nil, nil)
-			return
+			return nil
 		}
 	}
 
@@ -200,22 +379,126 @@ func updateCfg() {
 		}
 	}()
 
+	// The pipeline directory of WorkDir, holding the lock file, was created by AcquireLock
+	return reloadCfg(cfgFiles(cfgRoots()), getCfgLimits())
+}
+
+// reloadCfg loads the given layers of files, see cfgFiles, into a new configuration and replaces the global
+// one with it, see loadCfg. When fewer files than limits.MinFiles contributed to it or it fails Validate, the
+// previous configuration is kept and the error returned. The outcome is recorded for CfgHealth. It also
+// returns the errors of the files that could not be read, while applying the remaining ones.
+func reloadCfg(layers [][]string, limits CfgLimits) error {
 	cfgMutex.Lock()
+	defer cfgMutex.Unlock()
+
+	tmpCfg := newCfg()
+	sourceFiles, filesErr := tmpCfg.loadCfg(layers, limits)
+
+	err := limits.checkMinFiles(sourceFiles)
+	if err == nil {
+		err = tmpCfg.Validate()
+	}
+
+	if err != nil {
+		catcher.Info("configuration not applied, keeping the last valid one", map[string]any{
+			"sourceFiles": sourceFiles,
+			"cause":       err.Error(),
+			"status":      500,
+		})
+		recordCfgLoad(err)
+		return err
+	}
+
+	pluginCfgs := tmpCfg.validatePluginCfgs()
 
-	tmpCfg := new(Config)
-	tmpCfg.Plugins = make(map[string]*Value)
-	tmpCfg.Patterns = make(map[string]string)
-	tmpCfg.loadCfg()
+	proto.Reset(cfg)
+	proto.Merge(cfg, tmpCfg)
 
-	*cfg = *tmpCfg
+	currentAssetIndex.Store(newAssetIndex(cfg))
+	currentNetworkLists.Store(newNetworkListIndex(cfg))
+	currentPatternCache.Store(newPatternCache(cfg, tmpCfg))
+	currentPluginCfgCache.Store(&pluginCfgCache{cfg: cfg, values: pluginCfgs})
+	currentCfgSnapshot.Store(&cfgSnapshot{cfg: cfg, loadedAt: time.Now(), sourceFiles: sourceFiles})
+	recordCfgLoad(nil)
 
-	cfgMutex.Unlock()
+	return filesErr
+}
+
+// cfgReloadInterval is the interval between configuration reloads while they succeed.
+const cfgReloadInterval = 60 * time.Second
+
+// maxCfgReloadInterval caps the interval between configuration reloads while they keep failing.
+const maxCfgReloadInterval = 10 * time.Minute
+
+// reloadBackoff computes the interval before the next configuration reload, doubling it on every consecutive
+// failure up to the maximum and resetting it on the first success.
+type reloadBackoff struct {
+	base     time.Duration
+	max      time.Duration
+	failures int
+}
+
+// next records the result of a reload and returns the interval to wait before the next one. It logs a
+// warning when the reloads start failing and a notice when they recover, instead of on every attempt.
+func (b *reloadBackoff) next(err error) time.Duration {
+	if err == nil {
+		if b.failures > 0 {
+			catcher.Info("configuration reload recovered", map[string]any{"failures": b.failures, "status": 200})
+		}
+
+		b.failures = 0
+		return b.base
+	}
+
+	b.failures++
+	if b.failures == 1 {
+		catcher.Info("configuration reload failing, backing off", map[string]any{"maxInterval": b.max.String(), "status": 400})
+	}
+
+	interval := b.base
+	for i := 1; i < b.failures && interval < b.max; i++ {
+		interval *= 2
+	}
+
+	return min(interval, b.max)
+}
+
+// cfgSnapshot describes when and from which files a configuration was loaded.
+type cfgSnapshot struct {
+	cfg         *Config
+	loadedAt    time.Time
+	sourceFiles []string
+}
+
+// currentCfgSnapshot describes the last load of the global configuration.
+var currentCfgSnapshot atomic.Pointer[cfgSnapshot]
+
+// LoadedAt returns when the current snapshot of the configuration was loaded, or the zero time if the
+// receiver is not the global configuration or it was not loaded yet. Comparing it with the reload interval
+// allows detecting a stalled reload loop, e.g. time.Since(cfg.LoadedAt()) > 2*time.Minute.
+func (c *Config) LoadedAt() time.Time {
+	if snapshot := currentCfgSnapshot.Load(); snapshot != nil && snapshot.cfg == c {
+		return snapshot.loadedAt
+	}
+	return time.Time{}
+}
+
+// SourceFiles returns the configuration files that contributed to the current snapshot of the configuration,
+// or nil if the receiver is not the global configuration or it was not loaded yet.
+func (c *Config) SourceFiles() []string {
+	if snapshot := currentCfgSnapshot.Load(); snapshot != nil && snapshot.cfg == c {
+		return slices.Clone(snapshot.sourceFiles)
+	}
+	return nil
 }
 
 // GetCfg initializes the configuration if it hasn't been initialized yet,
-// and starts a goroutine to periodically update the configuration every 60 seconds.
-// It waits for the initial configuration to be set before returning it.
-// The function returns a pointer to the Config struct.
+// and starts a goroutine to periodically update the configuration every 60 seconds, backing off
+// exponentially up to 10 minutes while the loaded configurations keep failing Validate.
+// It waits for the initial configuration to be set before returning it. Configurations failing
+// Validate are never applied, so it keeps waiting until a valid configuration is loaded.
+// The function returns a pointer to the Config struct, which is shared and overwritten in place on every
+// reload; use GetCfgSnapshot to get a copy that does not change.
 func GetCfg() *Config {
 	cfgOnce.Do(func() {
 		cfg = new(Config)
@@ -224,9 +507,9 @@ func GetCfg() *Config {
 		startLockMonitor()
 
 		go func() {
+			backoff := &reloadBackoff{base: cfgReloadInterval, max: maxCfgReloadInterval}
 			for {
-				updateCfg()
-				time.Sleep(60 * time.Second)
+				time.Sleep(backoff.next(updateCfg()))
 			}
 		}()
 	})
@@ -241,6 +524,21 @@ func GetCfg() *Config {
 	return cfg
 }
 
+// GetCfgSnapshot returns a deep copy of the current configuration, waiting for the initial configuration
+// like GetCfg. The Config returned by GetCfg is shared and overwritten in place on every reload, so a caller
+// holding it may observe a reload halfway or changing values. The copy is owned by the caller and never
+// changes, so long-lived consumers can hold and read it without locking; call GetCfgSnapshot again to
+// observe later reloads. Since the copy is not the global configuration, LoadedAt and SourceFiles return
+// their zero values for it.
+func GetCfgSnapshot() *Config {
+	c := GetCfg()
+
+	cfgMutex.RLock()
+	defer cfgMutex.RUnlock()
+
+	return proto.Clone(c).(*Config)
+}
+
 // PluginCfg retrieves the configuration for a specified plugin by name and unmarshal it into the provided type.
 // The function returns a pointer to the configuration of the specified type and a pointer to an error if any error occurs.
 //
@@ -281,3 +579,186 @@ func PluginCfg(pluginName string, wait bool) gjson.Result {
 		return pJson
 	}
 }
+
+// PluginCfgRaw retrieves the configuration of a plugin as JSON bytes, letting plugins hand it to
+// their own decoder (e.g. protojson or a dynamic schema) instead of querying a gjson.Result.
+// Unlike PluginCfg, it doesn't wait or panic when the plugin is not configured.
+//
+// Parameters:
+//
+//	pluginName: The name of the plugin whose configuration is to be retrieved.
+//
+// Returns:
+//
+//	[]byte: The JSON representation of the plugin configuration.
+//	error: An error if the plugin is not configured or its configuration cannot be marshalled.
+func PluginCfgRaw(pluginName string) ([]byte, error) {
+	return GetCfg().pluginCfgRaw(pluginName)
+}
+
+// pluginCfgRaw returns the JSON representation of the global configuration of a plugin.
+func (c *Config) pluginCfgRaw(pluginName string) ([]byte, error) {
+	pConfig, ok := c.Plugins[pluginName]
+	if !ok {
+		return nil, catcher.Error("plugin config not found", nil, map[string]any{"plugin": pluginName})
+	}
+
+	bJson, err := protojson.Marshal(pConfig)
+	if err != nil {
+		return nil, catcher.Error("cannot marshal plugin config", err, map[string]any{"plugin": pluginName})
+	}
+
+	return bJson, nil
+}
+
+// PluginCfgForTenant retrieves the configuration of a plugin for a specific tenant.
+// The tenant's override block for the plugin, if any, is deep merged over the global block,
+// so keys defined by the tenant take precedence while the remaining keys are inherited.
+//
+// Tenant overrides are declared in the pipeline YAML files under the tenant's plugins key:
+//
+//	plugins:
+//	  geolocation:
+//	    apiKey: global-key
+//	    timeout: 5
+//	tenants:
+//	  - id: 2b3c7ab4-1a4f-4c8b-9d43-0f5e0c6a1d2e
+//	    name: acme
+//	    plugins:
+//	      geolocation:
+//	        apiKey: acme-key
+//
+// Parameters:
+//
+//	pluginName: The name of the plugin whose configuration is to be retrieved.
+//	tenantID: The ID of the tenant whose overrides should be applied.
+//	wait: A boolean value that determines whether the function should wait for the configuration to be available.
+//
+// Returns:
+//
+//	gjson.Result: An object containing the effective configuration of the plugin for the tenant.
+func PluginCfgForTenant(pluginName, tenantID string, wait bool) gjson.Result {
+	for {
+		cfg := GetCfg()
+
+		pJson, ok, err := cfg.tenantPluginCfg(pluginName, tenantID)
+		if !ok || err != nil {
+			if wait {
+				time.Sleep(1 * time.Second)
+				continue
+			}
+
+			if err != nil {
+				panic(err)
+			}
+
+			panic("plugin config not found")
+		}
+
+		return pJson
+	}
+}
+
+// tenantPluginCfg merges the tenant's override block for a plugin over the global one.
+// It reports false if neither the global nor the tenant configuration defines the plugin.
+func (c *Config) tenantPluginCfg(pluginName, tenantID string) (gjson.Result, bool, error) {
+	global, ok := c.Plugins[pluginName]
+
+	var override *structpb.Value
+	for _, tenant := range c.Tenants {
+		if tenant.GetId() != tenantID {
+			continue
+		}
+
+		if v, found := tenant.Plugins[pluginName]; found {
+			override = v
+		}
+	}
+
+	if !ok && override == nil {
+		return gjson.Result{}, false, nil
+	}
+
+	bJson, err := utils.JSONCodec.Marshal(deepMerge(global.AsInterface(), override.AsInterface()))
+	if err != nil {
+		return gjson.Result{}, true, err
+	}
+
+	return gjson.ParseBytes(bJson), true, nil
+}
+
+// deepMerge merges override over base. Nested objects are merged recursively,
+// any other override value replaces the base value. Inputs are never modified.
+func deepMerge(base, override any) any {
+	if override == nil {
+		return base
+	}
+
+	baseMap, baseIsMap := base.(map[string]any)
+	overrideMap, overrideIsMap := override.(map[string]any)
+	if !baseIsMap || !overrideIsMap {
+		return override
+	}
+
+	merged := make(map[string]any, len(baseMap)+len(overrideMap))
+	for k, v := range baseMap {
+		merged[k] = v
+	}
+
+	for k, v := range overrideMap {
+		merged[k] = deepMerge(merged[k], v)
+	}
+
+	return merged
+}
+
+// disabledRulesFor returns the set of rule IDs disabled globally or for the given tenant.
+func (c *Config) disabledRulesFor(tenantID string) map[uint64]struct{} {
+	disabled := make(map[uint64]struct{}, len(c.DisabledRules))
+
+	for _, id := range c.DisabledRules {
+		disabled[id] = struct{}{}
+	}
+
+	for _, tenant := range c.Tenants {
+		if tenant.GetId() != tenantID {
+			continue
+		}
+
+		for _, id := range tenant.DisabledRules {
+			disabled[id] = struct{}{}
+		}
+	}
+
+	return disabled
+}
+
+// IsRuleDisabled reports whether the rule is disabled globally or for the given tenant.
+func (c *Config) IsRuleDisabled(tenantID string, ruleID uint64) bool {
+	_, ok := c.disabledRulesFor(tenantID)[ruleID]
+	return ok
+}
+
+// ActiveRules filters the provided rule IDs through the global and tenant disabled lists
+// and returns the remaining IDs sorted in ascending order without duplicates.
+//
+// Parameters:
+//   - tenantID: The ID of the tenant whose disabled rules should be applied.
+//   - allRuleIDs: The universe of rule IDs to filter.
+//
+// Returns:
+//   - []uint64: The rule IDs that are active for the tenant.
+func (c *Config) ActiveRules(tenantID string, allRuleIDs []uint64) []uint64 {
+	disabled := c.disabledRulesFor(tenantID)
+
+	active := make([]uint64, 0, len(allRuleIDs))
+	for _, id := range allRuleIDs {
+		if _, ok := disabled[id]; !ok {
+			active = append(active, id)
+		}
+	}
+
+	slices.Sort(active)
+
+	return slices.Compact(active)
+}
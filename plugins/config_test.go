@@ -0,0 +1,806 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threatwinds/go-sdk/catcher"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestActiveRules(t *testing.T) {
+	c := &Config{
+		DisabledRules: []uint64{2},
+		Tenants: []*Tenant{
+			{Id: "t1", DisabledRules: []uint64{4}},
+			{Id: "t2", DisabledRules: []uint64{5}},
+		},
+	}
+
+	assert.True(t, c.IsRuleDisabled("t1", 2))
+	assert.True(t, c.IsRuleDisabled("t1", 4))
+	assert.False(t, c.IsRuleDisabled("t1", 5))
+	assert.False(t, c.IsRuleDisabled("unknown", 4))
+
+	assert.Equal(t, []uint64{1, 3, 5}, c.ActiveRules("t1", []uint64{5, 4, 3, 2, 1, 3}))
+	assert.Equal(t, []uint64{1, 3, 4}, c.ActiveRules("t2", []uint64{1, 2, 3, 4, 5}))
+	assert.Equal(t, []uint64{}, c.ActiveRules("t1", nil))
+}
+
+func TestTenantPluginCfg(t *testing.T) {
+	global, err := structpb.NewValue(map[string]any{
+		"apiKey":  "global-key",
+		"timeout": 5,
+		"limits":  map[string]any{"rps": 10, "burst": 20},
+	})
+	require.NoError(t, err)
+
+	override, err := structpb.NewValue(map[string]any{
+		"apiKey": "acme-key",
+		"limits": map[string]any{"rps": 50},
+	})
+	require.NoError(t, err)
+
+	c := &Config{
+		Plugins: map[string]*structpb.Value{"geolocation": global},
+		Tenants: []*Tenant{
+			{Id: "acme", Plugins: map[string]*structpb.Value{"geolocation": override, "tenantOnly": override}},
+			{Id: "other"},
+		},
+	}
+
+	got, ok, err := c.tenantPluginCfg("geolocation", "acme")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "acme-key", got.Get("apiKey").String())
+	assert.Equal(t, int64(5), got.Get("timeout").Int())
+	assert.Equal(t, int64(50), got.Get("limits.rps").Int())
+	assert.Equal(t, int64(20), got.Get("limits.burst").Int())
+
+	got, ok, err = c.tenantPluginCfg("geolocation", "other")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "global-key", got.Get("apiKey").String())
+
+	got, ok, err = c.tenantPluginCfg("tenantOnly", "acme")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "acme-key", got.Get("apiKey").String())
+
+	_, ok, err = c.tenantPluginCfg("missing", "acme")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRedacted(t *testing.T) {
+	plugin, err := structpb.NewValue(map[string]any{
+		"apiKey":   "abc",
+		"url":      "https://example.com",
+		"accounts": []any{map[string]any{"user": "u", "Password": "p"}},
+		"nested":   map[string]any{"clientSecret": "s", "region": "us"},
+	})
+	require.NoError(t, err)
+
+	tenantPlugin, err := structpb.NewValue(map[string]any{"bearerToken": "t"})
+	require.NoError(t, err)
+
+	c := &Config{
+		Plugins: map[string]*structpb.Value{"p": plugin},
+		Tenants: []*Tenant{{Id: "t1", Plugins: map[string]*structpb.Value{"p": tenantPlugin}}},
+	}
+
+	redactedKeysMutex.RLock()
+	previous := slices.Clone(redactedKeys)
+	redactedKeysMutex.RUnlock()
+
+	t.Cleanup(func() {
+		redactedKeysMutex.Lock()
+		redactedKeys = previous
+		redactedKeysMutex.Unlock()
+	})
+
+	AddRedactedKeys("REGION")
+
+	r := c.Redacted()
+	fields := r.Plugins["p"].GetStructValue().AsMap()
+	assert.Equal(t, "****", fields["apiKey"])
+	assert.Equal(t, "https://example.com", fields["url"])
+	assert.Equal(t, "****", fields["accounts"].([]any)[0].(map[string]any)["Password"])
+	assert.Equal(t, "u", fields["accounts"].([]any)[0].(map[string]any)["user"])
+	assert.Equal(t, "****", fields["nested"].(map[string]any)["clientSecret"])
+	assert.Equal(t, "****", fields["nested"].(map[string]any)["region"])
+	assert.Equal(t, "****", r.Tenants[0].Plugins["p"].GetStructValue().AsMap()["bearerToken"])
+
+	assert.Equal(t, "abc", c.Plugins["p"].GetStructValue().AsMap()["apiKey"])
+	assert.NotContains(t, c.Dump(), "abc")
+}
+
+func TestPluginCfgRaw(t *testing.T) {
+	plugin, err := structpb.NewValue(map[string]any{"apiKey": "abc", "timeout": 5})
+	require.NoError(t, err)
+
+	c := &Config{Plugins: map[string]*structpb.Value{"geolocation": plugin}}
+
+	raw, err := c.pluginCfgRaw("geolocation")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"apiKey":"abc","timeout":5}`, string(raw))
+
+	_, err = c.pluginCfgRaw("missing")
+	assert.Error(t, err)
+}
+
+func TestValidatePluginCfgs(t *testing.T) {
+	type geoCfg struct {
+		APIKey  string `json:"apiKey"`
+		Timeout int    `json:"timeout"`
+	}
+
+	valid, err := structpb.NewValue(map[string]any{"apiKey": "abc", "timeout": 5})
+	require.NoError(t, err)
+
+	invalid, err := structpb.NewValue(map[string]any{"apiKey": 10})
+	require.NoError(t, err)
+
+	RegisterPluginCfg[geoCfg]("valid")
+	RegisterPluginCfg[geoCfg]("invalid")
+	RegisterPluginCfg[geoCfg]("absent")
+	defer func() {
+		pluginCfgTypesMutex.Lock()
+		clear(pluginCfgTypes)
+		pluginCfgTypesMutex.Unlock()
+	}()
+
+	c := &Config{Plugins: map[string]*structpb.Value{"valid": valid, "invalid": invalid}}
+	values := c.validatePluginCfgs()
+
+	errs := PluginCfgErrors()
+	assert.Len(t, errs, 2)
+	assert.NotContains(t, errs, "valid")
+	assert.Contains(t, errs, "invalid")
+	assert.Contains(t, errs, "absent")
+
+	assert.Len(t, values, 1)
+	assert.Equal(t, &geoCfg{APIKey: "abc", Timeout: 5}, values["valid"])
+}
+
+func TestDecodePluginCfg(t *testing.T) {
+	type geoCfg struct {
+		APIKey  string `json:"apiKey"`
+		Timeout int    `json:"timeout"`
+	}
+
+	type otherCfg struct {
+		APIKey string `json:"apiKey"`
+	}
+
+	valid, err := structpb.NewValue(map[string]any{"apiKey": "abc", "timeout": 5})
+	require.NoError(t, err)
+
+	RegisterPluginCfg[geoCfg]("geo")
+	defer func() {
+		pluginCfgTypesMutex.Lock()
+		clear(pluginCfgTypes)
+		pluginCfgTypesMutex.Unlock()
+	}()
+
+	c := &Config{Plugins: map[string]*structpb.Value{"geo": valid}}
+
+	uncached, err := decodePluginCfg[geoCfg](c, "geo")
+	require.NoError(t, err)
+	assert.Equal(t, &geoCfg{APIKey: "abc", Timeout: 5}, uncached)
+
+	currentPluginCfgCache.Store(&pluginCfgCache{cfg: c, values: c.validatePluginCfgs()})
+	defer currentPluginCfgCache.Store(nil)
+
+	first, err := decodePluginCfg[geoCfg](c, "geo")
+	require.NoError(t, err)
+	second, err := decodePluginCfg[geoCfg](c, "geo")
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Equal(t, uncached, first)
+
+	other, err := decodePluginCfg[otherCfg](c, "geo")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", other.APIKey)
+
+	_, err = decodePluginCfg[geoCfg](c, "missing")
+	assert.Error(t, err)
+}
+
+func TestDiffConfig(t *testing.T) {
+	pluginA, err := structpb.NewValue(map[string]any{"apiKey": "a"})
+	require.NoError(t, err)
+	pluginB, err := structpb.NewValue(map[string]any{"apiKey": "b"})
+	require.NoError(t, err)
+
+	old := &Config{
+		Pipeline:      []*Pipeline{{DataTypes: []string{"syslog"}}, {DataTypes: []string{"wineventlog"}}},
+		DisabledRules: []uint64{1, 2},
+		Tenants:       []*Tenant{{Id: "t1", Name: "acme"}, {Id: "t2"}},
+		Patterns:      map[string]string{"ip": `\d+`, "user": `\w+`},
+		Plugins:       map[string]*structpb.Value{"geo": pluginA, "old": pluginA},
+	}
+
+	updated := &Config{
+		Pipeline: []*Pipeline{
+			{DataTypes: []string{"syslog"}, Steps: []*Step{{Drop: &Drop{Where: "true"}}}},
+			{DataTypes: []string{"netflow"}},
+		},
+		DisabledRules: []uint64{2, 3},
+		Tenants:       []*Tenant{{Id: "t1", Name: "acme corp"}, {Id: "t3"}},
+		Patterns:      map[string]string{"ip": `\d+`, "user": `[a-z]+`, "mac": `\S+`},
+		Plugins:       map[string]*structpb.Value{"geo": pluginB, "new": pluginA},
+	}
+
+	d := DiffConfig(old, updated)
+	assert.Equal(t, []string{"netflow"}, d.AddedPipelines)
+	assert.Equal(t, []string{"wineventlog"}, d.RemovedPipelines)
+	assert.Equal(t, []string{"syslog"}, d.ChangedPipelines)
+	assert.Equal(t, []string{"t3"}, d.AddedTenants)
+	assert.Equal(t, []string{"t2"}, d.RemovedTenants)
+	assert.Equal(t, []string{"t1"}, d.ChangedTenants)
+	assert.Equal(t, []string{"mac"}, d.AddedPatterns)
+	assert.Empty(t, d.RemovedPatterns)
+	assert.Equal(t, []string{"user"}, d.ChangedPatterns)
+	assert.Equal(t, []string{"new"}, d.AddedPlugins)
+	assert.Equal(t, []string{"old"}, d.RemovedPlugins)
+	assert.Equal(t, []string{"geo"}, d.ChangedPlugins)
+	assert.Equal(t, []uint64{3}, d.AddedDisabledRules)
+	assert.Equal(t, []uint64{1}, d.RemovedDisabledRules)
+	assert.False(t, d.IsEmpty())
+
+	assert.True(t, DiffConfig(old, old).IsEmpty())
+	assert.Equal(t, []string{"t1", "t2"}, DiffConfig(nil, old).AddedTenants)
+}
+
+func TestNetworkList(t *testing.T) {
+	c := &Config{NetworkLists: map[string]*NetworkList{
+		"trusted": {Cidrs: []string{"10.0.0.0/8", "192.168.1.10", "2001:db8::/32", "bad"}},
+		"empty":   {},
+	}}
+
+	networks, ok := c.NetworkList("trusted")
+	require.True(t, ok)
+	require.Len(t, networks, 3)
+	assert.Equal(t, "10.0.0.0/8", networks[0].String())
+	assert.Equal(t, "192.168.1.10/32", networks[1].String())
+	assert.Equal(t, "2001:db8::/32", networks[2].String())
+
+	networks, ok = c.NetworkList("empty")
+	assert.True(t, ok)
+	assert.Empty(t, networks)
+
+	_, ok = c.NetworkList("missing")
+	assert.False(t, ok)
+
+	currentNetworkLists.Store(newNetworkListIndex(c))
+	defer currentNetworkLists.Store(nil)
+
+	networks, ok = c.NetworkList("trusted")
+	assert.True(t, ok)
+	assert.Len(t, networks, 3)
+
+	data := `{"a":"10.20.30.40","b":"192.168.1.10","c":"192.168.1.11","d":"2001:db8::5","e":"bad"}`
+
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{`in_network_list("trusted", "a")`, true},
+		{`in_network_list("trusted", "b")`, true},
+		{`in_network_list("trusted", "c")`, false},
+		{`in_network_list("trusted", "d")`, true},
+		{`in_network_list("trusted", "e")`, false},
+		{`in_network_list("trusted", "missing")`, false},
+		{`in_network_list("unknown", "a")`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := Evaluate(&data, tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAllAssets(t *testing.T) {
+	c := &Config{
+		Tenants: []*Tenant{
+			{Name: "acme", Id: "t1", Assets: []*Asset{{Name: "web", Ips: []string{"10.0.0.1"}}, {Name: "db"}}},
+			{Name: "empty", Id: "t2"},
+			{Name: "globex", Id: "t3", Assets: []*Asset{{Name: "mail", Hostnames: []string{"mail.globex.com"}}}},
+		},
+	}
+
+	assets := c.AllAssets()
+
+	var got []string
+	for _, a := range assets {
+		got = append(got, a.TenantID+"/"+a.TenantName+"/"+a.Asset.GetName())
+	}
+	assert.Equal(t, []string{"t1/acme/web", "t1/acme/db", "t3/globex/mail"}, got)
+
+	assets[0].Asset.Ips[0] = "10.0.0.2"
+	assert.Equal(t, "10.0.0.1", c.Tenants[0].Assets[0].Ips[0])
+
+	assert.Empty(t, new(Config).AllAssets())
+}
+
+func TestConfigSnapshot(t *testing.T) {
+	c := &Config{}
+	assert.True(t, c.LoadedAt().IsZero())
+	assert.Nil(t, c.SourceFiles())
+
+	loadedAt := time.Now()
+	currentCfgSnapshot.Store(&cfgSnapshot{cfg: c, loadedAt: loadedAt, sourceFiles: []string{"a.yaml", "b.yaml"}})
+	defer currentCfgSnapshot.Store(nil)
+
+	assert.Equal(t, loadedAt, c.LoadedAt())
+	assert.Equal(t, []string{"a.yaml", "b.yaml"}, c.SourceFiles())
+
+	c.SourceFiles()[0] = "changed.yaml"
+	assert.Equal(t, []string{"a.yaml", "b.yaml"}, c.SourceFiles())
+
+	other := &Config{}
+	assert.True(t, other.LoadedAt().IsZero())
+	assert.Nil(t, other.SourceFiles())
+}
+
+func TestCompiledPattern(t *testing.T) {
+	c := &Config{Patterns: map[string]string{"corp_username": `^[a-z]+\.[a-z]+$`, "broken": `(`}}
+
+	re, err := c.CompiledPattern("corp_username")
+	require.NoError(t, err)
+	assert.True(t, re.MatchString("john.doe"))
+
+	_, err = c.CompiledPattern("broken")
+	assert.Error(t, err)
+
+	_, err = c.CompiledPattern("missing")
+	assert.Error(t, err)
+
+	currentPatternCache.Store(newPatternCache(c, c))
+	defer currentPatternCache.Store(nil)
+
+	first, err := c.CompiledPattern("corp_username")
+	require.NoError(t, err)
+	second, err := c.CompiledPattern("corp_username")
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	data := `{"user":"john.doe","other":"John Doe"}`
+
+	got, err := Evaluate(&data, `matches_pattern("user", "corp_username")`)
+	assert.NoError(t, err)
+	assert.True(t, got)
+
+	got, err = Evaluate(&data, `matches_pattern("other", "corp_username")`)
+	assert.NoError(t, err)
+	assert.False(t, got)
+
+	_, err = Evaluate(&data, `matches_pattern("user", "missing")`)
+	require.Error(t, err)
+	assert.Contains(t, *catcher.ToSdkError(err).Cause, `unknown pattern`)
+
+	_, err = Evaluate(&data, `matches_pattern("user", "broken")`)
+	assert.Error(t, err)
+}
+
+func TestPatternCacheDuringReload(t *testing.T) {
+	owner := &Config{Patterns: map[string]string{"p0": `^a+$`}}
+	source := proto.Clone(owner).(*Config)
+	for i := 1; i < 50; i++ {
+		source.Patterns[fmt.Sprintf("p%d", i)] = `^a+$`
+	}
+
+	currentPatternCache.Store(newPatternCache(owner, source))
+	defer currentPatternCache.Store(nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// Overwrite the owner in place like updateCfg does, without the lock the evaluations never take
+		for i := 0; i < 100; i++ {
+			proto.Reset(owner)
+			proto.Merge(owner, &Config{Patterns: map[string]string{"p0": `^b+$`}})
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		re, err := owner.CompiledPattern(fmt.Sprintf("p%d", i))
+		require.NoError(t, err)
+		assert.True(t, re.MatchString("aaa"))
+	}
+
+	<-done
+}
+
+func TestValidate(t *testing.T) {
+	valid := &Config{
+		Patterns:     map[string]string{"ip": `\d+`},
+		Tenants:      []*Tenant{{Id: "t1"}, {Id: "t2"}, {Name: "no id"}, {Name: "no id either"}},
+		NetworkLists: map[string]*NetworkList{"trusted": {Cidrs: []string{"10.0.0.0/8", "192.168.1.1"}}},
+	}
+	assert.NoError(t, valid.Validate())
+	assert.NoError(t, (&Config{}).Validate())
+
+	invalid := &Config{
+		Patterns:     map[string]string{"ip": `\d+`, "broken": `(`, "alsoBroken": `[`},
+		Tenants:      []*Tenant{{Id: "t1"}, {Id: "t1", Name: "copy", Patterns: map[string]string{"ip": `(`}}},
+		NetworkLists: map[string]*NetworkList{"trusted": {Cidrs: []string{"10.0.0.0/33"}}},
+	}
+
+	err := invalid.Validate()
+	require.Error(t, err)
+
+	errs, ok := catcher.ToSdkError(err).Args["errors"].([]*catcher.SdkError)
+	require.True(t, ok)
+	require.Len(t, errs, 5)
+	assert.Equal(t, "alsoBroken", errs[0].Args["pattern"])
+	assert.Equal(t, "broken", errs[1].Args["pattern"])
+	assert.Equal(t, "copy", errs[2].Args["tenant"])
+	assert.Equal(t, "duplicate tenant", errs[3].Msg)
+	assert.Equal(t, "invalid entry in network list", errs[4].Msg)
+}
+
+func TestPatternFor(t *testing.T) {
+	c := &Config{
+		Patterns: map[string]string{"username": `^[a-z]+$`, "host": `^web-\d+$`},
+		Tenants: []*Tenant{
+			{Id: "acme", Patterns: map[string]string{"username": `^[a-z]+\.[a-z]+$`, "ticket": `^ACME-\d+$`}},
+			{Id: "globex"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		tenantID string
+		pattern  string
+		want     string
+		found    bool
+	}{
+		{"override", "acme", "username", `^[a-z]+\.[a-z]+$`, true},
+		{"added", "acme", "ticket", `^ACME-\d+$`, true},
+		{"inherited", "acme", "host", `^web-\d+$`, true},
+		{"tenant without overrides", "globex", "username", `^[a-z]+$`, true},
+		{"unknown tenant", "initech", "username", `^[a-z]+$`, true},
+		{"global", "", "username", `^[a-z]+$`, true},
+		{"tenant pattern not global", "", "ticket", "", false},
+		{"missing", "acme", "missing", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := c.PatternFor(tt.tenantID, tt.pattern)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	currentPatternCache.Store(newPatternCache(c, c))
+	defer currentPatternCache.Store(nil)
+
+	acme, err := c.CompiledPatternFor("acme", "username")
+	require.NoError(t, err)
+	assert.True(t, acme.MatchString("john.doe"))
+
+	global, err := c.CompiledPatternFor("globex", "username")
+	require.NoError(t, err)
+	assert.False(t, global.MatchString("john.doe"))
+
+	again, err := c.CompiledPatternFor("acme", "username")
+	require.NoError(t, err)
+	assert.Same(t, acme, again)
+	assert.NotSame(t, acme, global)
+}
+
+func TestLoadCfgFilesLimits(t *testing.T) {
+	dir := t.TempDir()
+
+	var files []string
+	for i, size := range []int{0, 0, 2048, 0, 0} {
+		file := filepath.Join(dir, fmt.Sprintf("%d.yaml", i))
+		content := fmt.Sprintf("patterns:\n  p%d: \"x\"\n", i) + "# " + strings.Repeat("x", size) + "\n"
+		require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+		files = append(files, file)
+	}
+
+	tests := []struct {
+		name   string
+		limits CfgLimits
+		want   []string
+	}{
+		{"unlimited", CfgLimits{}, []string{"p0", "p1", "p2", "p3", "p4"}},
+		{"max files", CfgLimits{MaxFiles: 2}, []string{"p0", "p1"}},
+		{"max file bytes", CfgLimits{MaxFileBytes: 1024}, []string{"p0", "p1", "p3", "p4"}},
+		{"max total bytes", CfgLimits{MaxTotalBytes: 2000}, []string{"p0", "p1", "p3", "p4"}},
+		{"combined", CfgLimits{MaxFiles: 3, MaxFileBytes: 1024}, []string{"p0", "p1", "p3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCfg()
+			sourceFiles, err := c.loadCfgFiles([][]string{files}, tt.limits)
+			require.NoError(t, err)
+
+			var got []string
+			for name := range c.Patterns {
+				got = append(got, name)
+			}
+
+			assert.ElementsMatch(t, tt.want, got)
+			assert.Len(t, sourceFiles, len(tt.want))
+		})
+	}
+}
+
+func TestCfgMinFilesHealth(t *testing.T) {
+	defer lastCfgLoad.Store(nil)
+
+	assert.ErrorIs(t, CfgHealth(), ErrCfgNotLoaded)
+
+	limits := CfgLimits{MinFiles: 2}
+	assert.NoError(t, limits.checkMinFiles([]string{"a.yaml", "b.yaml"}))
+	assert.NoError(t, CfgLimits{}.checkMinFiles(nil))
+
+	err := limits.checkMinFiles([]string{"a.yaml"})
+	assert.EqualError(t, err, "too few configuration files loaded: 1 of at least 2")
+
+	recordCfgLoad(err)
+	assert.Equal(t, err, CfgHealth())
+
+	recordCfgLoad(nil)
+	assert.NoError(t, CfgHealth())
+}
+
+func TestReloadCfgMinFiles(t *testing.T) {
+	t.Setenv("MODE", "worker")
+
+	previous := cfg
+	t.Cleanup(func() {
+		cfg = previous
+		lastCfgLoad.Store(nil)
+		currentAssetIndex.Store(nil)
+		currentNetworkLists.Store(nil)
+		currentPatternCache.Store(nil)
+		currentPluginCfgCache.Store(nil)
+		currentCfgSnapshot.Store(nil)
+	})
+	cfg = new(Config)
+
+	write := func(root, name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "pipeline"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "pipeline", name), []byte(content), 0o644))
+	}
+
+	full := t.TempDir()
+	write(full, "a.yaml", "patterns:\n  ip: '\\d+'\n")
+	write(full, "b.yaml", "patterns:\n  host: '\\w+'\n")
+
+	partial := t.TempDir()
+	write(partial, "a.yaml", "patterns:\n  other: '.+'\n")
+
+	limits := CfgLimits{MinFiles: 2}
+
+	require.NoError(t, reloadCfg(cfgFiles([]string{full}), limits))
+	require.NoError(t, CfgHealth())
+	assert.Equal(t, map[string]string{"ip": `\d+`, "host": `\w+`}, cfg.Patterns)
+	assert.Equal(t, "worker", cfg.Env.GetMode())
+
+	// A partial mount is rejected and the previous configuration kept
+	err := reloadCfg(cfgFiles([]string{partial}), limits)
+	assert.EqualError(t, err, "too few configuration files loaded: 1 of at least 2")
+	assert.Equal(t, err, CfgHealth())
+	assert.Equal(t, map[string]string{"ip": `\d+`, "host": `\w+`}, cfg.Patterns)
+	assert.ElementsMatch(t, cfgFiles([]string{full})[0], cfg.SourceFiles())
+
+	require.NoError(t, reloadCfg(cfgFiles([]string{full, partial}), limits))
+	assert.NoError(t, CfgHealth())
+	assert.Contains(t, cfg.Patterns, "other")
+}
+
+func TestReloadBackoff(t *testing.T) {
+	b := &reloadBackoff{base: time.Minute, max: 10 * time.Minute}
+	failure := errors.New("invalid configuration")
+
+	assert.Equal(t, time.Minute, b.next(nil))
+	assert.Equal(t, time.Minute, b.next(failure))
+	assert.Equal(t, 2*time.Minute, b.next(failure))
+	assert.Equal(t, 4*time.Minute, b.next(failure))
+	assert.Equal(t, 8*time.Minute, b.next(failure))
+	assert.Equal(t, 10*time.Minute, b.next(failure))
+	assert.Equal(t, 10*time.Minute, b.next(failure))
+	assert.Equal(t, 6, b.failures)
+
+	assert.Equal(t, time.Minute, b.next(nil))
+	assert.Zero(t, b.failures)
+	assert.Equal(t, time.Minute, b.next(failure))
+}
+
+func TestCfgRoots(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want []string
+	}{
+		{"unset", "", []string{WorkDir}},
+		{"single", "/opt/base", []string{"/opt/base"}},
+		{"layered", "/opt/base, /opt/site", []string{"/opt/base", "/opt/site"}},
+		{"repeated", "/opt/base,,/opt/site,/opt/base", []string{"/opt/base", "/opt/site"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WORK_DIRS", tt.env)
+			assert.Equal(t, tt.want, cfgRoots())
+		})
+	}
+}
+
+func TestCfgFilesPrecedence(t *testing.T) {
+	base := t.TempDir()
+	site := t.TempDir()
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	write := func(root, name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "pipeline"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "pipeline", name), []byte(content), 0o644))
+	}
+
+	write(base, "a.yaml", "patterns:\n  ip: \"base\"\n  host: \"base\"\ndisabledRules:\n  - 1\n")
+	write(site, "a.yaml", "patterns:\n  ip: \"site\"\ndisabledRules:\n  - 2\n")
+
+	c := newCfg()
+	sourceFiles, err := c.loadCfgFiles(cfgFiles([]string{base, missing, site}), CfgLimits{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{filepath.Join(base, "pipeline", "a.yaml"), filepath.Join(site, "pipeline", "a.yaml")}, sourceFiles)
+	assert.Equal(t, map[string]string{"ip": "site", "host": "base"}, c.Patterns)
+	assert.Equal(t, []uint64{1, 2}, c.DisabledRules)
+}
+
+func TestCfgFilesTenantOverlay(t *testing.T) {
+	base := t.TempDir()
+	site := t.TempDir()
+
+	write := func(root, name, content string) {
+		path := filepath.Join(root, "pipeline", name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	write(base, "a.yaml", "tenants:\n  - id: t1\n    name: base\n  - id: t2\n    name: other\n")
+	write(site, "a.yaml", "tenants:\n  - id: t1\n    name: site\n  - id: t3\n    name: new\n")
+
+	c := newCfg()
+	_, err := c.loadCfgFiles(cfgFiles([]string{base, site}), CfgLimits{})
+	require.NoError(t, err)
+	require.NoError(t, c.Validate())
+
+	var tenants []string
+	for _, tenant := range c.Tenants {
+		tenants = append(tenants, tenant.GetId()+":"+tenant.GetName())
+	}
+	assert.Equal(t, []string{"t1:site", "t2:other", "t3:new"}, tenants)
+
+	// Tenants repeated within a root are still reported by Validate
+	write(site, "b.yaml", "tenants:\n  - id: t3\n    name: copy\n")
+
+	c = newCfg()
+	_, err = c.loadCfgFiles(cfgFiles([]string{base, site}), CfgLimits{})
+	require.NoError(t, err)
+	assert.Error(t, c.Validate())
+
+	// Subdirectories of the pipeline directory belong to the layer of their root
+	single := t.TempDir()
+	write(single, "a.yaml", "tenants:\n  - id: t1\n    name: first\n")
+	write(single, filepath.Join("nested", "deeper", "b.yaml"), "tenants:\n  - id: t1\n    name: second\n")
+
+	c = newCfg()
+	sourceFiles, err := c.loadCfgFiles(cfgFiles([]string{single}), CfgLimits{})
+	require.NoError(t, err)
+	assert.Len(t, sourceFiles, 2)
+	assert.Len(t, c.Tenants, 2)
+	assert.Error(t, c.Validate())
+}
+
+func TestLoadCfgFilesPartialFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	good := filepath.Join(dir, "good.yaml")
+	require.NoError(t, os.WriteFile(good, []byte("patterns:\n  ip: \"good\"\n"), 0o644))
+
+	broken := filepath.Join(dir, "broken.yaml")
+	require.NoError(t, os.WriteFile(broken, []byte("patterns:\n  host: \"broken\"\ndisabledRules:\n  - 7\n"+
+		"---\npatterns: \"not a map\"\n"), 0o644))
+
+	c := newCfg()
+	sourceFiles, err := c.loadCfgFiles([][]string{{good, broken}}, CfgLimits{})
+	var fileErr *catcher.SdkError
+	require.ErrorAs(t, err, &fileErr)
+	assert.Equal(t, broken, fileErr.Args["file"])
+
+	assert.Equal(t, []string{good}, sourceFiles)
+	assert.Equal(t, map[string]string{"ip": "good"}, c.Patterns)
+	assert.Empty(t, c.DisabledRules)
+}
+
+func TestMergeConfig(t *testing.T) {
+	base := &Config{
+		Pipeline:      []*Pipeline{{DataTypes: []string{"syslog"}}},
+		DisabledRules: []uint64{1, 2},
+		Tenants:       []*Tenant{{Name: "acme"}, {Id: "t1", Name: "hooli"}},
+		Patterns:      map[string]string{"ip": "base", "host": "base"},
+		Plugins:       map[string]*Value{"geo": {}},
+		Env:           &Env{Mode: "worker"},
+	}
+	overlay := &Config{
+		Pipeline:      []*Pipeline{{DataTypes: []string{"wineventlog"}}},
+		DisabledRules: []uint64{2, 3},
+		Tenants:       []*Tenant{{Name: "globex"}, {Id: "t1", Name: "initech"}},
+		Patterns:      map[string]string{"ip": "overlay"},
+		NetworkLists:  map[string]*NetworkList{"internal": {}},
+	}
+
+	merged := MergeConfig(base, overlay)
+
+	require.Len(t, merged.Pipeline, 2)
+	assert.Equal(t, []string{"syslog"}, merged.Pipeline[0].DataTypes)
+	assert.Equal(t, []string{"wineventlog"}, merged.Pipeline[1].DataTypes)
+	assert.Equal(t, []uint64{1, 2, 3}, merged.DisabledRules)
+	require.Len(t, merged.Tenants, 3)
+	assert.Equal(t, "initech", merged.Tenants[1].Name)
+	assert.Equal(t, "globex", merged.Tenants[2].Name)
+	assert.Equal(t, map[string]string{"ip": "overlay", "host": "base"}, merged.Patterns)
+	assert.Contains(t, merged.Plugins, "geo")
+	assert.Contains(t, merged.NetworkLists, "internal")
+	assert.Equal(t, "worker", merged.Env.GetMode())
+
+	merged.Tenants[0].Name = "changed"
+	merged.Patterns["host"] = "changed"
+	assert.Equal(t, "acme", base.Tenants[0].Name)
+	assert.Equal(t, "base", base.Patterns["host"])
+	assert.Equal(t, []uint64{1, 2}, base.DisabledRules)
+
+	empty := MergeConfig(nil, nil)
+	assert.Empty(t, empty.Pipeline)
+	assert.NotNil(t, empty.Patterns)
+}
+
+func TestGetCfgSnapshot(t *testing.T) {
+	previous := cfg
+	cfgOnce.Do(func() {})
+	cfg = &Config{Env: &Env{Mode: "worker"}, Patterns: map[string]string{"ip": "v1"}, Tenants: []*Tenant{{Name: "acme"}}}
+	t.Cleanup(func() {
+		cfg = previous
+		cfgOnce = sync.Once{}
+	})
+
+	snapshot := GetCfgSnapshot()
+	assert.Equal(t, "v1", snapshot.Patterns["ip"])
+	assert.Equal(t, "acme", snapshot.Tenants[0].Name)
+
+	// A reload overwrites the shared configuration in place, the snapshot keeps its values
+	cfgMutex.Lock()
+	proto.Reset(cfg)
+	proto.Merge(cfg, &Config{Env: &Env{Mode: "worker"}, Patterns: map[string]string{"ip": "v2"}})
+	cfgMutex.Unlock()
+
+	assert.Equal(t, "v2", GetCfg().Patterns["ip"])
+	assert.Equal(t, "v1", snapshot.Patterns["ip"])
+	assert.Equal(t, "acme", snapshot.Tenants[0].Name)
+	assert.Equal(t, "v2", GetCfgSnapshot().Patterns["ip"])
+	assert.True(t, snapshot.LoadedAt().IsZero())
+}
@@ -0,0 +1,115 @@
+package plugins
+
+import (
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ConfigDiff describes the changes between two configurations as sorted lists of identifiers,
+// so it can be logged or emitted as an event. Pipelines are identified by their comma-separated
+// data types, tenants by their ID, and patterns and plugins by their name.
+type ConfigDiff struct {
+	AddedPipelines       []string `json:"addedPipelines,omitempty"`
+	RemovedPipelines     []string `json:"removedPipelines,omitempty"`
+	ChangedPipelines     []string `json:"changedPipelines,omitempty"`
+	AddedTenants         []string `json:"addedTenants,omitempty"`
+	RemovedTenants       []string `json:"removedTenants,omitempty"`
+	ChangedTenants       []string `json:"changedTenants,omitempty"`
+	AddedPatterns        []string `json:"addedPatterns,omitempty"`
+	RemovedPatterns      []string `json:"removedPatterns,omitempty"`
+	ChangedPatterns      []string `json:"changedPatterns,omitempty"`
+	AddedPlugins         []string `json:"addedPlugins,omitempty"`
+	RemovedPlugins       []string `json:"removedPlugins,omitempty"`
+	ChangedPlugins       []string `json:"changedPlugins,omitempty"`
+	AddedDisabledRules   []uint64 `json:"addedDisabledRules,omitempty"`
+	RemovedDisabledRules []uint64 `json:"removedDisabledRules,omitempty"`
+}
+
+// IsEmpty reports whether the diff contains no changes.
+func (d ConfigDiff) IsEmpty() bool {
+	return len(d.AddedPipelines)+len(d.RemovedPipelines)+len(d.ChangedPipelines)+
+		len(d.AddedTenants)+len(d.RemovedTenants)+len(d.ChangedTenants)+
+		len(d.AddedPatterns)+len(d.RemovedPatterns)+len(d.ChangedPatterns)+
+		len(d.AddedPlugins)+len(d.RemovedPlugins)+len(d.ChangedPlugins)+
+		len(d.AddedDisabledRules)+len(d.RemovedDisabledRules) == 0
+}
+
+// DiffConfig compares two configurations and returns what was added, removed or changed from old to updated.
+// A nil configuration is treated as empty. Pipelines sharing the same data types are compared as a group.
+func DiffConfig(old, updated *Config) ConfigDiff {
+	var d ConfigDiff
+
+	d.AddedPipelines, d.RemovedPipelines, d.ChangedPipelines = diffKeyed(groupPipelines(old), groupPipelines(updated),
+		func(a, b []*Pipeline) bool {
+			return slices.EqualFunc(a, b, func(x, y *Pipeline) bool { return proto.Equal(x, y) })
+		})
+
+	d.AddedTenants, d.RemovedTenants, d.ChangedTenants = diffKeyed(indexTenants(old), indexTenants(updated),
+		func(a, b *Tenant) bool { return proto.Equal(a, b) })
+
+	d.AddedPatterns, d.RemovedPatterns, d.ChangedPatterns = diffKeyed(old.GetPatterns(), updated.GetPatterns(),
+		func(a, b string) bool { return a == b })
+
+	d.AddedPlugins, d.RemovedPlugins, d.ChangedPlugins = diffKeyed(old.GetPlugins(), updated.GetPlugins(),
+		func(a, b *Value) bool { return proto.Equal(a, b) })
+
+	oldRules := make(map[uint64]struct{})
+	for _, id := range old.GetDisabledRules() {
+		oldRules[id] = struct{}{}
+	}
+
+	newRules := make(map[uint64]struct{})
+	for _, id := range updated.GetDisabledRules() {
+		newRules[id] = struct{}{}
+	}
+
+	d.AddedDisabledRules, d.RemovedDisabledRules, _ = diffKeyed(oldRules, newRules,
+		func(a, b struct{}) bool { return true })
+
+	return d
+}
+
+// diffKeyed returns the sorted keys added to, removed from and changed between two maps.
+func diffKeyed[K string | uint64, V any](old, updated map[K]V, equal func(a, b V) bool) (added, removed, changed []K) {
+	for k, v := range updated {
+		prev, ok := old[k]
+		if !ok {
+			added = append(added, k)
+		} else if !equal(prev, v) {
+			changed = append(changed, k)
+		}
+	}
+
+	for k := range old {
+		if _, ok := updated[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(changed)
+
+	return added, removed, changed
+}
+
+// groupPipelines groups the pipelines of a configuration by their comma-separated data types.
+func groupPipelines(c *Config) map[string][]*Pipeline {
+	groups := make(map[string][]*Pipeline)
+	for _, p := range c.GetPipeline() {
+		key := strings.Join(p.GetDataTypes(), ",")
+		groups[key] = append(groups[key], p)
+	}
+	return groups
+}
+
+// indexTenants indexes the tenants of a configuration by ID.
+func indexTenants(c *Config) map[string]*Tenant {
+	tenants := make(map[string]*Tenant)
+	for _, t := range c.GetTenants() {
+		tenants[t.GetId()] = t
+	}
+	return tenants
+}
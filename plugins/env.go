@@ -89,40 +89,98 @@ func getEnvStrSlice(name, def string, required bool) ([]string, error) {
 	return items, nil
 }
 
-// getEnv initializes and returns an Env struct with values retrieved from environment variables.
+// getEnvMap retrieves an environment variable as a map of strings.
+// The environment variable is expected to be a comma-separated list of key=value pairs,
+// e.g. "env=prod,team=sec". Keys and values are trimmed, values can be empty and empty entries are ignored.
+// If the environment variable is not set, the default value is used.
+// If the environment variable is required and not set, or an entry has no key or no '=', an error is returned.
+//
+// Parameters:
+//   - name: The name of the environment variable.
+//   - def: The default value to use if the environment variable is unset.
+//   - required: A boolean indicating if the environment variable is required.
+//
+// Returns:
+//   - map[string]string: The key=value pairs obtained from the environment variable.
+//   - error: An error object if the environment variable is required but not set, or if an entry is malformed.
+func getEnvMap(name, def string, required bool) (map[string]string, error) {
+	str, err := getEnvStr(name, def, required)
+	if err != nil {
+		return nil, err
+	}
+
+	var items = make(map[string]string)
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, catcher.Error("invalid environment variable", nil, map[string]any{
+				"name":  name,
+				"entry": item,
+				"cause": "entries must be key=value pairs",
+			})
+		}
+
+		items[key] = strings.TrimSpace(value)
+	}
+
+	return items, nil
+}
+
+// LoadEnv initializes and returns an Env struct with values retrieved from environment variables.
 // It retrieves the following environment variables:
-// - NODE_NAME: The name of the node (string).
+// - NODE_NAME: The name of the node (string), defaults to the hostname.
 // - NODE_GROUPS: A comma-separated list of node groups (slice of strings).
-// - WORK_DIR: The working directory (string).
 // - LOG_LEVEL: The logging level (integer).
-// If any required environment variable is missing or invalid, the function will panic with an error message.
-func getEnv() *Env {
+// - MODE: The mode of the node (string, required).
+// Every variable is validated before returning, so all missing or invalid variables are reported
+// together in a single error listing them instead of one at a time.
+func LoadEnv() (*Env, error) {
 	var env = new(Env)
+	var errs = make([]*catcher.SdkError, 0)
 	var err error
 
-	env.NodeName, err = getEnvStr("NODE_NAME", "", false)
-	if err != nil {
-		panic(err)
+	collect := func(err error) {
+		if err != nil {
+			errs = append(errs, catcher.ToSdkError(err))
+		}
 	}
 
+	env.NodeName, err = getEnvStr("NODE_NAME", "", false)
+	collect(err)
+
 	if env.NodeName == "" {
 		env.NodeName, err = os.Hostname()
 		if err != nil {
-			panic(err)
+			collect(catcher.Error("cannot get hostname", err, nil))
 		}
 	}
 
 	env.NodeGroups, err = getEnvStrSlice("NODE_GROUPS", "default", false)
-	if err != nil {
-		panic(err)
-	}
+	collect(err)
 
 	env.LogLevel, err = getEnvUInt32("LOG_LEVEL", "200", false)
-	if err != nil {
-		panic(err)
-	}
+	collect(err)
 
 	env.Mode, err = getEnvStr("MODE", "", true)
+	collect(err)
+
+	if len(errs) > 0 {
+		return nil, catcher.Error("invalid environment configuration", nil, map[string]any{"errors": errs})
+	}
+
+	return env, nil
+}
+
+// getEnv returns the Env loaded by LoadEnv.
+// If any required environment variable is missing or invalid, the function will panic with an error listing all of them.
+func getEnv() *Env {
+	env, err := LoadEnv()
 	if err != nil {
 		panic(err)
 	}
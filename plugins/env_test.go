@@ -0,0 +1,76 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threatwinds/go-sdk/catcher"
+)
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("NODE_NAME", "node-1")
+	t.Setenv("NODE_GROUPS", "a, b")
+	t.Setenv("LOG_LEVEL", "100")
+	t.Setenv("MODE", "worker")
+
+	env, err := LoadEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "node-1", env.NodeName)
+	assert.Equal(t, []string{"a", "b"}, env.NodeGroups)
+	assert.Equal(t, uint32(100), env.LogLevel)
+	assert.Equal(t, "worker", env.Mode)
+}
+
+func TestLoadEnvAggregatesErrors(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "verbose")
+	t.Setenv("MODE", "")
+
+	env, err := LoadEnv()
+	require.Error(t, err)
+	assert.Nil(t, env)
+
+	errs, ok := catcher.ToSdkError(err).Args["errors"].([]*catcher.SdkError)
+	require.True(t, ok)
+	require.Len(t, errs, 2)
+	assert.Equal(t, "invalid environment variable", errs[0].Msg)
+	assert.Equal(t, "missing required environment variable", errs[1].Msg)
+
+	assert.Panics(t, func() { getEnv() })
+}
+
+func TestGetEnvMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"pairs", "env=prod,team=sec", map[string]string{"env": "prod", "team": "sec"}, false},
+		{"whitespace", " env = prod , team=sec ,", map[string]string{"env": "prod", "team": "sec"}, false},
+		{"empty value", "env=,team=sec", map[string]string{"env": "", "team": "sec"}, false},
+		{"value with equals", "query=a=b", map[string]string{"query": "a=b"}, false},
+		{"default", "", map[string]string{"env": "dev"}, false},
+		{"missing equals", "env=prod,team", nil, true},
+		{"missing key", "=prod", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LABELS", tt.value)
+
+			got, err := getEnvMap("LABELS", "env=dev", false)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Setenv("LABELS", "")
+	_, err := getEnvMap("LABELS", "", true)
+	assert.Error(t, err)
+}
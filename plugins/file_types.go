@@ -0,0 +1,51 @@
+package plugins
+
+import "strings"
+
+// fileCategories maps lowercase file extensions to the coarse category returned by file_category.
+var fileCategories = map[string]string{
+	// Executables, libraries and installers
+	"exe": "executable", "dll": "executable", "scr": "executable", "com": "executable", "cpl": "executable",
+	"sys": "executable", "msi": "executable", "msp": "executable", "elf": "executable", "so": "executable",
+	"dylib": "executable", "bin": "executable", "apk": "executable", "app": "executable", "deb": "executable",
+	"rpm": "executable", "jar": "executable", "pif": "executable", "ocx": "executable",
+
+	// Scripts and shortcuts interpreted by the system
+	"ps1": "script", "psm1": "script", "psd1": "script", "bat": "script", "cmd": "script", "vbs": "script",
+	"vbe": "script", "js": "script", "jse": "script", "wsf": "script", "wsh": "script", "hta": "script",
+	"sh": "script", "bash": "script", "zsh": "script", "py": "script", "pl": "script", "rb": "script",
+	"php": "script", "lnk": "script", "reg": "script", "applescript": "script",
+
+	// Documents, including the formats able to carry macros
+	"pdf": "document", "doc": "document", "docx": "document", "docm": "document", "dot": "document",
+	"dotm": "document", "xls": "document", "xlsx": "document", "xlsm": "document", "xlsb": "document",
+	"ppt": "document", "pptx": "document", "pptm": "document", "rtf": "document", "odt": "document",
+	"ods": "document", "odp": "document", "txt": "document", "csv": "document", "one": "document",
+
+	// Archives and disk images
+	"zip": "archive", "rar": "archive", "7z": "archive", "tar": "archive", "gz": "archive", "tgz": "archive",
+	"bz2": "archive", "xz": "archive", "zst": "archive", "cab": "archive", "iso": "archive", "img": "archive",
+	"vhd": "archive", "vhdx": "archive", "dmg": "archive", "arj": "archive", "lzh": "archive",
+}
+
+// fileExtension returns the lowercase extension, without the dot, of the last element of a Unix or Windows
+// path. Hidden files without another dot, e.g. ".bashrc", have no extension.
+func fileExtension(path string) string {
+	name := path[strings.LastIndexAny(path, `/\`)+1:]
+
+	dot := strings.LastIndexByte(name, '.')
+	if dot <= 0 {
+		return ""
+	}
+
+	return strings.ToLower(name[dot+1:])
+}
+
+// fileCategory returns the category of a file extension: executable, script, document, archive or other.
+func fileCategory(ext string) string {
+	if category, ok := fileCategories[ext]; ok {
+		return category
+	}
+
+	return "other"
+}
@@ -0,0 +1,40 @@
+package plugins
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrCfgNotLoaded is returned by CfgHealth until the first configuration load completes.
+var ErrCfgNotLoaded = errors.New("configuration not loaded yet")
+
+// cfgLoadResult is the outcome of a configuration load.
+type cfgLoadResult struct {
+	err error
+}
+
+// lastCfgLoad is the outcome of the last configuration load, nil until the first one completes.
+var lastCfgLoad atomic.Pointer[cfgLoadResult]
+
+// recordCfgLoad records the outcome of a configuration load, nil if the configuration was applied.
+func recordCfgLoad(err error) {
+	lastCfgLoad.Store(&cfgLoadResult{err: err})
+}
+
+// CfgHealth reports whether the last configuration load was applied, to be used by readiness checks. It
+// returns ErrCfgNotLoaded while no configuration was loaded yet, and the error logged when the last load was
+// rejected because it failed Validate or fewer files than CfgLimits.MinFiles contributed to it, e.g. after a
+// configuration mount failure. The previous configuration, if any, remains in use meanwhile, and the error
+// clears on the first reload that is applied.
+//
+// Returns:
+//
+//	error: The reason why the last configuration load was not applied, or nil if it was.
+func CfgHealth() error {
+	result := lastCfgLoad.Load()
+	if result == nil {
+		return ErrCfgNotLoaded
+	}
+
+	return result.err
+}
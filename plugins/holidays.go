@@ -0,0 +1,62 @@
+package plugins
+
+import (
+	"sync"
+	"time"
+
+	"github.com/threatwinds/go-sdk/catcher"
+)
+
+// holidayDateLayout is the layout of the dates registered with RegisterHolidays.
+const holidayDateLayout = time.DateOnly
+
+var holidayLists = make(map[string]map[string]struct{})
+var holidayListsMutex sync.RWMutex
+
+// RegisterHolidays registers a named list of holiday dates matched with the is_holiday CEL function, replacing
+// any previous list with the same name. Dates use the YYYY-MM-DD layout, e.g. "2024-12-25". Invalid dates
+// are skipped with a warning, so a typo does not discard the rest of the list.
+//
+// Parameters:
+//
+//	name: The name of the list, as used in is_holiday(field, name).
+//	dates: The holiday dates.
+func RegisterHolidays(name string, dates []string) {
+	list := make(map[string]struct{}, len(dates))
+
+	for _, date := range dates {
+		day, err := time.Parse(holidayDateLayout, date)
+		if err != nil {
+			catcher.Info("invalid holiday date, skipping it", map[string]any{
+				"list":   name,
+				"date":   date,
+				"cause":  err.Error(),
+				"status": 400,
+			})
+			continue
+		}
+
+		list[day.Format(holidayDateLayout)] = struct{}{}
+	}
+
+	holidayListsMutex.Lock()
+	defer holidayListsMutex.Unlock()
+
+	holidayLists[name] = list
+}
+
+// isHolidayDate reports whether the date of the timestamp is in the named list. The second result is false
+// when the list was never registered.
+func isHolidayDate(name string, ts time.Time) (bool, bool) {
+	holidayListsMutex.RLock()
+	defer holidayListsMutex.RUnlock()
+
+	list, ok := holidayLists[name]
+	if !ok {
+		return false, false
+	}
+
+	_, holiday := list[ts.Format(holidayDateLayout)]
+
+	return holiday, true
+}
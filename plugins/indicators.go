@@ -0,0 +1,186 @@
+package plugins
+
+import (
+	"bufio"
+	"hash/fnv"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/threatwinds/go-sdk/catcher"
+)
+
+// indicatorSet is a named set of indicators (hashes, domains, etc.) matched with the indicator CEL function.
+type indicatorSet interface {
+	contains(value string) bool
+}
+
+// exactIndicatorSet is an indicatorSet without false positives.
+type exactIndicatorSet map[string]struct{}
+
+// contains reports whether the value is in the set.
+func (s exactIndicatorSet) contains(value string) bool {
+	_, ok := s[value]
+	return ok
+}
+
+// bloomIndicatorSet is an indicatorSet backed by a Bloom filter, using a fraction of the memory of an
+// exactIndicatorSet at the cost of a bounded false positive rate. It never reports a false negative.
+type bloomIndicatorSet struct {
+	bits   []uint64
+	hashes uint64
+}
+
+// newBloomIndicatorSet sizes a Bloom filter for the given number of entries and false positive rate.
+func newBloomIndicatorSet(entries int, falsePositiveRate float64) *bloomIndicatorSet {
+	n := float64(max(entries, 1))
+	m := math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/n*math.Ln2))
+
+	return &bloomIndicatorSet{
+		bits:   make([]uint64, (uint64(m)+63)/64),
+		hashes: uint64(k),
+	}
+}
+
+// locations returns the two hashes of the value, combined to derive the bits of every hash function.
+func (s *bloomIndicatorSet) locations(value string) (uint64, uint64) {
+	a := fnv.New64a()
+	_, _ = a.Write([]byte(value))
+
+	b := fnv.New64()
+	_, _ = b.Write([]byte(value))
+
+	return a.Sum64(), b.Sum64() | 1
+}
+
+// add inserts the value in the filter.
+func (s *bloomIndicatorSet) add(value string) {
+	h1, h2 := s.locations(value)
+	size := uint64(len(s.bits)) * 64
+
+	for i := uint64(0); i < s.hashes; i++ {
+		bit := (h1 + i*h2) % size
+		s.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// contains reports whether the value is probably in the set.
+func (s *bloomIndicatorSet) contains(value string) bool {
+	h1, h2 := s.locations(value)
+	size := uint64(len(s.bits)) * 64
+
+	for i := uint64(0); i < s.hashes; i++ {
+		bit := (h1 + i*h2) % size
+		if s.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+var indicatorSets = make(map[string]indicatorSet)
+var indicatorSetsMutex sync.RWMutex
+
+// LoadIndicatorSet loads a named set of indicators to be matched with the indicator CEL function from a file
+// with one entry per line. Entries are trimmed and matched exactly, empty lines and lines starting with '#'
+// are ignored. The set is built before taking the registry lock and then swapped in, so reloading a feed
+// does not block the evaluation of rules using the previous one.
+//
+// Parameters:
+//
+//	name: The name of the set, as used in indicator(name, field).
+//	file: The path of the file containing the indicators.
+//
+// Returns:
+//
+//	error: An error if the file cannot be read, in which case the previous set is kept.
+func LoadIndicatorSet(name, file string) error {
+	set := make(exactIndicatorSet)
+
+	err := readIndicators(file, func(entry string) { set[entry] = struct{}{} })
+	if err != nil {
+		return catcher.Error("cannot load indicator set", err, map[string]any{"set": name, "file": file})
+	}
+
+	storeIndicatorSet(name, set)
+
+	return nil
+}
+
+// LoadIndicatorBloomFilter behaves like LoadIndicatorSet but stores the indicators in a Bloom filter, for feeds
+// with millions of entries that would not fit in memory as an exact set. Lookups of indicators in the feed
+// always match, while other values match with a probability close to falsePositiveRate, e.g. 0.001 uses
+// about 1.8 bytes per entry and 0.0001 about 2.4 bytes per entry.
+//
+// Parameters:
+//
+//	name: The name of the set, as used in indicator(name, field).
+//	file: The path of the file containing the indicators.
+//	falsePositiveRate: The expected rate of false positives, between 0 and 1 exclusive.
+//
+// Returns:
+//
+//	error: An error if the rate is out of range or the file cannot be read, in which case the previous set is kept.
+func LoadIndicatorBloomFilter(name, file string, falsePositiveRate float64) error {
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return catcher.Error("invalid false positive rate", nil, map[string]any{"set": name, "rate": falsePositiveRate})
+	}
+
+	var entries int
+	err := readIndicators(file, func(string) { entries++ })
+	if err != nil {
+		return catcher.Error("cannot load indicator set", err, map[string]any{"set": name, "file": file})
+	}
+
+	set := newBloomIndicatorSet(entries, falsePositiveRate)
+
+	err = readIndicators(file, set.add)
+	if err != nil {
+		return catcher.Error("cannot load indicator set", err, map[string]any{"set": name, "file": file})
+	}
+
+	storeIndicatorSet(name, set)
+
+	return nil
+}
+
+// readIndicators calls fn with every indicator of the file.
+func readIndicators(file string, fn func(entry string)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		fn(entry)
+	}
+
+	return scanner.Err()
+}
+
+// storeIndicatorSet registers the set under the given name, replacing any previous one.
+func storeIndicatorSet(name string, set indicatorSet) {
+	indicatorSetsMutex.Lock()
+	defer indicatorSetsMutex.Unlock()
+
+	indicatorSets[name] = set
+}
+
+// getIndicatorSet returns the named set, or nil if it was never loaded.
+func getIndicatorSet(name string) indicatorSet {
+	indicatorSetsMutex.RLock()
+	defer indicatorSetsMutex.RUnlock()
+
+	return indicatorSets[name]
+}
@@ -0,0 +1,125 @@
+package plugins
+
+import (
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/threatwinds/go-sdk/catcher"
+)
+
+// ipScores holds the reputation scores of IP addresses and CIDRs in a binary trie per address family.
+// Addresses are stored as full-length prefixes, so a lookup returns the score of the most specific match.
+type ipScores struct {
+	ipv4 *scoreNode
+	ipv6 *scoreNode
+}
+
+// scoreNode is a node of a binary trie of scored CIDRs, terminal nodes hold the score of a declared prefix.
+type scoreNode struct {
+	children [2]*scoreNode
+	terminal bool
+	score    int
+}
+
+// currentIPScores is the reputation feed used by the ip_score CEL function, replaced on every RegisterIPScores.
+var currentIPScores atomic.Pointer[ipScores]
+
+// RegisterIPScores replaces the reputation scores used by the ip_score CEL function. The scores are indexed
+// by IP address (e.g. "203.0.113.7") or CIDR (e.g. "198.51.100.0/24"), and a lookup returns the score of the
+// most specific entry containing the address. The new feed is built before being swapped in atomically, so
+// evaluations in progress keep using the previous one.
+//
+// Parameters:
+//
+//	m: The scores, usually between 0 and 100, indexed by IP address or CIDR.
+//
+// Returns:
+//
+//	error: An error if any key is not a valid IP address or CIDR, in which case the previous scores are kept.
+func RegisterIPScores(m map[string]int) error {
+	scores := &ipScores{ipv4: &scoreNode{}, ipv6: &scoreNode{}}
+
+	for entry, score := range m {
+		var prefix netip.Prefix
+		var err error
+
+		if strings.Contains(entry, "/") {
+			prefix, err = netip.ParsePrefix(entry)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(entry)
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		if err != nil {
+			return catcher.Error("invalid entry in IP scores", err, map[string]any{"entry": entry})
+		}
+
+		scores.insert(prefix.Masked(), score)
+	}
+
+	currentIPScores.Store(scores)
+
+	return nil
+}
+
+// insert sets the score of a CIDR in the trie of its address family.
+func (s *ipScores) insert(prefix netip.Prefix, score int) {
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+
+	node := s.ipv6
+	if prefix.Addr().Is4() {
+		node = s.ipv4
+	}
+
+	bytes := prefix.Addr().AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := bytes[i/8] >> (7 - i%8) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &scoreNode{}
+		}
+		node = node.children[bit]
+	}
+
+	node.terminal = true
+	node.score = score
+}
+
+// lookup returns the score of the most specific entry containing ip.
+func (s *ipScores) lookup(ip string) (int, bool) {
+	if s == nil {
+		return 0, false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return 0, false
+	}
+
+	addr = addr.Unmap()
+
+	node := s.ipv6
+	if addr.Is4() {
+		node = s.ipv4
+	}
+
+	score, found := 0, false
+
+	bytes := addr.AsSlice()
+	for i := 0; node != nil; i++ {
+		if node.terminal {
+			score, found = node.score, true
+		}
+
+		if i == len(bytes)*8 {
+			break
+		}
+
+		node = node.children[bytes[i/8]>>(7-i%8)&1]
+	}
+
+	return score, found
+}
@@ -0,0 +1,145 @@
+package plugins
+
+import (
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/threatwinds/go-sdk/catcher"
+)
+
+// ipSet is a set of IP addresses and CIDRs. Single addresses are kept in a map and CIDRs in a binary
+// trie per address family, so lookups cost at most one map access plus a walk of the address bits.
+type ipSet struct {
+	ips  map[netip.Addr]struct{}
+	ipv4 *cidrNode
+	ipv6 *cidrNode
+}
+
+// cidrNode is a node of a binary trie of CIDRs, terminal nodes mark the end of a declared prefix.
+type cidrNode struct {
+	children [2]*cidrNode
+	terminal bool
+}
+
+var ipSets = make(map[string]*ipSet)
+var ipSetsMutex sync.RWMutex
+
+// LoadIPSet builds a named set of IP addresses and CIDRs to be matched with the blocklist CEL function.
+// The set is built before taking the registry lock and then swapped in, so loading or replacing a set
+// does not block the evaluation of rules using the previous one.
+//
+// Parameters:
+//
+//	name: The name of the set, as used in blocklist(name, ip_field).
+//	ips: The IP addresses (e.g. "10.0.0.1") and CIDRs (e.g. "10.0.0.0/8") of the set.
+//
+// Returns:
+//
+//	error: An error if any entry is not a valid IP address or CIDR, in which case the previous set is kept.
+func LoadIPSet(name string, ips []string) error {
+	set := &ipSet{
+		ips:  make(map[netip.Addr]struct{}),
+		ipv4: &cidrNode{},
+		ipv6: &cidrNode{},
+	}
+
+	for _, entry := range ips {
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return catcher.Error("invalid CIDR in IP set", err, map[string]any{"set": name, "entry": entry})
+			}
+
+			set.insertPrefix(prefix)
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return catcher.Error("invalid IP in IP set", err, map[string]any{"set": name, "entry": entry})
+		}
+
+		set.ips[addr.Unmap()] = struct{}{}
+	}
+
+	ipSetsMutex.Lock()
+	defer ipSetsMutex.Unlock()
+
+	ipSets[name] = set
+
+	return nil
+}
+
+// getIPSet returns the named set, or nil if it was never loaded.
+func getIPSet(name string) *ipSet {
+	ipSetsMutex.RLock()
+	defer ipSetsMutex.RUnlock()
+
+	return ipSets[name]
+}
+
+// insertPrefix adds a CIDR to the trie of its address family.
+func (s *ipSet) insertPrefix(prefix netip.Prefix) {
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+
+	node := s.ipv6
+	if prefix.Addr().Is4() {
+		node = s.ipv4
+	}
+
+	bytes := prefix.Addr().AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		if node.terminal {
+			return
+		}
+
+		bit := bytes[i/8] >> (7 - i%8) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &cidrNode{}
+		}
+		node = node.children[bit]
+	}
+
+	node.terminal = true
+}
+
+// contains reports whether ip is one of the addresses of the set or belongs to one of its CIDRs.
+func (s *ipSet) contains(ip string) bool {
+	if s == nil {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	if _, ok := s.ips[addr]; ok {
+		return true
+	}
+
+	node := s.ipv6
+	if addr.Is4() {
+		node = s.ipv4
+	}
+
+	bytes := addr.AsSlice()
+	for i := 0; node != nil; i++ {
+		if node.terminal {
+			return true
+		}
+
+		if i == len(bytes)*8 {
+			return false
+		}
+
+		node = node.children[bytes[i/8]>>(7-i%8)&1]
+	}
+
+	return false
+}
@@ -0,0 +1,73 @@
+package plugins
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CfgLimits bounds the pipeline files read on every configuration load, guarding against a configuration
+// directory bloated by accident or on purpose. Files beyond the limits are skipped with a warning.
+// MinFiles guards against the opposite, e.g. an empty or partial mount of the configuration directory.
+// A zero field disables the corresponding limit.
+type CfgLimits struct {
+	// MinFiles is the minimum number of pipeline files that must contribute to a configuration for it to be
+	// applied. Otherwise, the previous configuration is kept and CfgHealth reports the failure.
+	MinFiles int
+	// MaxFiles is the maximum number of pipeline files loaded.
+	MaxFiles int
+	// MaxTotalBytes is the maximum combined size, in bytes, of the pipeline files loaded.
+	MaxTotalBytes int64
+	// MaxFileBytes is the maximum size, in bytes, of a single pipeline file.
+	MaxFileBytes int64
+}
+
+// DefaultCfgLimits are the limits applied until SetCfgLimits is called.
+var DefaultCfgLimits = CfgLimits{
+	MaxFiles:      1000,
+	MaxTotalBytes: 256 << 20,
+	MaxFileBytes:  16 << 20,
+}
+
+var cfgLimits = DefaultCfgLimits
+var cfgLimitsMutex sync.RWMutex
+
+// SetCfgLimits replaces the limits applied to the pipeline files from the next configuration load on.
+func SetCfgLimits(limits CfgLimits) {
+	cfgLimitsMutex.Lock()
+	defer cfgLimitsMutex.Unlock()
+
+	cfgLimits = limits
+}
+
+// getCfgLimits returns the limits applied to the pipeline files.
+func getCfgLimits() CfgLimits {
+	cfgLimitsMutex.RLock()
+	defer cfgLimitsMutex.RUnlock()
+
+	return cfgLimits
+}
+
+// exceeds returns the reason why a file of the given size cannot be loaded after the given number of files
+// and bytes, or an empty string if it is within the limits.
+func (l CfgLimits) exceeds(files int, totalBytes, size int64) string {
+	switch {
+	case l.MaxFileBytes > 0 && size > l.MaxFileBytes:
+		return "file size limit exceeded"
+	case l.MaxFiles > 0 && files >= l.MaxFiles:
+		return "file count limit exceeded"
+	case l.MaxTotalBytes > 0 && totalBytes+size > l.MaxTotalBytes:
+		return "total size limit exceeded"
+	default:
+		return ""
+	}
+}
+
+// checkMinFiles returns an error if fewer files than MinFiles contributed to a configuration. The error is not
+// logged, the caller reporting the rejected configuration.
+func (l CfgLimits) checkMinFiles(sourceFiles []string) error {
+	if len(sourceFiles) >= l.MinFiles {
+		return nil
+	}
+
+	return fmt.Errorf("too few configuration files loaded: %d of at least %d", len(sourceFiles), l.MinFiles)
+}
@@ -0,0 +1,69 @@
+package plugins
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+// LookupFunc resolves the value of a key of a lookup table backed by I/O, e.g. a DNS or database query.
+// It returns false when the key has no value, and must honour the context, which carries the deadline
+// and cancellation of the evaluation.
+type LookupFunc func(ctx context.Context, key string) (string, bool, error)
+
+var lookupTables = make(map[string]map[string]string)
+var lookupFuncs = make(map[string]LookupFunc)
+var lookupTablesMutex sync.RWMutex
+
+// RegisterLookup registers a named enrichment table used by the lookup CEL function, replacing any
+// table previously registered with the same name. The table is copied, so later changes to m do not
+// affect the rules, and the swap only holds the registry lock for an instant.
+//
+// Parameters:
+//
+//	name: The name of the table, as used in lookup(name, key_field, default).
+//	m: The values of the table, indexed by key.
+func RegisterLookup(name string, m map[string]string) {
+	table := maps.Clone(m)
+
+	lookupTablesMutex.Lock()
+	defer lookupTablesMutex.Unlock()
+
+	delete(lookupFuncs, name)
+	lookupTables[name] = table
+}
+
+// RegisterLookupFunc registers a named enrichment table whose values are resolved by fn when the lookup
+// CEL function is evaluated, replacing any table previously registered with the same name. fn receives
+// the context of EvaluateContext, or a background context when evaluating with Evaluate.
+//
+// Parameters:
+//
+//	name: The name of the table, as used in lookup(name, key_field, default).
+//	fn: The function resolving the values of the table.
+func RegisterLookupFunc(name string, fn LookupFunc) {
+	lookupTablesMutex.Lock()
+	defer lookupTablesMutex.Unlock()
+
+	delete(lookupTables, name)
+	lookupFuncs[name] = fn
+}
+
+// lookupValue returns the value of key in the named table.
+func lookupValue(ctx context.Context, name, key string) (string, bool, error) {
+	lookupTablesMutex.RLock()
+	table := lookupTables[name]
+	fn := lookupFuncs[name]
+	lookupTablesMutex.RUnlock()
+
+	if fn != nil {
+		if err := ctx.Err(); err != nil {
+			return "", false, err
+		}
+
+		return fn(ctx, key)
+	}
+
+	value, ok := table[key]
+	return value, ok, nil
+}
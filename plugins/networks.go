@@ -0,0 +1,124 @@
+package plugins
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/threatwinds/go-sdk/catcher"
+)
+
+// networkListIndex holds the parsed network lists of a configuration.
+type networkListIndex struct {
+	cfg   *Config
+	lists map[string][]*net.IPNet
+}
+
+// currentNetworkLists is the index of the network lists of the current configuration, rebuilt on every reload.
+var currentNetworkLists atomic.Pointer[networkListIndex]
+
+// newNetworkListIndex parses the network lists of the configuration. Invalid entries are logged and ignored.
+func newNetworkListIndex(c *Config) *networkListIndex {
+	index := &networkListIndex{cfg: c, lists: make(map[string][]*net.IPNet, len(c.NetworkLists))}
+
+	for name, list := range c.NetworkLists {
+		networks, invalid := parseNetworks(list.GetCidrs())
+		for _, entry := range invalid {
+			_ = catcher.Error("invalid entry in network list", nil, map[string]any{"list": name, "entry": entry})
+		}
+		index.lists[name] = networks
+	}
+
+	return index
+}
+
+// parseNetworks parses a list of CIDRs and single IP addresses, returning the networks and the invalid entries.
+func parseNetworks(entries []string) ([]*net.IPNet, []string) {
+	var networks []*net.IPNet
+	var invalid []string
+
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				invalid = append(invalid, entry)
+				continue
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			invalid = append(invalid, entry)
+			continue
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, invalid
+}
+
+// NetworkList returns the networks of the named list of the networkLists section of the configuration.
+// Entries can be CIDRs (e.g. "10.0.0.0/8") or single IP addresses, invalid entries are ignored.
+// The lists of the global configuration are parsed once per reload, other configurations are parsed
+// on every call.
+//
+// Example configuration:
+//
+//	networkLists:
+//	  trusted:
+//	    cidrs:
+//	      - 10.0.0.0/8
+//	      - 192.168.1.10
+//
+// Parameters:
+//
+//	name: The name of the network list.
+//
+// Returns:
+//
+//	[]*net.IPNet: The networks of the list.
+//	bool: Whether the list exists in the configuration.
+func (c *Config) NetworkList(name string) ([]*net.IPNet, bool) {
+	if index := currentNetworkLists.Load(); index != nil && index.cfg == c {
+		networks, ok := index.lists[name]
+		return networks, ok
+	}
+
+	list, ok := c.GetNetworkLists()[name]
+	if !ok {
+		return nil, false
+	}
+
+	networks, _ := parseNetworks(list.GetCidrs())
+
+	return networks, true
+}
+
+// contains reports whether ip belongs to any network of the named list.
+func (i *networkListIndex) contains(name, ip string) bool {
+	if i == nil {
+		return false
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, network := range i.lists[name] {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,122 @@
+package plugins
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/threatwinds/go-sdk/catcher"
+)
+
+// ouiDB maps the OUIs, normalized by formatOUI, to the names of their vendors.
+type ouiDB map[string]string
+
+// currentOUIDB is the database used by the mac_vendor CEL function, replaced on every LoadOUIDB.
+var currentOUIDB atomic.Pointer[ouiDB]
+
+// LoadOUIDB replaces the OUI database used by the mac_vendor CEL function. Every line of the file starts with
+// an OUI, as 6 hexadecimal digits optionally separated by '-' or ':', followed by the name of the vendor,
+// separated by whitespace or a comma, e.g. "00-1C-B3   (hex)		Apple, Inc." as in the IEEE oui.txt file or
+// "001CB3,Apple, Inc.". The "(hex)" and "(base 16)" markers of oui.txt are ignored, and so are the lines not
+// starting with an OUI, such as comments and vendor addresses. The database is built before being swapped in
+// atomically, so evaluations in progress keep using the previous one.
+//
+// Parameters:
+//
+//	path: The path of the OUI database file.
+//
+// Returns:
+//
+//	error: An error if the file cannot be read, in which case the previous database is kept.
+func LoadOUIDB(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return catcher.Error("cannot load OUI database", err, map[string]any{"file": path})
+	}
+
+	defer func() { _ = f.Close() }()
+
+	db := make(ouiDB)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		oui, vendor, ok := parseOUILine(scanner.Text())
+		if ok {
+			db[oui] = vendor
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return catcher.Error("cannot load OUI database", err, map[string]any{"file": path})
+	}
+
+	currentOUIDB.Store(&db)
+
+	return nil
+}
+
+// parseOUILine returns the normalized OUI and the vendor of a line of an OUI database, see LoadOUIDB.
+func parseOUILine(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+
+	end := strings.IndexAny(line, " \t,")
+	if end < 0 {
+		return "", "", false
+	}
+
+	prefix, err := hex.DecodeString(strings.NewReplacer("-", "", ":", "").Replace(line[:end]))
+	if err != nil || len(prefix) != 3 {
+		return "", "", false
+	}
+
+	vendor := strings.TrimLeft(line[end:], " \t,")
+	for _, marker := range []string{"(hex)", "(base 16)"} {
+		vendor = strings.TrimSpace(strings.TrimPrefix(vendor, marker))
+	}
+
+	if vendor == "" {
+		return "", "", false
+	}
+
+	return formatOUI(prefix), vendor, true
+}
+
+// macOUIOf returns the normalized OUI of a MAC address in any of the formats accepted by net.ParseMAC, or as
+// 12 hexadecimal digits without separators. It returns false for invalid addresses and for addresses other
+// than EUI-48 and EUI-64.
+func macOUIOf(mac string) (string, bool) {
+	addr, err := net.ParseMAC(mac)
+	if err != nil {
+		addr, err = hex.DecodeString(mac)
+		if err != nil || len(addr) != 6 {
+			return "", false
+		}
+	}
+
+	if len(addr) != 6 && len(addr) != 8 {
+		return "", false
+	}
+
+	return formatOUI(addr[:3]), true
+}
+
+// formatOUI formats the first 3 bytes of an address as uppercase hexadecimal separated by ':', e.g. "00:1C:B3".
+func formatOUI(b []byte) string {
+	return strings.ToUpper(net.HardwareAddr(b[:3]).String())
+}
+
+// lookupVendor returns the vendor of an OUI in the loaded database, or false if it is unknown or no
+// database was loaded.
+func lookupVendor(oui string) (string, bool) {
+	db := currentOUIDB.Load()
+	if db == nil {
+		return "", false
+	}
+
+	vendor, ok := (*db)[oui]
+
+	return vendor, ok
+}
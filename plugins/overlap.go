@@ -0,0 +1,185 @@
+package plugins
+
+import "unicode/utf8"
+
+// maxOverlapIndexed and maxOverlapScanned bound the work of the overlap CEL functions: only the first
+// characters of the shorter string are indexed in a suffix automaton, and only the first characters of the
+// longer string are run through it. Memory is proportional to the indexed characters and time to both.
+const (
+	maxOverlapIndexed = 64 << 10
+	maxOverlapScanned = 1 << 20
+)
+
+// suffixAutomaton is the suffix automaton of a string, recognizing all of its substrings. Transitions are
+// kept in a single slice of edges linked per state, so the automaton of n characters takes at most 2n states
+// and 3n edges without allocating a map per state.
+type suffixAutomaton struct {
+	states []suffixState
+	edges  []suffixEdge
+}
+
+// suffixState is a state of a suffixAutomaton, edges being the index of its first edge or -1.
+type suffixState struct {
+	length int32
+	link   int32
+	edges  int32
+}
+
+// suffixEdge is a transition of a suffixAutomaton, next being the index of the following edge of the same
+// state or -1.
+type suffixEdge struct {
+	char   rune
+	target int32
+	next   int32
+}
+
+// newSuffixAutomaton builds the suffix automaton of the first limit characters of str.
+func newSuffixAutomaton(str string, limit int) *suffixAutomaton {
+	n := min(utf8.RuneCountInString(str), limit)
+
+	a := &suffixAutomaton{
+		states: make([]suffixState, 1, 2*n+1),
+		edges:  make([]suffixEdge, 0, 3*n),
+	}
+	a.states[0] = suffixState{link: -1, edges: -1}
+
+	var last int32
+	for _, c := range str {
+		if n == 0 {
+			break
+		}
+		n--
+
+		cur := a.addState(a.states[last].length+1, -1)
+
+		p := last
+		for p != -1 {
+			if _, ok := a.next(p, c); ok {
+				break
+			}
+
+			a.set(p, c, cur)
+			p = a.states[p].link
+		}
+
+		if p == -1 {
+			a.states[cur].link = 0
+			last = cur
+			continue
+		}
+
+		q, _ := a.next(p, c)
+		if a.states[q].length == a.states[p].length+1 {
+			a.states[cur].link = q
+			last = cur
+			continue
+		}
+
+		clone := a.addState(a.states[p].length+1, a.states[q].link)
+		for e := a.states[q].edges; e != -1; e = a.edges[e].next {
+			a.set(clone, a.edges[e].char, a.edges[e].target)
+		}
+
+		for p != -1 {
+			if target, _ := a.next(p, c); target != q {
+				break
+			}
+
+			a.set(p, c, clone)
+			p = a.states[p].link
+		}
+
+		a.states[q].link = clone
+		a.states[cur].link = clone
+		last = cur
+	}
+
+	return a
+}
+
+// addState appends a state without transitions and returns its index.
+func (a *suffixAutomaton) addState(length, link int32) int32 {
+	a.states = append(a.states, suffixState{length: length, link: link, edges: -1})
+	return int32(len(a.states) - 1)
+}
+
+// next returns the target of the transition of the state on the character, if any.
+func (a *suffixAutomaton) next(state int32, c rune) (int32, bool) {
+	for e := a.states[state].edges; e != -1; e = a.edges[e].next {
+		if a.edges[e].char == c {
+			return a.edges[e].target, true
+		}
+	}
+
+	return 0, false
+}
+
+// set sets the target of the transition of the state on the character, adding it if needed.
+func (a *suffixAutomaton) set(state int32, c rune, target int32) {
+	for e := a.states[state].edges; e != -1; e = a.edges[e].next {
+		if a.edges[e].char == c {
+			a.edges[e].target = target
+			return
+		}
+	}
+
+	a.edges = append(a.edges, suffixEdge{char: c, target: target, next: a.states[state].edges})
+	a.states[state].edges = int32(len(a.edges) - 1)
+}
+
+// longestMatch returns the length, in characters, of the longest substring of the first limit characters
+// of str recognized by the automaton.
+func (a *suffixAutomaton) longestMatch(str string, limit int) int {
+	var longest, length int
+	var state int32
+
+	for _, c := range str {
+		if limit == 0 {
+			break
+		}
+		limit--
+
+		for state != 0 {
+			if _, ok := a.next(state, c); ok {
+				break
+			}
+
+			state = a.states[state].link
+			length = int(a.states[state].length)
+		}
+
+		if next, ok := a.next(state, c); ok {
+			state = next
+			length++
+		}
+
+		longest = max(longest, length)
+	}
+
+	return longest
+}
+
+// overlapOf returns the length, in characters, of the longest common substring of a and b, and the number
+// of characters of the shorter one that were compared. It indexes the shorter string in a suffix automaton
+// and runs the longer one through it, taking linear time, and compares at most maxOverlapIndexed
+// characters of the shorter string and maxOverlapScanned characters of the longer one.
+func overlapOf(a, b string) (int, int) {
+	lengthA, lengthB := utf8.RuneCountInString(a), utf8.RuneCountInString(b)
+	if lengthA > lengthB {
+		a, b = b, a
+		lengthA = lengthB
+	}
+
+	if lengthA == 0 {
+		return 0, 0
+	}
+
+	return newSuffixAutomaton(a, maxOverlapIndexed).longestMatch(b, maxOverlapScanned), min(lengthA, maxOverlapIndexed)
+}
+
+// longestCommonSubstring returns the length, in characters, of the longest common substring of a and b,
+// within the limits of overlapOf.
+func longestCommonSubstring(a, b string) int {
+	common, _ := overlapOf(a, b)
+	return common
+}
@@ -0,0 +1,145 @@
+package plugins
+
+import (
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"github.com/threatwinds/go-sdk/catcher"
+)
+
+// patternCache holds the regular expressions of the patterns of a configuration, compiled on first use.
+// Patterns are read from source, a copy owned by the cache, since cfg may be overwritten by a reload while
+// they are compiled; cfg only identifies the configuration the cache belongs to.
+type patternCache struct {
+	cfg      *Config
+	source   *Config
+	mutex    sync.RWMutex
+	compiled map[patternKey]*regexp.Regexp
+}
+
+// patternKey identifies a pattern resolved for a tenant, an empty tenant ID resolving the global one.
+type patternKey struct {
+	tenantID string
+	name     string
+}
+
+// currentPatternCache is the pattern cache of the current configuration, replaced on every reload.
+var currentPatternCache atomic.Pointer[patternCache]
+
+// newPatternCache returns the pattern cache of c, compiling the patterns of source, which must hold the same
+// patterns as c and must not be modified afterwards.
+func newPatternCache(c, source *Config) *patternCache {
+	return &patternCache{cfg: c, source: source, compiled: make(map[patternKey]*regexp.Regexp)}
+}
+
+// get returns the compiled regular expression of the named pattern resolved for the tenant, compiling it if needed.
+func (p *patternCache) get(tenantID, name string) (*regexp.Regexp, error) {
+	key := patternKey{tenantID: tenantID, name: name}
+
+	p.mutex.RLock()
+	re, ok := p.compiled[key]
+	p.mutex.RUnlock()
+
+	if ok {
+		return re, nil
+	}
+
+	re, err := p.source.compilePattern(tenantID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	p.compiled[key] = re
+	p.mutex.Unlock()
+
+	return re, nil
+}
+
+// compilePattern compiles the named pattern of the configuration resolved for the tenant.
+func (c *Config) compilePattern(tenantID, name string) (*regexp.Regexp, error) {
+	pattern, ok := c.PatternFor(tenantID, name)
+	if !ok {
+		return nil, catcher.Error("unknown pattern", nil, map[string]any{"pattern": name, "tenant": tenantID})
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, catcher.Error("invalid pattern", err, map[string]any{"pattern": name, "tenant": tenantID})
+	}
+
+	return re, nil
+}
+
+// PatternFor returns the named pattern for a tenant: the one declared in the patterns section of the tenant
+// when it overrides or adds it, otherwise the one of the global patterns section.
+//
+// Tenant patterns are declared in the pipeline YAML files under the tenant's patterns key:
+//
+//	patterns:
+//	  username: "[a-z]+"
+//	tenants:
+//	  - id: 2b3c7ab4-1a4f-4c8b-9d43-0f5e0c6a1d2e
+//	    name: acme
+//	    patterns:
+//	      username: "[a-z]+\\.[a-z]+"
+//
+// Parameters:
+//
+//	tenantID: The ID of the tenant, an empty ID resolves the global pattern.
+//	name: The name of the pattern.
+//
+// Returns:
+//
+//	string: The pattern.
+//	bool: Whether the pattern is defined for the tenant or globally.
+func (c *Config) PatternFor(tenantID, name string) (string, bool) {
+	if tenantID != "" {
+		var pattern string
+		var found bool
+
+		for _, tenant := range c.GetTenants() {
+			if tenant.GetId() != tenantID {
+				continue
+			}
+
+			if p, ok := tenant.GetPatterns()[name]; ok {
+				pattern, found = p, true
+			}
+		}
+
+		if found {
+			return pattern, true
+		}
+	}
+
+	pattern, ok := c.GetPatterns()[name]
+	return pattern, ok
+}
+
+// CompiledPattern returns the compiled regular expression of the named entry of the patterns section
+// of the configuration. The patterns of the global configuration are compiled once per reload and shared,
+// other configurations compile the pattern on every call.
+//
+// Parameters:
+//
+//	name: The name of the pattern.
+//
+// Returns:
+//
+//	*regexp.Regexp: The compiled regular expression.
+//	error: An error if the pattern does not exist or is not a valid regular expression.
+func (c *Config) CompiledPattern(name string) (*regexp.Regexp, error) {
+	return c.CompiledPatternFor("", name)
+}
+
+// CompiledPatternFor behaves like CompiledPattern but resolves the pattern for a tenant like PatternFor.
+// The patterns of the global configuration are compiled once per reload and tenant.
+func (c *Config) CompiledPatternFor(tenantID, name string) (*regexp.Regexp, error) {
+	if cache := currentPatternCache.Load(); cache != nil && cache.cfg == c {
+		return cache.get(tenantID, name)
+	}
+
+	return c.compilePattern(tenantID, name)
+}
@@ -2664,6 +2664,7 @@ type Config struct {
 	Patterns      map[string]string          `protobuf:"bytes,4,rep,name=patterns,proto3" json:"patterns,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	Plugins       map[string]*structpb.Value `protobuf:"bytes,5,rep,name=plugins,proto3" json:"plugins,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	Env           *Env                       `protobuf:"bytes,6,opt,name=env,proto3" json:"env,omitempty"`
+	NetworkLists  map[string]*NetworkList    `protobuf:"bytes,7,rep,name=networkLists,proto3" json:"networkLists,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -2740,19 +2741,72 @@ func (x *Config) GetEnv() *Env {
 	return nil
 }
 
-type Tenant struct {
+func (x *Config) GetNetworkLists() map[string]*NetworkList {
+	if x != nil {
+		return x.NetworkLists
+	}
+	return nil
+}
+
+type NetworkList struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
-	Assets        []*Asset               `protobuf:"bytes,3,rep,name=assets,proto3" json:"assets,omitempty"`
-	DisabledRules []uint64               `protobuf:"varint,4,rep,packed,name=disabledRules,proto3" json:"disabledRules,omitempty"`
+	Cidrs         []string               `protobuf:"bytes,1,rep,name=cidrs,proto3" json:"cidrs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NetworkList) Reset() {
+	*x = NetworkList{}
+	mi := &file_plugins_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NetworkList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NetworkList) ProtoMessage() {}
+
+func (x *NetworkList) ProtoReflect() protoreflect.Message {
+	mi := &file_plugins_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NetworkList.ProtoReflect.Descriptor instead.
+func (*NetworkList) Descriptor() ([]byte, []int) {
+	return file_plugins_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *NetworkList) GetCidrs() []string {
+	if x != nil {
+		return x.Cidrs
+	}
+	return nil
+}
+
+type Tenant struct {
+	state         protoimpl.MessageState     `protogen:"open.v1"`
+	Name          string                     `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Id            string                     `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Assets        []*Asset                   `protobuf:"bytes,3,rep,name=assets,proto3" json:"assets,omitempty"`
+	DisabledRules []uint64                   `protobuf:"varint,4,rep,packed,name=disabledRules,proto3" json:"disabledRules,omitempty"`
+	Plugins       map[string]*structpb.Value `protobuf:"bytes,5,rep,name=plugins,proto3" json:"plugins,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Patterns      map[string]string          `protobuf:"bytes,6,rep,name=patterns,proto3" json:"patterns,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Tenant) Reset() {
 	*x = Tenant{}
-	mi := &file_plugins_proto_msgTypes[28]
+	mi := &file_plugins_proto_msgTypes[29]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -2764,7 +2818,7 @@ func (x *Tenant) String() string {
 func (*Tenant) ProtoMessage() {}
 
 func (x *Tenant) ProtoReflect() protoreflect.Message {
-	mi := &file_plugins_proto_msgTypes[28]
+	mi := &file_plugins_proto_msgTypes[29]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -2777,7 +2831,7 @@ func (x *Tenant) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Tenant.ProtoReflect.Descriptor instead.
 func (*Tenant) Descriptor() ([]byte, []int) {
-	return file_plugins_proto_rawDescGZIP(), []int{28}
+	return file_plugins_proto_rawDescGZIP(), []int{29}
 }
 
 func (x *Tenant) GetName() string {
@@ -2808,6 +2862,20 @@ func (x *Tenant) GetDisabledRules() []uint64 {
 	return nil
 }
 
+func (x *Tenant) GetPlugins() map[string]*structpb.Value {
+	if x != nil {
+		return x.Plugins
+	}
+	return nil
+}
+
+func (x *Tenant) GetPatterns() map[string]string {
+	if x != nil {
+		return x.Patterns
+	}
+	return nil
+}
+
 type Asset struct {
 	state           protoimpl.MessageState `protogen:"open.v1"`
 	Name            string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
@@ -2822,7 +2890,7 @@ type Asset struct {
 
 func (x *Asset) Reset() {
 	*x = Asset{}
-	mi := &file_plugins_proto_msgTypes[29]
+	mi := &file_plugins_proto_msgTypes[30]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -2834,7 +2902,7 @@ func (x *Asset) String() string {
 func (*Asset) ProtoMessage() {}
 
 func (x *Asset) ProtoReflect() protoreflect.Message {
-	mi := &file_plugins_proto_msgTypes[29]
+	mi := &file_plugins_proto_msgTypes[30]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -2847,7 +2915,7 @@ func (x *Asset) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Asset.ProtoReflect.Descriptor instead.
 func (*Asset) Descriptor() ([]byte, []int) {
-	return file_plugins_proto_rawDescGZIP(), []int{29}
+	return file_plugins_proto_rawDescGZIP(), []int{30}
 }
 
 func (x *Asset) GetName() string {
@@ -2902,7 +2970,7 @@ type Pipeline struct {
 
 func (x *Pipeline) Reset() {
 	*x = Pipeline{}
-	mi := &file_plugins_proto_msgTypes[30]
+	mi := &file_plugins_proto_msgTypes[31]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -2914,7 +2982,7 @@ func (x *Pipeline) String() string {
 func (*Pipeline) ProtoMessage() {}
 
 func (x *Pipeline) ProtoReflect() protoreflect.Message {
-	mi := &file_plugins_proto_msgTypes[30]
+	mi := &file_plugins_proto_msgTypes[31]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -2927,7 +2995,7 @@ func (x *Pipeline) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Pipeline.ProtoReflect.Descriptor instead.
 func (*Pipeline) Descriptor() ([]byte, []int) {
-	return file_plugins_proto_rawDescGZIP(), []int{30}
+	return file_plugins_proto_rawDescGZIP(), []int{31}
 }
 
 func (x *Pipeline) GetDataTypes() []string {
@@ -2956,7 +3024,7 @@ type Env struct {
 
 func (x *Env) Reset() {
 	*x = Env{}
-	mi := &file_plugins_proto_msgTypes[31]
+	mi := &file_plugins_proto_msgTypes[32]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -2968,7 +3036,7 @@ func (x *Env) String() string {
 func (*Env) ProtoMessage() {}
 
 func (x *Env) ProtoReflect() protoreflect.Message {
-	mi := &file_plugins_proto_msgTypes[31]
+	mi := &file_plugins_proto_msgTypes[32]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -2981,7 +3049,7 @@ func (x *Env) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Env.ProtoReflect.Descriptor instead.
 func (*Env) Descriptor() ([]byte, []int) {
-	return file_plugins_proto_rawDescGZIP(), []int{31}
+	return file_plugins_proto_rawDescGZIP(), []int{32}
 }
 
 func (x *Env) GetNodeName() string {
@@ -3023,7 +3091,7 @@ type Variable struct {
 
 func (x *Variable) Reset() {
 	*x = Variable{}
-	mi := &file_plugins_proto_msgTypes[32]
+	mi := &file_plugins_proto_msgTypes[33]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -3035,7 +3103,7 @@ func (x *Variable) String() string {
 func (*Variable) ProtoMessage() {}
 
 func (x *Variable) ProtoReflect() protoreflect.Message {
-	mi := &file_plugins_proto_msgTypes[32]
+	mi := &file_plugins_proto_msgTypes[33]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -3048,7 +3116,7 @@ func (x *Variable) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Variable.ProtoReflect.Descriptor instead.
 func (*Variable) Descriptor() ([]byte, []int) {
-	return file_plugins_proto_rawDescGZIP(), []int{32}
+	return file_plugins_proto_rawDescGZIP(), []int{33}
 }
 
 func (x *Variable) GetGet() string {
@@ -3354,25 +3422,39 @@ const file_plugins_proto_rawDesc = "" +
 	"\x05where\x18\x03 \x01(\tR\x05where\x1aQ\n" +
 	"\vParamsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12,\n" +
-	"\x05value\x18\x02 \x01(\v2\x16.google.protobuf.ValueR\x05value:\x028\x01\"\xac\x03\n" +
+	"\x05value\x18\x02 \x01(\v2\x16.google.protobuf.ValueR\x05value:\x028\x01\"\xca\x04\n" +
 	"\x06Config\x12-\n" +
 	"\bpipeline\x18\x01 \x03(\v2\x11.plugins.PipelineR\bpipeline\x12$\n" +
 	"\rdisabledRules\x18\x02 \x03(\x04R\rdisabledRules\x12)\n" +
 	"\atenants\x18\x03 \x03(\v2\x0f.plugins.TenantR\atenants\x129\n" +
 	"\bpatterns\x18\x04 \x03(\v2\x1d.plugins.Config.PatternsEntryR\bpatterns\x126\n" +
 	"\aplugins\x18\x05 \x03(\v2\x1c.plugins.Config.PluginsEntryR\aplugins\x12\x1e\n" +
-	"\x03env\x18\x06 \x01(\v2\f.plugins.EnvR\x03env\x1a;\n" +
+	"\x03env\x18\x06 \x01(\v2\f.plugins.EnvR\x03env\x12E\n" +
+	"\fnetworkLists\x18\a \x03(\v2!.plugins.Config.NetworkListsEntryR\fnetworkLists\x1a;\n" +
 	"\rPatternsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
 	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1aR\n" +
 	"\fPluginsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12,\n" +
-	"\x05value\x18\x02 \x01(\v2\x16.google.protobuf.ValueR\x05value:\x028\x01\"z\n" +
+	"\x05value\x18\x02 \x01(\v2\x16.google.protobuf.ValueR\x05value:\x028\x01\x1aU\n" +
+	"\x11NetworkListsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12*\n" +
+	"\x05value\x18\x02 \x01(\v2\x14.plugins.NetworkListR\x05value:\x028\x01\"#\n" +
+	"\vNetworkList\x12\x14\n" +
+	"\x05cidrs\x18\x01 \x03(\tR\x05cidrs\"\xfe\x02\n" +
 	"\x06Tenant\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\x12\x0e\n" +
 	"\x02id\x18\x02 \x01(\tR\x02id\x12&\n" +
 	"\x06assets\x18\x03 \x03(\v2\x0e.plugins.AssetR\x06assets\x12$\n" +
-	"\rdisabledRules\x18\x04 \x03(\x04R\rdisabledRules\"\xb7\x01\n" +
+	"\rdisabledRules\x18\x04 \x03(\x04R\rdisabledRules\x126\n" +
+	"\aplugins\x18\x05 \x03(\v2\x1c.plugins.Tenant.PluginsEntryR\aplugins\x129\n" +
+	"\bpatterns\x18\x06 \x03(\v2\x1d.plugins.Tenant.PatternsEntryR\bpatterns\x1aR\n" +
+	"\fPluginsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12,\n" +
+	"\x05value\x18\x02 \x01(\v2\x16.google.protobuf.ValueR\x05value:\x028\x01\x1a;\n" +
+	"\rPatternsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xb7\x01\n" +
 	"\x05Asset\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1c\n" +
 	"\thostnames\x18\x02 \x03(\tR\thostnames\x12\x10\n" +
@@ -3424,7 +3506,7 @@ func file_plugins_proto_rawDescGZIP() []byte {
 	return file_plugins_proto_rawDescData
 }
 
-var file_plugins_proto_msgTypes = make([]protoimpl.MessageInfo, 39)
+var file_plugins_proto_msgTypes = make([]protoimpl.MessageInfo, 43)
 var file_plugins_proto_goTypes = []any{
 	(*Message)(nil),          // 0: plugins.Message
 	(*Ack)(nil),              // 1: plugins.Ack
@@ -3454,29 +3536,33 @@ var file_plugins_proto_goTypes = []any{
 	(*Drop)(nil),             // 25: plugins.Drop
 	(*Add)(nil),              // 26: plugins.Add
 	(*Config)(nil),           // 27: plugins.Config
-	(*Tenant)(nil),           // 28: plugins.Tenant
-	(*Asset)(nil),            // 29: plugins.Asset
-	(*Pipeline)(nil),         // 30: plugins.Pipeline
-	(*Env)(nil),              // 31: plugins.Env
-	(*Variable)(nil),         // 32: plugins.Variable
-	nil,                      // 33: plugins.Event.LogEntry
-	nil,                      // 34: plugins.Event.ComplianceEntry
-	nil,                      // 35: plugins.Dynamic.ParamsEntry
-	nil,                      // 36: plugins.Add.ParamsEntry
-	nil,                      // 37: plugins.Config.PatternsEntry
-	nil,                      // 38: plugins.Config.PluginsEntry
-	(*structpb.Value)(nil),   // 39: google.protobuf.Value
-	(*emptypb.Empty)(nil),    // 40: google.protobuf.Empty
+	(*NetworkList)(nil),      // 28: plugins.NetworkList
+	(*Tenant)(nil),           // 29: plugins.Tenant
+	(*Asset)(nil),            // 30: plugins.Asset
+	(*Pipeline)(nil),         // 31: plugins.Pipeline
+	(*Env)(nil),              // 32: plugins.Env
+	(*Variable)(nil),         // 33: plugins.Variable
+	nil,                      // 34: plugins.Event.LogEntry
+	nil,                      // 35: plugins.Event.ComplianceEntry
+	nil,                      // 36: plugins.Dynamic.ParamsEntry
+	nil,                      // 37: plugins.Add.ParamsEntry
+	nil,                      // 38: plugins.Config.PatternsEntry
+	nil,                      // 39: plugins.Config.PluginsEntry
+	nil,                      // 40: plugins.Config.NetworkListsEntry
+	nil,                      // 41: plugins.Tenant.PluginsEntry
+	nil,                      // 42: plugins.Tenant.PatternsEntry
+	(*structpb.Value)(nil),   // 43: google.protobuf.Value
+	(*emptypb.Empty)(nil),    // 44: google.protobuf.Empty
 }
 var file_plugins_proto_depIdxs = []int32{
 	3,  // 0: plugins.Alert.impact:type_name -> plugins.Impact
 	6,  // 1: plugins.Alert.adversary:type_name -> plugins.Side
 	6,  // 2: plugins.Alert.target:type_name -> plugins.Side
 	4,  // 3: plugins.Alert.events:type_name -> plugins.Event
-	33, // 4: plugins.Event.log:type_name -> plugins.Event.LogEntry
+	34, // 4: plugins.Event.log:type_name -> plugins.Event.LogEntry
 	6,  // 5: plugins.Event.target:type_name -> plugins.Side
 	6,  // 6: plugins.Event.origin:type_name -> plugins.Side
-	34, // 7: plugins.Event.compliance:type_name -> plugins.Event.ComplianceEntry
+	35, // 7: plugins.Event.compliance:type_name -> plugins.Event.ComplianceEntry
 	8,  // 8: plugins.Side.geolocation:type_name -> plugins.Geolocation
 	7,  // 9: plugins.Side.disks:type_name -> plugins.DiskInfo
 	10, // 10: plugins.Transform.draft:type_name -> plugins.Draft
@@ -3494,44 +3580,49 @@ var file_plugins_proto_depIdxs = []int32{
 	26, // 22: plugins.Step.add:type_name -> plugins.Add
 	13, // 23: plugins.Step.dynamic:type_name -> plugins.Dynamic
 	19, // 24: plugins.Step.expand:type_name -> plugins.Expand
-	35, // 25: plugins.Dynamic.params:type_name -> plugins.Dynamic.ParamsEntry
+	36, // 25: plugins.Dynamic.params:type_name -> plugins.Dynamic.ParamsEntry
 	16, // 26: plugins.Grok.patterns:type_name -> plugins.Pattern
-	36, // 27: plugins.Add.params:type_name -> plugins.Add.ParamsEntry
-	30, // 28: plugins.Config.pipeline:type_name -> plugins.Pipeline
-	28, // 29: plugins.Config.tenants:type_name -> plugins.Tenant
-	37, // 30: plugins.Config.patterns:type_name -> plugins.Config.PatternsEntry
-	38, // 31: plugins.Config.plugins:type_name -> plugins.Config.PluginsEntry
-	31, // 32: plugins.Config.env:type_name -> plugins.Env
-	29, // 33: plugins.Tenant.assets:type_name -> plugins.Asset
-	12, // 34: plugins.Pipeline.steps:type_name -> plugins.Step
-	39, // 35: plugins.Event.LogEntry.value:type_name -> google.protobuf.Value
-	5,  // 36: plugins.Event.ComplianceEntry.value:type_name -> plugins.ComplianceValues
-	39, // 37: plugins.Dynamic.ParamsEntry.value:type_name -> google.protobuf.Value
-	39, // 38: plugins.Add.ParamsEntry.value:type_name -> google.protobuf.Value
-	39, // 39: plugins.Config.PluginsEntry.value:type_name -> google.protobuf.Value
-	9,  // 40: plugins.Engine.Input:input_type -> plugins.Log
-	0,  // 41: plugins.Engine.Notify:input_type -> plugins.Message
-	11, // 42: plugins.Parsing.ParseLog:input_type -> plugins.Transform
-	4,  // 43: plugins.Analysis.Analyze:input_type -> plugins.Event
-	2,  // 44: plugins.Correlation.Correlate:input_type -> plugins.Alert
-	0,  // 45: plugins.Notification.Notify:input_type -> plugins.Message
-	9,  // 46: plugins.Integration.ProcessLog:input_type -> plugins.Log
-	4,  // 47: plugins.Output.EventOutput:input_type -> plugins.Event
-	2,  // 48: plugins.Output.AlertOutput:input_type -> plugins.Alert
-	1,  // 49: plugins.Engine.Input:output_type -> plugins.Ack
-	1,  // 50: plugins.Engine.Notify:output_type -> plugins.Ack
-	10, // 51: plugins.Parsing.ParseLog:output_type -> plugins.Draft
-	2,  // 52: plugins.Analysis.Analyze:output_type -> plugins.Alert
-	40, // 53: plugins.Correlation.Correlate:output_type -> google.protobuf.Empty
-	40, // 54: plugins.Notification.Notify:output_type -> google.protobuf.Empty
-	1,  // 55: plugins.Integration.ProcessLog:output_type -> plugins.Ack
-	40, // 56: plugins.Output.EventOutput:output_type -> google.protobuf.Empty
-	40, // 57: plugins.Output.AlertOutput:output_type -> google.protobuf.Empty
-	49, // [49:58] is the sub-list for method output_type
-	40, // [40:49] is the sub-list for method input_type
-	40, // [40:40] is the sub-list for extension type_name
-	40, // [40:40] is the sub-list for extension extendee
-	0,  // [0:40] is the sub-list for field type_name
+	37, // 27: plugins.Add.params:type_name -> plugins.Add.ParamsEntry
+	31, // 28: plugins.Config.pipeline:type_name -> plugins.Pipeline
+	29, // 29: plugins.Config.tenants:type_name -> plugins.Tenant
+	38, // 30: plugins.Config.patterns:type_name -> plugins.Config.PatternsEntry
+	39, // 31: plugins.Config.plugins:type_name -> plugins.Config.PluginsEntry
+	32, // 32: plugins.Config.env:type_name -> plugins.Env
+	40, // 33: plugins.Config.networkLists:type_name -> plugins.Config.NetworkListsEntry
+	30, // 34: plugins.Tenant.assets:type_name -> plugins.Asset
+	41, // 35: plugins.Tenant.plugins:type_name -> plugins.Tenant.PluginsEntry
+	42, // 36: plugins.Tenant.patterns:type_name -> plugins.Tenant.PatternsEntry
+	12, // 37: plugins.Pipeline.steps:type_name -> plugins.Step
+	43, // 38: plugins.Event.LogEntry.value:type_name -> google.protobuf.Value
+	5,  // 39: plugins.Event.ComplianceEntry.value:type_name -> plugins.ComplianceValues
+	43, // 40: plugins.Dynamic.ParamsEntry.value:type_name -> google.protobuf.Value
+	43, // 41: plugins.Add.ParamsEntry.value:type_name -> google.protobuf.Value
+	43, // 42: plugins.Config.PluginsEntry.value:type_name -> google.protobuf.Value
+	28, // 43: plugins.Config.NetworkListsEntry.value:type_name -> plugins.NetworkList
+	43, // 44: plugins.Tenant.PluginsEntry.value:type_name -> google.protobuf.Value
+	9,  // 45: plugins.Engine.Input:input_type -> plugins.Log
+	0,  // 46: plugins.Engine.Notify:input_type -> plugins.Message
+	11, // 47: plugins.Parsing.ParseLog:input_type -> plugins.Transform
+	4,  // 48: plugins.Analysis.Analyze:input_type -> plugins.Event
+	2,  // 49: plugins.Correlation.Correlate:input_type -> plugins.Alert
+	0,  // 50: plugins.Notification.Notify:input_type -> plugins.Message
+	9,  // 51: plugins.Integration.ProcessLog:input_type -> plugins.Log
+	4,  // 52: plugins.Output.EventOutput:input_type -> plugins.Event
+	2,  // 53: plugins.Output.AlertOutput:input_type -> plugins.Alert
+	1,  // 54: plugins.Engine.Input:output_type -> plugins.Ack
+	1,  // 55: plugins.Engine.Notify:output_type -> plugins.Ack
+	10, // 56: plugins.Parsing.ParseLog:output_type -> plugins.Draft
+	2,  // 57: plugins.Analysis.Analyze:output_type -> plugins.Alert
+	44, // 58: plugins.Correlation.Correlate:output_type -> google.protobuf.Empty
+	44, // 59: plugins.Notification.Notify:output_type -> google.protobuf.Empty
+	1,  // 60: plugins.Integration.ProcessLog:output_type -> plugins.Ack
+	44, // 61: plugins.Output.EventOutput:output_type -> google.protobuf.Empty
+	44, // 62: plugins.Output.AlertOutput:output_type -> google.protobuf.Empty
+	54, // [54:63] is the sub-list for method output_type
+	45, // [45:54] is the sub-list for method input_type
+	45, // [45:45] is the sub-list for extension type_name
+	45, // [45:45] is the sub-list for extension extendee
+	0,  // [0:45] is the sub-list for field type_name
 }
 
 func init() { file_plugins_proto_init() }
@@ -3545,7 +3636,7 @@ func file_plugins_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_plugins_proto_rawDesc), len(file_plugins_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   39,
+			NumMessages:   43,
 			NumExtensions: 0,
 			NumServices:   7,
 		},
@@ -0,0 +1,92 @@
+package plugins
+
+import (
+	"github.com/threatwinds/go-sdk/catcher"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// redactedValue replaces the value of secret keys in redacted configurations.
+const redactedValue = "****"
+
+var redactedKeys = []string{"password", "token", "secret", "key"}
+var redactedKeysMutex sync.RWMutex
+
+// AddRedactedKeys extends the list of patterns used to detect secret keys in plugin configurations.
+// A key is considered secret when it contains any of the patterns, ignoring case.
+func AddRedactedKeys(patterns ...string) {
+	redactedKeysMutex.Lock()
+	defer redactedKeysMutex.Unlock()
+
+	for _, p := range patterns {
+		redactedKeys = append(redactedKeys, strings.ToLower(p))
+	}
+}
+
+// isSecretKey reports whether the key matches any of the redacted key patterns.
+func isSecretKey(key string) bool {
+	redactedKeysMutex.RLock()
+	defer redactedKeysMutex.RUnlock()
+
+	key = strings.ToLower(key)
+	for _, p := range redactedKeys {
+		if strings.Contains(key, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Redacted returns a deep copy of the configuration where the values of secret keys in the global
+// and tenant plugin blocks are replaced with "****". The receiver is not modified.
+// Keys are matched against the patterns "password", "token", "secret", "key" and any pattern
+// added with AddRedactedKeys.
+func (c *Config) Redacted() *Config {
+	redacted := proto.Clone(c).(*Config)
+
+	for _, v := range redacted.Plugins {
+		redactValue(v)
+	}
+
+	for _, tenant := range redacted.Tenants {
+		for _, v := range tenant.Plugins {
+			redactValue(v)
+		}
+	}
+
+	return redacted
+}
+
+// Dump returns the JSON representation of the redacted configuration, suitable for logging
+// and diagnostics. It returns an empty string if the configuration cannot be marshalled.
+func (c *Config) Dump() string {
+	b, err := protojson.Marshal(c.Redacted())
+	if err != nil {
+		_ = catcher.Error("failed to marshal config", err, nil)
+		return ""
+	}
+	return string(b)
+}
+
+// redactValue replaces in place the values of secret keys found in v, at any depth.
+func redactValue(v *structpb.Value) {
+	switch kind := v.GetKind().(type) {
+	case *structpb.Value_StructValue:
+		for key, field := range kind.StructValue.GetFields() {
+			if isSecretKey(key) {
+				kind.StructValue.Fields[key] = structpb.NewStringValue(redactedValue)
+				continue
+			}
+			redactValue(field)
+		}
+	case *structpb.Value_ListValue:
+		for _, item := range kind.ListValue.GetValues() {
+			redactValue(item)
+		}
+	}
+}
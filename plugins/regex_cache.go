@@ -0,0 +1,66 @@
+package plugins
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+	"github.com/threatwinds/go-sdk/utils"
+)
+
+// compiledRegex is the result of compiling a regular expression.
+type compiledRegex struct {
+	re  *regexp.Regexp
+	err error
+}
+
+// regexCacheTTL and regexCacheSize bound the cache of the regular expressions used by the CEL functions.
+const (
+	regexCacheTTL  = time.Hour
+	regexCacheSize = 1000
+)
+
+// compileRegex compiles a regular expression used by a CEL function, caching the result so the patterns
+// written in rules are compiled once instead of on every evaluation.
+var compileRegex = utils.MemoizeWithLimit(func(pattern string) compiledRegex {
+	re, err := regexp.Compile(pattern)
+	return compiledRegex{re: re, err: err}
+}, regexCacheTTL, regexCacheSize)
+
+// regexListValidator reports the malformed patterns of the literal lists passed to a CEL function taking a
+// list of regular expressions as second argument, so they fail when the expression is checked instead of
+// on every evaluation. Patterns that are not literals are only validated when evaluated.
+type regexListValidator struct {
+	function string
+}
+
+// Name returns the unique name of the validator.
+func (v regexListValidator) Name() string {
+	return "plugins.validator." + v.function
+}
+
+// Validate compiles the literal patterns of every call to the function.
+func (v regexListValidator) Validate(_ *cel.Env, _ cel.ValidatorConfig, a *celast.AST, iss *cel.Issues) {
+	for _, call := range celast.MatchDescendants(celast.NavigateAST(a), celast.FunctionMatcher(v.function)) {
+		args := call.AsCall().Args()
+		if len(args) < 2 || args[1].Kind() != celast.ListKind {
+			continue
+		}
+
+		for _, elem := range args[1].AsList().Elements() {
+			if elem.Kind() != celast.LiteralKind {
+				continue
+			}
+
+			pattern, ok := elem.AsLiteral().Value().(string)
+			if !ok {
+				continue
+			}
+
+			if compiled := compileRegex(pattern); compiled.err != nil {
+				iss.ReportErrorAtID(elem.ID(), "invalid %s pattern %q: %s", v.function, pattern, compiled.err)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package plugins
+
+import (
+	"github.com/threatwinds/go-sdk/catcher"
+	"github.com/threatwinds/go-sdk/utils"
+	"maps"
+	"sync"
+	"sync/atomic"
+)
+
+// pluginCfgDecoder decodes the JSON configuration of a plugin into its registered type.
+type pluginCfgDecoder func([]byte) (any, error)
+
+var pluginCfgTypes = make(map[string]pluginCfgDecoder)
+var pluginCfgErrors = make(map[string]error)
+var pluginCfgTypesMutex sync.RWMutex
+
+// pluginCfgCache holds the configurations of the registered plugins decoded when a configuration was loaded.
+type pluginCfgCache struct {
+	cfg    *Config
+	values map[string]any
+}
+
+// currentPluginCfgCache is the plugin configuration cache of the current configuration, replaced on every reload.
+var currentPluginCfgCache atomic.Pointer[pluginCfgCache]
+
+// RegisterPluginCfg registers the type of the configuration block of a plugin. On every configuration
+// load, the block of each registered plugin is decoded into its type and cached for PluginCfgAs, and the
+// plugins whose block is missing or malformed are logged and reported by PluginCfgErrors, without aborting
+// the load or affecting the other plugins.
+//
+// Type Parameters:
+//
+//	t: The type into which the plugin configuration is decoded.
+//
+// Parameters:
+//
+//	pluginName: The name of the plugin, as used in the plugins section of the configuration.
+func RegisterPluginCfg[t any](pluginName string) {
+	pluginCfgTypesMutex.Lock()
+	defer pluginCfgTypesMutex.Unlock()
+
+	pluginCfgTypes[pluginName] = func(b []byte) (any, error) {
+		var value = new(t)
+		err := utils.JSONCodec.Unmarshal(b, value)
+		return value, err
+	}
+}
+
+// PluginCfgErrors returns the errors found while decoding the configuration of the registered plugins
+// during the last configuration load, indexed by plugin name. Plugins decoded successfully are not included.
+func PluginCfgErrors() map[string]error {
+	pluginCfgTypesMutex.RLock()
+	defer pluginCfgTypesMutex.RUnlock()
+
+	return maps.Clone(pluginCfgErrors)
+}
+
+// PluginCfgAs returns the configuration of a plugin decoded into the given type. For plugins registered
+// with RegisterPluginCfg and the same type, the value decoded when the configuration was loaded is returned,
+// keeping the decoding cost off the hot path; it is shared between callers and must not be modified.
+// Otherwise, the configuration is decoded on every call.
+//
+// Type Parameters:
+//
+//	t: The type into which the plugin configuration is decoded.
+//
+// Parameters:
+//
+//	pluginName: The name of the plugin, as used in the plugins section of the configuration.
+//
+// Returns:
+//
+//	*t: The decoded configuration.
+//	error: An error if the plugin is not configured or its configuration cannot be decoded.
+func PluginCfgAs[t any](pluginName string) (*t, error) {
+	return decodePluginCfg[t](GetCfg(), pluginName)
+}
+
+// decodePluginCfg returns the configuration of a plugin decoded into the given type, from the cache when the
+// receiver is the global configuration and the plugin was registered with the same type.
+func decodePluginCfg[t any](c *Config, pluginName string) (*t, error) {
+	if cache := currentPluginCfgCache.Load(); cache != nil && cache.cfg == c {
+		if value, ok := cache.values[pluginName].(*t); ok {
+			return value, nil
+		}
+	}
+
+	raw, err := c.pluginCfgRaw(pluginName)
+	if err != nil {
+		return nil, err
+	}
+
+	var value = new(t)
+
+	err = utils.JSONCodec.Unmarshal(raw, value)
+	if err != nil {
+		return nil, catcher.Error("invalid plugin config", err, map[string]any{"plugin": pluginName})
+	}
+
+	return value, nil
+}
+
+// validatePluginCfgs decodes the configuration of every registered plugin, records the failures and returns
+// the decoded values, indexed by plugin name.
+func (c *Config) validatePluginCfgs() map[string]any {
+	pluginCfgTypesMutex.Lock()
+	defer pluginCfgTypesMutex.Unlock()
+
+	errs := make(map[string]error)
+	values := make(map[string]any)
+
+	for name, decode := range pluginCfgTypes {
+		raw, err := c.pluginCfgRaw(name)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+
+		value, err := decode(raw)
+		if err != nil {
+			errs[name] = catcher.Error("invalid plugin config", err, map[string]any{"plugin": name})
+			continue
+		}
+
+		values[name] = value
+	}
+
+	pluginCfgErrors = errs
+
+	return values
+}
@@ -0,0 +1,86 @@
+package plugins
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+
+	"github.com/threatwinds/go-sdk/catcher"
+	"github.com/threatwinds/go-sdk/utils"
+)
+
+// RemoteConfigSource fetches the configuration from an HTTP endpoint, e.g. a central configuration service
+// in immutable-infrastructure setups. It remembers the ETag of the last response, so polling the source
+// with Fetch only downloads and parses the configuration when it changed.
+type RemoteConfigSource struct {
+	// URL is the address of the configuration document.
+	URL string
+	// Headers are sent with every request, e.g. an Authorization header.
+	Headers map[string]string
+
+	mutex sync.Mutex
+	etag  string
+}
+
+// LoadRemoteConfig fetches and parses the configuration served at url. The body may hold one or more
+// YAML or JSON documents, merged like the files of the pipeline folder. The Env section is not set.
+//
+// Parameters:
+//
+//	url: The address of the configuration document.
+//	headers: The headers sent with the request, may be nil.
+//
+// Returns:
+//
+//	*Config: The configuration.
+//	error: An error if the configuration cannot be fetched or parsed.
+func LoadRemoteConfig(url string, headers map[string]string) (*Config, error) {
+	source := &RemoteConfigSource{URL: url, Headers: headers}
+
+	config, _, err := source.Fetch()
+
+	return config, err
+}
+
+// Fetch fetches and parses the configuration, see LoadRemoteConfig. After the first successful fetch,
+// the request is conditional on the ETag of the previous response: if the server answers 304 Not Modified,
+// Fetch returns a nil configuration and false.
+//
+// Returns:
+//
+//	*Config: The configuration, nil if it did not change.
+//	bool: Whether a new configuration was fetched.
+//	error: An error if the configuration cannot be fetched or parsed.
+func (s *RemoteConfigSource) Fetch() (*Config, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	headers := make(map[string]string, len(s.Headers)+1)
+	for k, v := range s.Headers {
+		headers[k] = v
+	}
+
+	if s.etag != "" {
+		headers["If-None-Match"] = s.etag
+	}
+
+	body, info, err := utils.DoRawReq(s.URL, nil, http.MethodGet, headers, nil)
+	if err != nil {
+		return nil, false, catcher.Error("error fetching remote configuration", err, map[string]any{"url": s.URL})
+	}
+
+	if info.StatusCode == http.StatusNotModified {
+		return nil, false, nil
+	}
+
+	config := newCfg()
+
+	err = utils.StreamPbYamlReader(bytes.NewReader(body), config.mergeCfgDocument)
+	if err != nil {
+		return nil, false, catcher.Error("error parsing remote configuration", err, map[string]any{"url": s.URL})
+	}
+
+	s.etag = info.Header.Get("ETag")
+
+	return config, true, nil
+}
@@ -0,0 +1,71 @@
+package plugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteConfigSource(t *testing.T) {
+	const document = `
+pipeline:
+  - dataTypes: [syslog]
+patterns:
+  ip: '\d+'
+---
+tenants:
+  - id: t1
+    name: acme
+disabledRules: [7]
+patterns:
+  user: '\w+'
+`
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write([]byte(document))
+	}))
+	defer server.Close()
+
+	source := &RemoteConfigSource{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+
+	config, changed, err := source.Fetch()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	require.Len(t, config.Pipeline, 1)
+	assert.Equal(t, []string{"syslog"}, config.Pipeline[0].DataTypes)
+	assert.Equal(t, map[string]string{"ip": `\d+`, "user": `\w+`}, config.Patterns)
+	require.Len(t, config.Tenants, 1)
+	assert.Equal(t, "acme", config.Tenants[0].Name)
+	assert.Equal(t, []uint64{7}, config.DisabledRules)
+
+	config, changed, err = source.Fetch()
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Nil(t, config)
+	assert.Equal(t, int32(2), requests.Load())
+
+	config, err = LoadRemoteConfig(server.URL, map[string]string{"Authorization": "Bearer token"})
+	require.NoError(t, err)
+	assert.Len(t, config.Tenants, 1)
+
+	_, err = LoadRemoteConfig(server.URL, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,39 @@
+package plugins
+
+import (
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/threatwinds/go-sdk/utils"
+)
+
+// compiledSubExpression is the result of compiling a sub-expression of map_eval.
+type compiledSubExpression struct {
+	prg cel.Program
+	err error
+}
+
+// subExpressionCacheTTL and subExpressionCacheSize bound the cache of the sub-expressions of map_eval.
+const (
+	subExpressionCacheTTL  = time.Hour
+	subExpressionCacheSize = 1000
+)
+
+// compileSubExpression compiles a boolean sub-expression of map_eval, where the element being evaluated is
+// bound to the item variable. Sub-expressions only use the standard CEL functions, so their programs do not
+// depend on the evaluated data and are compiled once and shared by every evaluation. Programs check the
+// evaluation context within comprehensions, like the ones of evaluateValue.
+var compileSubExpression = utils.MemoizeWithLimit(func(expression string) compiledSubExpression {
+	env, err := cel.NewEnv(cel.Variable("item", cel.DynType))
+	if err != nil {
+		return compiledSubExpression{err: err}
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return compiledSubExpression{err: issues.Err()}
+	}
+
+	prg, err := env.Program(ast, cel.InterruptCheckFrequency(interruptCheckFrequency))
+	return compiledSubExpression{prg: prg, err: err}
+}, subExpressionCacheTTL, subExpressionCacheSize)
@@ -0,0 +1,74 @@
+package plugins
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/threatwinds/go-sdk/catcher"
+)
+
+// Validate checks the configuration for errors that would break the components using it: global or tenant
+// patterns that are not valid regular expressions, tenants sharing the same ID and invalid network list entries.
+// The configuration is only applied on reload when it is valid, otherwise the last valid one is kept.
+//
+// Returns:
+//
+//	error: An error listing every problem found under the "errors" arg, or nil if the configuration is valid.
+func (c *Config) Validate() error {
+	var errs = make([]*catcher.SdkError, 0)
+
+	names := make([]string, 0, len(c.GetPatterns()))
+	for name := range c.GetPatterns() {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if _, err := regexp.Compile(c.Patterns[name]); err != nil {
+			errs = append(errs, catcher.Error("invalid pattern", err, map[string]any{"pattern": name}))
+		}
+	}
+
+	tenants := make(map[string]struct{})
+	for _, tenant := range c.GetTenants() {
+		names = names[:0]
+		for name := range tenant.GetPatterns() {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			if _, err := regexp.Compile(tenant.Patterns[name]); err != nil {
+				errs = append(errs, catcher.Error("invalid pattern", err, map[string]any{"pattern": name, "tenant": tenant.GetName()}))
+			}
+		}
+
+		if tenant.GetId() == "" {
+			continue
+		}
+
+		if _, ok := tenants[tenant.GetId()]; ok {
+			errs = append(errs, catcher.Error("duplicate tenant", nil, map[string]any{"id": tenant.GetId(), "name": tenant.GetName()}))
+		}
+		tenants[tenant.GetId()] = struct{}{}
+	}
+
+	names = names[:0]
+	for name := range c.GetNetworkLists() {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		_, invalid := parseNetworks(c.NetworkLists[name].GetCidrs())
+		for _, entry := range invalid {
+			errs = append(errs, catcher.Error("invalid entry in network list", nil, map[string]any{"list": name, "entry": entry}))
+		}
+	}
+
+	if len(errs) > 0 {
+		return catcher.Error("invalid configuration", nil, map[string]any{"errors": errs})
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"encoding/xml"
+	"mime"
+	"strings"
+	"sync"
+
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// ResponseDecoder decodes a response body into the value pointed by v. The data is reused once the
+// decoder returns, so decoders must copy any part of it they keep in v.
+type ResponseDecoder func(data []byte, v any) error
+
+var responseDecoders = map[string]ResponseDecoder{
+	"application/json":   jsonDecoder,
+	"application/xml":    xml.Unmarshal,
+	"text/xml":           xml.Unmarshal,
+	"application/yaml":   yamlDecoder,
+	"application/x-yaml": yamlDecoder,
+	"text/yaml":          yamlDecoder,
+}
+var responseDecodersMutex sync.RWMutex
+
+// yamlDecoder decodes YAML honouring the json tags of the target type, like the JSON decoder does.
+func yamlDecoder(data []byte, v any) error {
+	return k8syaml.Unmarshal(data, v)
+}
+
+// RegisterResponseDecoder registers the decoder used by DoReq for responses of the given media type
+// (e.g. "application/msgpack"), replacing any previous one. Media type parameters such as charset are
+// ignored when matching. JSON is used for unregistered media types. Requests only advertise DefaultAccept
+// unless RequestOptions.Accept or the caller headers ask for other media types.
+func RegisterResponseDecoder(contentType string, decoder ResponseDecoder) {
+	responseDecodersMutex.Lock()
+	defer responseDecodersMutex.Unlock()
+
+	responseDecoders[strings.ToLower(contentType)] = decoder
+}
+
+// responseDecoder returns the decoder registered for the Content-Type of a response.
+// Structured syntax suffixes (e.g. application/problem+json) are honoured, and JSON is
+// returned as the fallback for missing or unknown media types.
+func responseDecoder(contentType string) ResponseDecoder {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return jsonDecoder
+	}
+
+	responseDecodersMutex.RLock()
+	defer responseDecodersMutex.RUnlock()
+
+	if decoder, ok := responseDecoders[mediaType]; ok {
+		return decoder
+	}
+
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		if decoder, ok := responseDecoders["application/"+mediaType[i+1:]]; ok {
+			return decoder
+		}
+	}
+
+	return jsonDecoder
+}
@@ -0,0 +1,385 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/threatwinds/go-sdk/catcher"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxDownloadBackoff caps the wait between download attempts when no other value is configured.
+const DefaultMaxDownloadBackoff = time.Minute
+
+// DownloadOptions defines optional behaviour for DownloadWithOptions.
+// The zero value preserves the behaviour of Download.
+type DownloadOptions struct {
+	// Context allows cancelling the download, including mid-transfer. When nil, context.Background is used.
+	Context context.Context
+	// Timeout bounds the whole download. When zero, DefaultRequestTimeout is used.
+	// A negative value disables it, leaving cancellation to Context.
+	Timeout time.Duration
+	// BytesPerSec caps the transfer rate. When zero or negative, the transfer is not throttled.
+	BytesPerSec int64
+	// Retry enables retrying attempts that fail with a network error, a 429 or a 5xx status.
+	// MaxRetries bounds the total number of attempts (0 = unlimited, bounded by Timeout and the deadline of
+	// Context, or no retries when Timeout is negative and Context has no deadline) and WaitTime is the
+	// initial pause between attempts, doubled after every attempt up to MaxBackoff.
+	// A longer Retry-After header sent by the server is honoured. Attempts after a partial transfer
+	// resume from the current offset with a Range request, conditioned with If-Range on the ETag or
+	// Last-Modified header of the first response, so a file changed meanwhile is downloaded again from
+	// the start. When nil, a single attempt is made.
+	Retry *catcher.RetryConfig
+	// MaxBackoff caps the wait between attempts. When zero, DefaultMaxDownloadBackoff is used.
+	MaxBackoff time.Duration
+	// PreserveModTime sets the modification time of the downloaded file to the Last-Modified header of the
+	// response, so mirrors can be synchronized incrementally. Missing or invalid headers are ignored.
+	PreserveModTime bool
+}
+
+// Download downloads the content from the specified URL and saves it to the specified file.
+// It returns an error if any error occurs during the process.
+//
+// Parameters:
+//   - url: The URL from which to download the content.
+//   - file: The path to the file where the content should be saved.
+//
+// Returns:
+//   - error: An error object if an error occurs, otherwise nil.
+func Download(url, file string) error {
+	return DownloadWithOptions(url, file, nil)
+}
+
+// DownloadThrottled downloads the content from the specified URL into the specified file, keeping
+// the transfer rate under bytesPerSec so background syncs don't saturate the link. The download
+// is not bounded by a timeout, use DownloadWithOptions to pass a cancellable context.
+//
+// Parameters:
+//   - url: The URL from which to download the content.
+//   - file: The path to the file where the content should be saved.
+//   - bytesPerSec: The maximum transfer rate in bytes per second.
+//
+// Returns:
+//   - error: An error object if an error occurs, otherwise nil.
+func DownloadThrottled(url, file string, bytesPerSec int64) error {
+	return DownloadWithOptions(url, file, &DownloadOptions{Timeout: -1, BytesPerSec: bytesPerSec})
+}
+
+// DownloadWithOptions behaves like Download but accepts DownloadOptions to customize the transfer.
+// A nil options value is equivalent to calling Download. The content is downloaded into a temporary file in
+// the same directory and renamed over file once complete, so a failed download leaves file untouched.
+// Responses with a status other than 2xx are returned as errors, and a resumed attempt only accepts 206,
+// continuing the transfer, or 200, restarting it.
+//
+// Parameters:
+//   - url: The URL from which to download the content.
+//   - file: The path to the file where the content should be saved.
+//   - opts: Optional settings for the download, may be nil.
+//
+// Returns:
+//   - error: An error object if an error occurs, otherwise nil.
+func DownloadWithOptions(url, file string, opts *DownloadOptions) error {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultRequestTimeout
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Download into a temporary file next to the target, so it is only replaced by a complete download
+	out, err := createTempFile(file)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = out.Close()
+		_ = os.Remove(out.Name())
+	}()
+
+	// Add secure HTTP client configuration
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+			},
+			ResponseHeaderTimeout: DefaultRequestTimeout,
+		},
+	}
+
+	progress := &downloadProgress{}
+
+	for attempt := 1; ; attempt++ {
+		retryable, retryAfter, err := downloadAttempt(ctx, client, url, out, progress, opts)
+		if err == nil {
+			return commitTempFile(out, file, 0644)
+		}
+
+		if !retryable || !opts.canRetry(ctx, attempt) || ctx.Err() != nil {
+			return err
+		}
+
+		if !sleepContext(ctx, max(opts.backoff(attempt), retryAfter)) {
+			return catcher.Error("download cancelled", ctx.Err(), map[string]any{"url": url, "attempts": attempt})
+		}
+	}
+}
+
+// downloadProgress is the state of a download kept across attempts: the number of bytes saved and the
+// validator of the content being downloaded, sent with If-Range when resuming.
+type downloadProgress struct {
+	offset    int64
+	validator string
+}
+
+// restart discards the bytes saved so far, so the next attempt downloads the whole content again.
+func (p *downloadProgress) restart(out *os.File) error {
+	if err := out.Truncate(0); err != nil {
+		return catcher.Error("error saving file", err, map[string]any{"file": out.Name()})
+	}
+
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return catcher.Error("error saving file", err, map[string]any{"file": out.Name()})
+	}
+
+	p.offset = 0
+	p.validator = ""
+
+	return nil
+}
+
+// downloadAttempt downloads url into out, resuming from the offset of the progress, which it updates, and
+// returns whether the failure is transient and the wait requested by the server through the Retry-After header.
+func downloadAttempt(ctx context.Context, client *http.Client, url string, out *os.File, progress *downloadProgress, opts *DownloadOptions) (bool, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, 0, catcher.Error("error creating request", err, map[string]any{"url": url})
+	}
+
+	if progress.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", progress.offset))
+		if progress.validator != "" {
+			req.Header.Set("If-Range", progress.validator)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, 0, catcher.Error("error downloading file", err, map[string]any{"url": url})
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if opts.Retry != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) {
+		return true, parseRetryAfter(resp.Header.Get("Retry-After")), catcher.Error("error response", nil, map[string]any{
+			"url":    url,
+			"status": resp.StatusCode,
+		})
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, 0, catcher.Error("error response", nil, map[string]any{
+			"url":    url,
+			"status": resp.StatusCode,
+		})
+	}
+
+	if progress.offset > 0 && resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return false, 0, catcher.Error("unexpected response to range request", nil, map[string]any{
+			"url":    url,
+			"offset": progress.offset,
+			"status": resp.StatusCode,
+		})
+	}
+
+	if progress.offset > 0 && resp.StatusCode == http.StatusPartialContent {
+		// A range other than the requested one cannot be appended, download the whole content again
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != progress.offset {
+			offset := progress.offset
+			if err := progress.restart(out); err != nil {
+				return false, 0, err
+			}
+
+			return true, 0, catcher.Error("unexpected content range", nil, map[string]any{
+				"url":          url,
+				"offset":       offset,
+				"contentRange": resp.Header.Get("Content-Range"),
+			})
+		}
+	}
+
+	// The server ignored the Range header, or the content changed since the first attempt, and sent the whole
+	// content, restart from the beginning
+	if progress.offset > 0 && resp.StatusCode == http.StatusOK {
+		if err := progress.restart(out); err != nil {
+			return false, 0, err
+		}
+	}
+
+	if progress.offset == 0 {
+		progress.validator = rangeValidator(resp.Header)
+	}
+
+	var body io.Reader = resp.Body
+	if opts.BytesPerSec > 0 {
+		body = newThrottledReader(ctx, body, opts.BytesPerSec)
+	}
+
+	n, err := io.Copy(out, body)
+	progress.offset += n
+	if err != nil {
+		return true, 0, catcher.Error("error saving file", err, map[string]any{"file": out.Name(), "offset": progress.offset})
+	}
+
+	if opts.PreserveModTime {
+		if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+			// A zero access time is left unchanged
+			if err := os.Chtimes(out.Name(), time.Time{}, modTime); err != nil {
+				return false, 0, catcher.Error("error setting file modification time", err, map[string]any{"file": out.Name()})
+			}
+		}
+	}
+
+	return false, 0, nil
+}
+
+// rangeValidator returns the value of the If-Range header resuming a download of the response: its ETag when
+// strong, as weak ones cannot be used with If-Range, or else its Last-Modified header, if any.
+func rangeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return header.Get("Last-Modified")
+}
+
+// contentRangeStart returns the position of the first byte of a Content-Range header, e.g. 4 for
+// "bytes 4-9/10".
+func contentRangeStart(value string) (int64, bool) {
+	value, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, false
+	}
+
+	first, _, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, false
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return start, true
+}
+
+// canRetry reports whether another attempt is allowed after the given number of attempts of a download
+// bounded by ctx, see retryAllowed.
+func (o *DownloadOptions) canRetry(ctx context.Context, attempts int) bool {
+	return retryAllowed(ctx, o.Retry, attempts)
+}
+
+// backoff returns the wait after the given number of attempts, doubling WaitTime up to MaxBackoff.
+func (o *DownloadOptions) backoff(attempts int) time.Duration {
+	maxBackoff := o.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxDownloadBackoff
+	}
+
+	wait := o.Retry.WaitTime
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+
+	return min(wait, maxBackoff)
+}
+
+// parseRetryAfter parses a Retry-After header, expressed in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
+
+// throttledReader is a token-bucket rate limited io.Reader. The bucket holds at most one second
+// worth of bytes, so bursts never exceed the configured rate.
+type throttledReader struct {
+	ctx    context.Context
+	r      io.Reader
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// newThrottledReader wraps r so reads don't exceed bytesPerSec, honouring the context cancellation.
+func newThrottledReader(ctx context.Context, r io.Reader, bytesPerSec int64) *throttledReader {
+	return &throttledReader{
+		ctx:    ctx,
+		r:      r,
+		rate:   bytesPerSec,
+		tokens: float64(bytesPerSec),
+		last:   time.Now(),
+	}
+}
+
+// Read reads at most one second worth of bytes and then waits until the bucket pays them back.
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if err := t.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if int64(len(p)) > t.rate {
+		p = p[:t.rate]
+	}
+
+	n, err := t.r.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * float64(t.rate)
+	if t.tokens > float64(t.rate) {
+		t.tokens = float64(t.rate)
+	}
+	t.last = now
+	t.tokens -= float64(n)
+
+	if t.tokens < 0 {
+		delay := time.Duration(-t.tokens / float64(t.rate) * float64(time.Second))
+		if !sleepContext(t.ctx, delay) {
+			return n, t.ctx.Err()
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,381 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threatwinds/go-sdk/catcher"
+)
+
+func TestDownloadThrottled(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 3000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	f := filepath.Join(t.TempDir(), "out")
+
+	start := time.Now()
+	require.NoError(t, DownloadThrottled(server.URL, f, 2000))
+	elapsed := time.Since(start)
+
+	got, err := os.ReadFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+}
+
+func TestDownloadThrottledCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte("a"), 10000))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := DownloadWithOptions(server.URL, filepath.Join(t.TempDir(), "out"), &DownloadOptions{
+		Context:     ctx,
+		BytesPerSec: 1000,
+	})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestDownloadRetry(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("rules"))
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+
+	err := DownloadWithOptions(server.URL, file, &DownloadOptions{Retry: &catcher.RetryConfig{MaxRetries: 3, WaitTime: time.Millisecond}})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), attempts.Load())
+
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "rules", string(content))
+
+	attempts.Store(0)
+	err = DownloadWithOptions(server.URL, file, &DownloadOptions{Retry: &catcher.RetryConfig{MaxRetries: 2, WaitTime: time.Millisecond}})
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), attempts.Load())
+
+	// Unlimited attempts require an overall deadline, without it a single attempt is made
+	attempts.Store(0)
+	err = DownloadWithOptions(server.URL, file, &DownloadOptions{Timeout: -1, Retry: &catcher.RetryConfig{WaitTime: time.Millisecond}})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), attempts.Load())
+
+	attempts.Store(0)
+	err = DownloadWithOptions(server.URL, file, &DownloadOptions{Retry: &catcher.RetryConfig{WaitTime: time.Millisecond}})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), attempts.Load())
+}
+
+func TestDownloadRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	err := DownloadWithOptions(server.URL, filepath.Join(t.TempDir(), "file"), &DownloadOptions{Retry: &catcher.RetryConfig{MaxRetries: 2, WaitTime: time.Millisecond}})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	attempts.Store(0)
+	err = DownloadWithOptions(server.URL, filepath.Join(t.TempDir(), "file"), &DownloadOptions{Context: ctx, Retry: &catcher.RetryConfig{MaxRetries: 2, WaitTime: time.Millisecond}})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestDownloadResume(t *testing.T) {
+	const content = "0123456789"
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+
+		if r.Header.Get("Range") == "" {
+			// Announce the whole content but drop the connection halfway
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write([]byte(content[:4]))
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+			return
+		}
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 4-9/%d", len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte(content[4:]))
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "file")
+
+	err := DownloadWithOptions(server.URL, file, &DownloadOptions{Retry: &catcher.RetryConfig{MaxRetries: 2, WaitTime: time.Millisecond}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "bytes=4-"}, ranges)
+
+	got, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(got))
+}
+
+func TestDownloadResumeValidation(t *testing.T) {
+	const content = "0123456789"
+	const changed = "abcdefghij"
+
+	tests := []struct {
+		name     string
+		etag     string
+		modified string
+		resume   func(w http.ResponseWriter, r *http.Request)
+		want     string
+		ifRange  []string
+	}{
+		{
+			name: "matching range",
+			etag: `"v1"`,
+			resume: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Range", "bytes 4-9/10")
+				w.WriteHeader(http.StatusPartialContent)
+				_, _ = w.Write([]byte(content[4:]))
+			},
+			want:    content,
+			ifRange: []string{"", `"v1"`},
+		},
+		{
+			name:     "changed content",
+			modified: "Wed, 01 May 2024 10:30:00 GMT",
+			resume: func(w http.ResponseWriter, r *http.Request) {
+				// The validator no longer matches, the whole new content is sent
+				_, _ = w.Write([]byte(changed))
+			},
+			want:    changed,
+			ifRange: []string{"", "Wed, 01 May 2024 10:30:00 GMT"},
+		},
+		{
+			name: "other range",
+			etag: `W/"weak"`,
+			resume: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Range", "bytes 2-9/10")
+				w.WriteHeader(http.StatusPartialContent)
+				_, _ = w.Write([]byte(content[2:]))
+			},
+			want:    content,
+			ifRange: []string{"", "", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ifRange []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ifRange = append(ifRange, r.Header.Get("If-Range"))
+
+				if r.Header.Get("Range") != "" {
+					tt.resume(w, r)
+					return
+				}
+
+				if tt.etag != "" {
+					w.Header().Set("ETag", tt.etag)
+				}
+				if tt.modified != "" {
+					w.Header().Set("Last-Modified", tt.modified)
+				}
+
+				// The first attempt drops the connection halfway, later ones send the whole content
+				if len(ifRange) > 1 {
+					_, _ = w.Write([]byte(content))
+					return
+				}
+
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				_, _ = w.Write([]byte(content[:4]))
+				w.(http.Flusher).Flush()
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				_ = conn.Close()
+			}))
+			defer server.Close()
+
+			file := filepath.Join(t.TempDir(), "file")
+
+			err := DownloadWithOptions(server.URL, file, &DownloadOptions{Retry: &catcher.RetryConfig{MaxRetries: 3, WaitTime: time.Millisecond}})
+			require.NoError(t, err)
+			assert.Equal(t, tt.ifRange, ifRange)
+
+			got, err := os.ReadFile(file)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	// Without retries, a mismatching range fails the download instead of saving a corrupt file
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", "bytes 0-9/10")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "file")
+	progress := &downloadProgress{offset: 4}
+	out, err := createTempFile(file)
+	require.NoError(t, err)
+	defer func() { _ = out.Close() }()
+
+	retryable, _, err := downloadAttempt(context.Background(), http.DefaultClient, server.URL, out, progress, &DownloadOptions{})
+	require.Error(t, err)
+	assert.True(t, retryable)
+	assert.Zero(t, progress.offset)
+}
+
+func TestDownloadResponseStatus(t *testing.T) {
+	const content = "0123456789"
+
+	tests := []struct {
+		name    string
+		resume  int
+		want    string
+		wantErr bool
+	}{
+		{"not found", 0, "", true},
+		{"forbidden", 0, "", true},
+		{"range ignored", http.StatusOK, content, false},
+		{"range not satisfiable", http.StatusRequestedRangeNotSatisfiable, "", true},
+		{"range answered without content", http.StatusNoContent, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case tt.name == "not found":
+					http.Error(w, "page not found", http.StatusNotFound)
+				case tt.name == "forbidden":
+					http.Error(w, "access denied", http.StatusForbidden)
+				case r.Header.Get("Range") == "":
+					// Announce the whole content but drop the connection halfway
+					w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+					_, _ = w.Write([]byte(content[:4]))
+					w.(http.Flusher).Flush()
+					conn, _, _ := w.(http.Hijacker).Hijack()
+					_ = conn.Close()
+				default:
+					w.WriteHeader(tt.resume)
+					if tt.resume == http.StatusOK {
+						_, _ = w.Write([]byte(content))
+					}
+				}
+			}))
+			defer server.Close()
+
+			dir := t.TempDir()
+			file := filepath.Join(dir, "file")
+			require.NoError(t, os.WriteFile(file, []byte("previous"), 0644))
+
+			err := DownloadWithOptions(server.URL, file, &DownloadOptions{Retry: &catcher.RetryConfig{MaxRetries: 2, WaitTime: time.Millisecond}})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			got, err := os.ReadFile(file)
+			require.NoError(t, err)
+
+			// A failed download leaves the previous content and no temporary file behind
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Len(t, entries, 1)
+
+			if tt.wantErr {
+				assert.Equal(t, "previous", string(got))
+				return
+			}
+
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "page not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "file")
+
+	err := Download(server.URL, file)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, catcher.ToSdkError(err).Args["status"])
+	assert.NoFileExists(t, file)
+}
+
+func TestDownloadPreserveModTime(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		lastModified string
+		preserve     bool
+		want         bool
+	}{
+		{"preserved", modTime.Format(http.TimeFormat), true, true},
+		{"disabled", modTime.Format(http.TimeFormat), false, false},
+		{"missing header", "", true, false},
+		{"invalid header", "yesterday", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.lastModified != "" {
+					w.Header().Set("Last-Modified", tt.lastModified)
+				}
+				_, _ = w.Write([]byte("rules"))
+			}))
+			defer server.Close()
+
+			f := filepath.Join(t.TempDir(), "out")
+			require.NoError(t, DownloadWithOptions(server.URL, f, &DownloadOptions{PreserveModTime: tt.preserve}))
+
+			info, err := os.Stat(f)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, info.ModTime().Equal(modTime))
+			assert.Equal(t, int64(5), info.Size())
+		})
+	}
+}
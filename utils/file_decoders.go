@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/threatwinds/go-sdk/catcher"
+)
+
+// FileDecoder decodes the content of a file into the value pointed by v.
+type FileDecoder func(data []byte, v any) error
+
+var fileDecoders = map[string]FileDecoder{
+	".json": jsonDecoder,
+	".yaml": yamlDecoder,
+	".yml":  yamlDecoder,
+	".toml": toml.Unmarshal,
+}
+var fileDecodersMutex sync.RWMutex
+
+// RegisterFileDecoder registers the decoder used by ReadConfig for files with the given extension
+// (e.g. ".hcl" or "hcl"), replacing any previous one. Extensions are matched ignoring case.
+// JSON, YAML (.yaml and .yml, honouring json tags like ReadYaml in JSON mode) and TOML are registered by default.
+// Only ReadConfig uses the registry: ReadYaml, ReadJSON and the pipeline configuration loaded by the plugins
+// package, made of multi-document YAML files decoded as protobuf messages, keep their fixed formats.
+func RegisterFileDecoder(ext string, decoder FileDecoder) {
+	fileDecodersMutex.Lock()
+	defer fileDecodersMutex.Unlock()
+
+	fileDecoders[normalizeExt(ext)] = decoder
+}
+
+// normalizeExt returns the lower-cased extension with its leading dot.
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// fileDecoder returns the decoder registered for the extension of the file.
+func fileDecoder(f string) (FileDecoder, bool) {
+	fileDecodersMutex.RLock()
+	defer fileDecodersMutex.RUnlock()
+
+	decoder, ok := fileDecoders[normalizeExt(filepath.Ext(f))]
+	return decoder, ok
+}
+
+// ReadConfig reads a configuration file and decodes its content into a specified type with the decoder
+// registered for its extension, see RegisterFileDecoder. It is meant for the own configuration files of
+// plugins, the pipeline configuration being always read from YAML files.
+//
+// Type Parameters:
+//
+//	t: The type into which the file content should be decoded.
+//
+// Parameters:
+//
+//	f: The path of the file to be read.
+//
+// Returns:
+//
+//	*t: A pointer to the decoded value of the specified type.
+//	error: An error if no decoder is registered for the extension, or the file cannot be read or decoded.
+func ReadConfig[t any](f string) (*t, error) {
+	decode, ok := fileDecoder(f)
+	if !ok {
+		return nil, catcher.Error("unsupported file extension", nil, map[string]any{"file": f, "extension": filepath.Ext(f)})
+	}
+
+	content, err := os.ReadFile(f)
+	if err != nil {
+		return nil, catcher.Error("error opening file", err, map[string]any{"file": f})
+	}
+
+	var value = new(t)
+
+	err = decode(content, value)
+	if err != nil {
+		return nil, catcher.Error("error decoding file", err, map[string]any{"file": f})
+	}
+
+	return value, nil
+}
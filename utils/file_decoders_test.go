@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name  string `json:"name" toml:"name"`
+	Ports []int  `json:"ports" toml:"ports"`
+}
+
+func TestReadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"config.json": `{"name":"svc","ports":[80,443]}`,
+		"config.yaml": "name: svc\nports: [80, 443]\n",
+		"config.YML":  "name: svc\nports: [80, 443]\n",
+		"config.toml": "name = \"svc\"\nports = [80, 443]\n",
+		"config.kv":   "name=svc\nports=80,443\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+
+	want := &testConfig{Name: "svc", Ports: []int{80, 443}}
+
+	for _, name := range []string{"config.json", "config.yaml", "config.YML", "config.toml"} {
+		t.Run(name, func(t *testing.T) {
+			got, err := ReadConfig[testConfig](filepath.Join(dir, name))
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+
+	_, err := ReadConfig[testConfig](filepath.Join(dir, "config.kv"))
+	assert.Error(t, err)
+
+	RegisterFileDecoder("KV", func(data []byte, v any) error {
+		cfg := v.(*testConfig)
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			key, value, _ := strings.Cut(line, "=")
+			switch key {
+			case "name":
+				cfg.Name = value
+			case "ports":
+				return JSONCodec.Unmarshal([]byte("["+value+"]"), &cfg.Ports)
+			}
+		}
+		return nil
+	})
+	t.Cleanup(func() {
+		fileDecodersMutex.Lock()
+		delete(fileDecoders, ".kv")
+		fileDecodersMutex.Unlock()
+	})
+
+	got, err := ReadConfig[testConfig](filepath.Join(dir, "config.kv"))
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	_, err = ReadConfig[testConfig](filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.toml"), []byte("name = "), 0o644))
+	_, err = ReadConfig[testConfig](filepath.Join(dir, "broken.toml"))
+	assert.Error(t, err)
+}
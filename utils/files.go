@@ -2,6 +2,8 @@ package utils
 
 import (
 	"github.com/threatwinds/go-sdk/catcher"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -36,3 +38,81 @@ func ValidateFilePath(path string) error {
 
 	return nil
 }
+
+// WriteFileAtomic writes data to the file at path atomically. The content is first written and
+// synced to a temporary file in the same directory, which is then renamed over the destination,
+// so readers never observe a partially written file. Parent directories are created if needed.
+//
+// Parameters:
+//   - path: The destination file path.
+//   - data: The content to write.
+//   - perm: The permissions of the resulting file.
+//
+// Returns:
+//   - error: An error object if an error occurs, otherwise nil.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return catcher.Error("error creating directory", err, map[string]any{"dir": dir})
+	}
+
+	tmp, err := createTempFile(path)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return catcher.Error("error writing temporary file", err, map[string]any{"file": tmp.Name()})
+	}
+
+	return commitTempFile(tmp, path, perm)
+}
+
+// createTempFile creates a temporary file in the directory of path, to be renamed over it by
+// commitTempFile once complete. The caller removes it if it is never committed.
+func createTempFile(path string) (*os.File, error) {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, catcher.Error("error creating temporary file", err, map[string]any{"dir": dir})
+	}
+
+	return tmp, nil
+}
+
+// commitTempFile syncs and closes a temporary file created by createTempFile, sets its permissions and
+// renames it over path.
+func commitTempFile(tmp *os.File, path string, perm os.FileMode) error {
+	tmpName := tmp.Name()
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return catcher.Error("error syncing temporary file", err, map[string]any{"file": tmpName})
+	}
+
+	if err := tmp.Close(); err != nil {
+		return catcher.Error("error closing temporary file", err, map[string]any{"file": tmpName})
+	}
+
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return catcher.Error("error setting file permissions", err, map[string]any{"file": tmpName})
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return catcher.Error("error renaming temporary file", err, map[string]any{"from": tmpName, "to": path})
+	}
+
+	// Sync the directory so the rename is durable; not supported on every platform.
+	dir := filepath.Dir(path)
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+
+	return nil
+}
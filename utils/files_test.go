@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, "nested", "out.json")
+
+	require.NoError(t, WriteFileAtomic(f, []byte("first"), 0600))
+	require.NoError(t, WriteFileAtomic(f, []byte("second"), 0600))
+
+	content, err := os.ReadFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(content))
+
+	info, err := os.Stat(f)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	entries, err := os.ReadDir(filepath.Dir(f))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -1,11 +1,48 @@
 package utils
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/threatwinds/go-sdk/catcher"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
+// JSONLibrary is a JSON implementation, with the semantics of the encoding/json functions of the same name.
+type JSONLibrary interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec is the JSON implementation used by DoReq, ReadJSON and the plugin configuration helpers.
+// It defaults to encoding/json and can be replaced at startup with a faster library (e.g. jsoniter or
+// sonic) exposing the same functions. It is not safe to replace it while requests are in flight.
+var JSONCodec JSONLibrary = stdJSONCodec{}
+
+// stdJSONCodec is the JSONLibrary backed by encoding/json.
+type stdJSONCodec struct{}
+
+// Marshal encodes v with encoding/json.
+func (stdJSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes data into v with encoding/json.
+func (stdJSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// jsonDecoder is the ResponseDecoder for JSON, delegating to JSONCodec when called so replacing it
+// after the decoders are registered still takes effect.
+func jsonDecoder(data []byte, v any) error {
+	return JSONCodec.Unmarshal(data, v)
+}
+
 // ReadJSON reads a JSON file and parses its content into a specified type.
 // The function takes a file path as input and returns a pointer to the parsed
 // value of the specified type and a pointer to an error if an error occurs.
@@ -30,10 +67,322 @@ func ReadJSON[t any](f string) (*t, error) {
 
 	var value = new(t)
 
-	err = json.Unmarshal(content, value)
+	err = JSONCodec.Unmarshal(content, value)
 	if err != nil {
 		return nil, catcher.Error("error parsing JSON file", err, map[string]any{"file": f})
 	}
 
 	return value, nil
 }
+
+// MustReadJSON behaves like ReadJSON but panics if the file cannot be read or parsed.
+// It is intended for fail-fast loading of known-good configuration at startup (e.g. in init functions
+// or test fixtures), never for request paths.
+func MustReadJSON[t any](f string) *t {
+	value, err := ReadJSON[t](f)
+	if err != nil {
+		panic(fmt.Errorf("cannot read JSON file %q: %w", f, err))
+	}
+
+	return value
+}
+
+// FieldError describes a value of a JSON document that cannot be decoded into the corresponding Go field.
+type FieldError struct {
+	// Path is the dotted path of the value in the document, with array indexes, e.g. "process.args.2".
+	// It is empty for the root value.
+	Path string
+	// Msg describes the problem, e.g. "expected int, got string".
+	Msg string
+}
+
+// Error returns the path and the description of the problem.
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return e.Path + ": " + e.Msg
+}
+
+// DecodeInto decodes a JSON document into a new value of type t, like encoding/json but reporting every value
+// that does not match the expected type, with its path, instead of only the first one. Values that cannot be
+// decoded are left with their zero value and the rest of the document is still decoded, so plugins can log
+// precise diagnostics for the events violating their schema. Decoding always uses encoding/json, ignoring
+// JSONCodec, and unknown fields are ignored.
+//
+// Type Parameters:
+//
+//	t: The type into which the JSON document should be decoded.
+//
+// Parameters:
+//
+//	data: The JSON document.
+//
+// Returns:
+//
+//	*t: The decoded value, or nil if the document is not valid JSON.
+//	[]FieldError: The values that could not be decoded, nil if there are none.
+func DecodeInto[t any](data []byte) (*t, []FieldError) {
+	if !json.Valid(data) {
+		return nil, []FieldError{{Msg: "invalid JSON document"}}
+	}
+
+	var value = new(t)
+	var errs []FieldError
+
+	decodeField(bytes.TrimSpace(data), reflect.ValueOf(value).Elem(), "", &errs)
+
+	return value, errs
+}
+
+// textUnmarshalerType is the type of encoding.TextUnmarshaler.
+var textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+// unmarshalerType is the type of json.Unmarshaler.
+var unmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// decodeField decodes a valid JSON value into v, descending into structs, slices, arrays, maps and pointers
+// to report every mismatch found below path in errs.
+func decodeField(raw []byte, v reflect.Value, path string, errs *[]FieldError) {
+	if string(raw) == "null" {
+		// As in encoding/json, null only clears pointers, interfaces, maps and slices
+		switch v.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+			v.SetZero()
+		default:
+		}
+		return
+	}
+
+	// Types decoding themselves are decoded as a whole
+	if v.Kind() != reflect.Pointer && v.CanAddr() {
+		ptr := v.Addr().Type()
+		if ptr.Implements(unmarshalerType) || (ptr.Implements(textUnmarshalerType) && raw[0] == '"') {
+			decodeLeaf(raw, v, path, errs)
+			return
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		decodeField(raw, v.Elem(), path, errs)
+	case reflect.Struct:
+		var object map[string]json.RawMessage
+		if raw[0] != '{' || json.Unmarshal(raw, &object) != nil {
+			*errs = append(*errs, mismatch(path, v.Type(), raw))
+			return
+		}
+
+		for _, field := range jsonFields(v.Type()) {
+			value, key, ok := lookupKey(object, field.name)
+			if !ok {
+				continue
+			}
+
+			if field.quoted && len(value) > 0 && value[0] == '"' {
+				var inner string
+				_ = json.Unmarshal(value, &inner)
+				value = json.RawMessage(inner)
+				if !json.Valid(value) {
+					*errs = append(*errs, FieldError{Path: joinPath(path, key), Msg: fmt.Sprintf("invalid quoted value for %s", v.Type().FieldByIndex(field.index).Type)})
+					continue
+				}
+			}
+
+			if fv := fieldByIndex(v, field.index); fv.IsValid() {
+				decodeField(value, fv, joinPath(path, key), errs)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 && raw[0] == '"' {
+			// []byte is encoded as a base64 string
+			decodeLeaf(raw, v, path, errs)
+			return
+		}
+
+		var items []json.RawMessage
+		if raw[0] != '[' || json.Unmarshal(raw, &items) != nil {
+			*errs = append(*errs, mismatch(path, v.Type(), raw))
+			return
+		}
+
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), len(items), len(items)))
+		}
+
+		for i, item := range items {
+			if i >= v.Len() {
+				break
+			}
+			decodeField(item, v.Index(i), joinPath(path, strconv.Itoa(i)), errs)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			decodeLeaf(raw, v, path, errs)
+			return
+		}
+
+		var object map[string]json.RawMessage
+		if raw[0] != '{' || json.Unmarshal(raw, &object) != nil {
+			*errs = append(*errs, mismatch(path, v.Type(), raw))
+			return
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), len(object)))
+		}
+
+		for key, value := range object {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			decodeField(value, elem, joinPath(path, key), errs)
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+	default:
+		decodeLeaf(raw, v, path, errs)
+	}
+}
+
+// decodeLeaf decodes a JSON value into v with encoding/json, reporting the error if any.
+func decodeLeaf(raw []byte, v reflect.Value, path string, errs *[]FieldError) {
+	err := json.Unmarshal(raw, v.Addr().Interface())
+	if err == nil {
+		return
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		*errs = append(*errs, mismatch(path, v.Type(), raw))
+		return
+	}
+
+	*errs = append(*errs, FieldError{Path: path, Msg: err.Error()})
+}
+
+// mismatch returns the FieldError of a JSON value whose type does not match the Go type.
+func mismatch(path string, expected reflect.Type, raw []byte) FieldError {
+	var found string
+	switch raw[0] {
+	case '{':
+		found = "object"
+	case '[':
+		found = "array"
+	case '"':
+		found = "string"
+	case 't', 'f':
+		found = "bool"
+	default:
+		found = "number"
+	}
+
+	return FieldError{Path: path, Msg: fmt.Sprintf("expected %s, got %s", expected, found)}
+}
+
+// joinPath appends a key or index to a dotted path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// jsonField is a struct field decoded from a JSON object.
+type jsonField struct {
+	name   string
+	index  []int
+	quoted bool
+}
+
+// jsonFields returns the fields of a struct decoded from JSON, following the json tags and promoting the
+// fields of embedded structs as encoding/json does. Fields of the outer struct hide promoted ones.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	var embedded []jsonField
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for _, promoted := range jsonFields(ft) {
+				promoted.index = append([]int{i}, promoted.index...)
+				embedded = append(embedded, promoted)
+			}
+			continue
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields = append(fields, jsonField{name: name, index: []int{i}, quoted: strings.Contains(","+opts+",", ",string,")})
+	}
+
+	for _, promoted := range embedded {
+		hidden := false
+		for _, field := range fields {
+			if strings.EqualFold(field.name, promoted.name) {
+				hidden = true
+				break
+			}
+		}
+
+		if !hidden {
+			fields = append(fields, promoted)
+		}
+	}
+
+	return fields
+}
+
+// lookupKey returns the value of the key of a JSON object matching a field name, preferring an exact match
+// and otherwise matching case-insensitively as encoding/json does.
+func lookupKey(object map[string]json.RawMessage, name string) (json.RawMessage, string, bool) {
+	if value, ok := object[name]; ok {
+		return value, name, true
+	}
+
+	for key, value := range object {
+		if strings.EqualFold(key, name) {
+			return value, key, true
+		}
+	}
+
+	return nil, "", false
+}
+
+// fieldByIndex returns the nested field of a struct, allocating the embedded struct pointers on the way.
+// It returns an invalid value when an embedded pointer is nil and cannot be set, as encoding/json ignores them.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingJSONCodec counts the calls delegated to encoding/json.
+type countingJSONCodec struct {
+	stdJSONCodec
+	unmarshals atomic.Int32
+}
+
+func (c *countingJSONCodec) Unmarshal(data []byte, v any) error {
+	c.unmarshals.Add(1)
+	return c.stdJSONCodec.Unmarshal(data, v)
+}
+
+// decoderJSONCodec decodes with a json.Decoder, standing in for an alternative library in benchmarks.
+type decoderJSONCodec struct {
+	stdJSONCodec
+}
+
+func (decoderJSONCodec) Unmarshal(data []byte, v any) error {
+	return json.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// setJSONCodec replaces JSONCodec until the test ends.
+func setJSONCodec(tb testing.TB, codec JSONLibrary) {
+	previous := JSONCodec
+	JSONCodec = codec
+	tb.Cleanup(func() { JSONCodec = previous })
+}
+
+func TestJSONCodec(t *testing.T) {
+	codec := &countingJSONCodec{}
+	setJSONCodec(t, codec)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		_, _ = w.Write([]byte(`{"name":"value"}`))
+	}))
+	defer server.Close()
+
+	result, _, err := DoReq[map[string]string](server.URL, nil, http.MethodGet, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "value", result["name"])
+
+	_, _, err = DoReqWithOptions[map[string]string](server.URL, nil, http.MethodGet, nil, &RequestOptions{JSONOnly: true})
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "value.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"name":"value"}`), 0o644))
+
+	value, err := ReadJSON[map[string]string](file)
+	require.NoError(t, err)
+	assert.Equal(t, "value", (*value)["name"])
+
+	assert.Equal(t, int32(3), codec.unmarshals.Load())
+}
+
+func BenchmarkJSONCodec(b *testing.B) {
+	payload, err := json.Marshal(map[string]any{"items": strings.Split(strings.Repeat("item,", 100000), ",")})
+	require.NoError(b, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(payload)
+	}))
+	defer server.Close()
+
+	codecs := map[string]JSONLibrary{
+		"std":     stdJSONCodec{},
+		"decoder": decoderJSONCodec{},
+	}
+
+	for name, codec := range codecs {
+		b.Run(name, func(b *testing.B) {
+			setJSONCodec(b, codec)
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_, _, err := DoReq[map[string]any](server.URL, nil, http.MethodGet, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	type Meta struct {
+		Source string `json:"source"`
+	}
+
+	type Process struct {
+		PID  int      `json:"pid"`
+		Args []string `json:"args"`
+	}
+
+	type Event struct {
+		Meta
+		ID        string         `json:"id"`
+		Severity  int            `json:"severity"`
+		Port      int            `json:"port,string"`
+		Process   *Process       `json:"process"`
+		Labels    map[string]int `json:"labels"`
+		Tags      []string       `json:"tags"`
+		Extra     map[string]any `json:"extra"`
+		Ignored   string         `json:"-"`
+		Renamed   string         `json:"other_name"`
+		Untagged  bool
+		Histogram map[string]string `json:"histogram"`
+		Time      time.Time         `json:"time"`
+	}
+
+	valid := `{"source":"fw","id":"e1","severity":3,"port":"443","process":{"pid":10,"args":["-a","-b"]},"labels":{"a":1},"tags":["x"],"extra":{"k":[1]},"Ignored":"x","OTHER_NAME":"y","untagged":true,"unknown":1,"time":"2024-05-01T10:00:00Z"}`
+
+	event, errs := DecodeInto[Event]([]byte(valid))
+	require.Nil(t, errs)
+	require.NotNil(t, event)
+	assert.Equal(t, "fw", event.Source)
+	assert.Equal(t, 443, event.Port)
+	assert.Equal(t, []string{"-a", "-b"}, event.Process.Args)
+	assert.Equal(t, map[string]int{"a": 1}, event.Labels)
+	assert.Empty(t, event.Ignored)
+	assert.Equal(t, "y", event.Renamed)
+	assert.True(t, event.Untagged)
+
+	var expected Event
+	require.NoError(t, json.Unmarshal([]byte(valid), &expected))
+	assert.Equal(t, &expected, event)
+
+	invalid := `{"source":1,"id":"e2","severity":"high","port":"abc","process":{"pid":"ten","args":["-a",2,"-c"]},"labels":{"a":"one","b":2},"tags":"x","histogram":null,"time":"yesterday"}`
+
+	event, errs = DecodeInto[Event]([]byte(invalid))
+	require.NotNil(t, event)
+	assert.Equal(t, "e2", event.ID)
+	assert.Equal(t, []string{"-a", "", "-c"}, event.Process.Args)
+	assert.Equal(t, 2, event.Labels["b"])
+
+	assert.ElementsMatch(t, []FieldError{
+		{Path: "source", Msg: "expected string, got number"},
+		{Path: "severity", Msg: "expected int, got string"},
+		{Path: "port", Msg: "invalid quoted value for int"},
+		{Path: "process.pid", Msg: "expected int, got string"},
+		{Path: "process.args.1", Msg: "expected string, got number"},
+		{Path: "labels.a", Msg: "expected int, got string"},
+		{Path: "tags", Msg: "expected []string, got string"},
+		{Path: "time", Msg: `parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`},
+	}, errs)
+
+	_, errs = DecodeInto[[]int]([]byte(`[1,"2",3]`))
+	assert.Equal(t, []FieldError{{Path: "1", Msg: "expected int, got string"}}, errs)
+	assert.Equal(t, "1: expected int, got string", errs[0].Error())
+
+	event, errs = DecodeInto[Event]([]byte(`{"id":`))
+	assert.Nil(t, event)
+	assert.Equal(t, []FieldError{{Msg: "invalid JSON document"}}, errs)
+}
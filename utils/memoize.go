@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultMemoizeMaxSize is the maximum number of results kept by a function wrapped with Memoize.
+const DefaultMemoizeMaxSize = 10000
+
+// ttlCache is a size-bounded cache whose entries expire after a fixed TTL. When full, the least
+// recently used entry is evicted.
+type ttlCache[K comparable, V any] struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+// ttlEntry is a cached value with its expiration time.
+type ttlEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+func newTTLCache[K comparable, V any](ttl time.Duration, maxSize int) *ttlCache[K, V] {
+	return &ttlCache[K, V]{
+		ttl:     ttl,
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[K]*list.Element),
+	}
+}
+
+// get returns the value cached for key if it has not expired.
+func (c *ttlCache[K, V]) get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	entry := elem.Value.(*ttlEntry[K, V])
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+
+		var zero V
+		return zero, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	return entry.value, true
+}
+
+// set caches value for key, evicting the least recently used entry if the cache is full.
+func (c *ttlCache[K, V]) set(key K, value V) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*ttlEntry[K, V])
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	for c.order.Len() >= c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*ttlEntry[K, V]).key)
+	}
+
+	c.entries[key] = c.order.PushFront(&ttlEntry[K, V]{key: key, value: value, expires: expires})
+}
+
+// Memoize wraps a pure function so that its results are cached for the given TTL, keeping at most
+// DefaultMemoizeMaxSize results. See MemoizeWithLimit.
+func Memoize[K comparable, V any](fn func(K) V, ttl time.Duration) func(K) V {
+	return MemoizeWithLimit(fn, ttl, DefaultMemoizeMaxSize)
+}
+
+// MemoizeWithLimit wraps a pure function so that its results are cached for the given TTL. Expired
+// results are recomputed on the next call, and when maxSize results are cached the least recently used
+// one is evicted. The returned function is safe for concurrent use; concurrent calls for a key not yet
+// cached may each call fn.
+//
+// Type Parameters:
+//
+//	K: The type of the argument of the function, used as cache key.
+//	V: The type of the result of the function.
+//
+// Parameters:
+//
+//	fn: The function to memoize, it must return the same result for the same argument.
+//	ttl: How long a result is cached.
+//	maxSize: The maximum number of cached results, values lower than 1 are treated as 1.
+//
+// Returns:
+//
+//	func(K) V: The memoized function.
+func MemoizeWithLimit[K comparable, V any](fn func(K) V, ttl time.Duration, maxSize int) func(K) V {
+	cache := newTTLCache[K, V](ttl, max(maxSize, 1))
+
+	return func(key K) V {
+		if value, ok := cache.get(key); ok {
+			return value
+		}
+
+		value := fn(key)
+		cache.set(key, value)
+
+		return value
+	}
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoize(t *testing.T) {
+	calls := map[string]int{}
+	memoized := Memoize(func(s string) int {
+		calls[s]++
+		return len(s)
+	}, time.Minute)
+
+	assert.Equal(t, 3, memoized("abc"))
+	assert.Equal(t, 3, memoized("abc"))
+	assert.Equal(t, 1, memoized("a"))
+	assert.Equal(t, 1, calls["abc"])
+	assert.Equal(t, 1, calls["a"])
+}
+
+func TestMemoizeExpiration(t *testing.T) {
+	calls := 0
+	memoized := Memoize(func(n int) int {
+		calls++
+		return n * 2
+	}, 20*time.Millisecond)
+
+	assert.Equal(t, 4, memoized(2))
+	assert.Equal(t, 4, memoized(2))
+	assert.Equal(t, 1, calls)
+
+	time.Sleep(30 * time.Millisecond)
+
+	assert.Equal(t, 4, memoized(2))
+	assert.Equal(t, 2, calls)
+}
+
+func TestMemoizeWithLimit(t *testing.T) {
+	calls := map[int]int{}
+	memoized := MemoizeWithLimit(func(n int) int {
+		calls[n]++
+		return n
+	}, time.Minute, 2)
+
+	memoized(1)
+	memoized(2)
+	memoized(1) // 1 becomes the most recently used
+	memoized(3) // evicts 2
+
+	memoized(1)
+	memoized(2)
+
+	assert.Equal(t, 1, calls[1])
+	assert.Equal(t, 2, calls[2])
+	assert.Equal(t, 1, calls[3])
+}
@@ -0,0 +1,40 @@
+package utils
+
+import "net/http"
+
+// RoundTripFunc is a request middleware. It receives the outgoing request and the next step of the
+// chain, and returns the response to hand back to the previous step. A middleware can modify the
+// request before calling next (e.g. to refresh an authorization header), inspect or replace the
+// response (e.g. to record metrics), or return without calling next to short-circuit the request.
+type RoundTripFunc func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error)
+
+// middlewareTransport is an http.RoundTripper running a middleware chain around a base transport.
+type middlewareTransport struct {
+	base       http.RoundTripper
+	middleware []RoundTripFunc
+}
+
+// chainMiddleware wraps base with the given middleware, the first one being the outermost.
+func chainMiddleware(base http.RoundTripper, middleware []RoundTripFunc) http.RoundTripper {
+	if len(middleware) == 0 {
+		return base
+	}
+
+	return &middlewareTransport{base: base, middleware: middleware}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *middlewareTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next(0)(req)
+}
+
+// next returns the step of the chain starting at the middleware with index i.
+func (t *middlewareTransport) next(i int) func(*http.Request) (*http.Response, error) {
+	if i == len(t.middleware) {
+		return t.base.RoundTrip
+	}
+
+	return func(req *http.Request) (*http.Response, error) {
+		return t.middleware[i](req, t.next(i+1))
+	}
+}
@@ -2,23 +2,74 @@ package utils
 
 import (
 	"bytes"
-	"crypto/tls"
-	"encoding/json"
+	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/threatwinds/go-sdk/catcher"
+	"github.com/tidwall/gjson"
 	"io"
 	"net/http"
-	"os"
+	neturl "net/url"
+	"strings"
 	"time"
 )
 
+// ErrBodyReadTimeout is the cause of the errors returned when the response body is not read within
+// RequestOptions.BodyReadTimeout.
+var ErrBodyReadTimeout = errors.New("response body read timed out")
+
+// ErrTruncatedResponse is the message of the errors returned when the connection is closed before the whole
+// response body is received, or the body ends in the middle of a JSON document. Use IsTruncatedResponse to
+// detect them.
+var ErrTruncatedResponse = errors.New("truncated response")
+
+// truncatedResponseError is the cause of the ErrTruncatedResponse errors, recording how much of the body was received.
+type truncatedResponseError struct {
+	received      int
+	contentLength int64
+	cause         error
+}
+
+// Error returns the sizes of the partial body and of the announced body, if any.
+func (e *truncatedResponseError) Error() string {
+	if e.contentLength < 0 {
+		return fmt.Sprintf("%s: received %d bytes without Content-Length: %v", ErrTruncatedResponse, e.received, e.cause)
+	}
+
+	return fmt.Sprintf("%s: received %d of %d bytes: %v", ErrTruncatedResponse, e.received, e.contentLength, e.cause)
+}
+
+// Unwrap returns ErrTruncatedResponse and the underlying error.
+func (e *truncatedResponseError) Unwrap() []error {
+	return []error{ErrTruncatedResponse, e.cause}
+}
+
+// IsTruncatedResponse reports whether the error returned by a request is due to a truncated response.
+func IsTruncatedResponse(err error) bool {
+	if errors.Is(err, ErrTruncatedResponse) {
+		return true
+	}
+
+	sdkErr := catcher.ToSdkError(err)
+
+	return sdkErr != nil && sdkErr.Msg == ErrTruncatedResponse.Error()
+}
+
+// isUnexpectedEnd reports whether a decoding error is caused by the end of the input.
+func isUnexpectedEnd(err error) bool {
+	return errors.Is(err, io.ErrUnexpectedEOF) || strings.Contains(err.Error(), "unexpected end of JSON input")
+}
+
 // DoReq sends an HTTP request and processes the response.
 //
 // This function sends an HTTP request to the specified URL with the given
 // method, data, and headers. It returns the response body unmarshalled into
 // the specified response type, the HTTP status code, and an error if any
-// occurred during the process.
+// occurred during the process. The body is decoded according to the response
+// Content-Type (JSON, XML, YAML or any decoder added with RegisterResponseDecoder),
+// falling back to JSON. Use DoRawReq to get the raw body instead.
+// Unless the headers set it, the request is sent with an Accept header of DefaultAccept.
 //
 // Type Parameters:
 //   - response: The type into which the response body will be unmarshalled.
@@ -35,105 +86,475 @@ import (
 //   - error: An error if any occurred during the request or response
 //     processing, otherwise nil.
 func DoReq[response any](url string, data []byte, method string, headers map[string]string) (response, int, error) {
+	return DoReqWithOptions[response](url, data, method, headers, nil)
+}
+
+// DoReqWithOptions behaves like DoReq but accepts RequestOptions to customize
+// how the request is sent. A nil options value is equivalent to calling DoReq.
+//
+// Type Parameters:
+//   - response: The type into which the response body will be unmarshalled.
+//
+// Parameters:
+//   - url: The URL to which the request is sent.
+//   - data: The request payload as a byte slice.
+//   - method: The HTTP method to use for the request (e.g., "GET", "POST").
+//   - headers: A map of headers to include in the request.
+//   - opts: Optional settings for the request, may be nil.
+//
+// Returns:
+//   - response: The response body unmarshalled into the specified type.
+//   - int: The HTTP status code of the response.
+//   - error: An error if any occurred during the request or response
+//     processing, otherwise nil.
+func DoReqWithOptions[response any](url string, data []byte, method string, headers map[string]string, opts *RequestOptions) (response, int, error) {
+	result, info, err := DoReqFull[response](url, data, method, headers, opts)
+	return result, info.StatusCode, err
+}
+
+// DoReqMap sends an HTTP request like DoReq and returns a gjson result over the raw JSON response body,
+// so it can be queried with paths (e.g. result.Get("items.0.id")) without defining a struct for it.
+// Unlike decoding into map[string]any, numbers keep their precision and objects keep their key order.
+// A response without body returns an empty result.
+//
+// Parameters:
+//   - url: The URL to which the request is sent.
+//   - data: The request payload as a byte slice.
+//   - method: The HTTP method to use for the request (e.g., "GET", "POST").
+//   - headers: A map of headers to include in the request.
+//
+// Returns:
+//   - *gjson.Result: The parsed response body.
+//   - int: The HTTP status code of the response.
+//   - error: An error if any occurred during the request, or if the response body is not valid JSON,
+//     otherwise nil.
+func DoReqMap(url string, data []byte, method string, headers map[string]string) (*gjson.Result, int, error) {
+	body, info, err := DoRawReq(url, data, method, headers, nil)
+	status := info.StatusCode
+	if err != nil {
+		return nil, status, err
+	}
+
+	if len(body) != 0 && !gjson.ValidBytes(body) {
+		return nil, status, catcher.Error("error parsing response", errors.New("invalid JSON"), map[string]any{
+			"status": status,
+		})
+	}
+
+	result := gjson.ParseBytes(body)
+
+	return &result, status, nil
+}
+
+// DoReqJSON sends an HTTP request like DoReq with the body encoded as JSON with JSONCodec, saving callers from
+// marshalling it themselves. The request is sent with a Content-Type of application/json unless the headers
+// set another one, e.g. application/merge-patch+json. The headers map is not modified.
+//
+// Type Parameters:
+//   - req: The type of the request body.
+//   - response: The type into which the response body will be unmarshalled.
+//
+// Parameters:
+//   - url: The URL to which the request is sent.
+//   - body: The request payload, encoded as JSON.
+//   - method: The HTTP method to use for the request (e.g., "GET", "POST").
+//   - headers: A map of headers to include in the request.
+//
+// Returns:
+//   - response: The response body unmarshalled into the specified type.
+//   - int: The HTTP status code of the response.
+//   - error: An error if the body cannot be encoded or any occurred during the request or response
+//     processing, otherwise nil.
+func DoReqJSON[req any, response any](url string, body req, method string, headers map[string]string) (response, int, error) {
+	data, err := JSONCodec.Marshal(body)
+	if err != nil {
+		var result response
+		return result, http.StatusInternalServerError, requestLogger(&RequestOptions{}, method, url).Error("error encoding request body", err, nil)
+	}
+
+	jsonHeaders := make(map[string]string, len(headers)+1)
+	jsonHeaders["Content-Type"] = "application/json"
+
+	for key, value := range headers {
+		if strings.EqualFold(key, "Content-Type") {
+			delete(jsonHeaders, "Content-Type")
+		}
+
+		jsonHeaders[key] = value
+	}
+
+	return DoReq[response](url, data, method, jsonHeaders)
+}
+
+// ResponseInfo holds the metadata of the response to a request sent with DoReqFull.
+type ResponseInfo struct {
+	// StatusCode is the HTTP status code of the response, or the status describing the failure when
+	// no response was received.
+	StatusCode int
+	// Header is the header of the response, nil when no response was received.
+	Header http.Header
+	// FinalURL is the URL of the last request sent after following redirects, empty when no response
+	// was received. It can differ from the requested URL and should be validated by security checks
+	// that depend on the effective endpoint.
+	FinalURL string
+}
+
+// status records the status code of a request that failed without a usable response and returns the info.
+func (i *ResponseInfo) status(code int) *ResponseInfo {
+	i.StatusCode = code
+	return i
+}
+
+// DoReqFull behaves like DoReqWithOptions but returns the metadata of the response, including the final
+// URL after redirects, instead of only its status code. The returned info is never nil.
+// Errors are logged with the trace and request IDs carried by RequestOptions.Context, see catcher.LoggerCtx.
+// They are *catcher.SdkError values whose Args include the method and URL of the request, the number of
+// attempts made and, for error responses, the status, so failures can be filtered by these fields.
+//
+// Type Parameters:
+//   - response: The type into which the response body will be unmarshalled.
+//
+// Parameters:
+//   - url: The URL to which the request is sent.
+//   - data: The request payload as a byte slice.
+//   - method: The HTTP method to use for the request (e.g., "GET", "POST").
+//   - headers: A map of headers to include in the request.
+//   - opts: Optional settings for the request, may be nil.
+//
+// Returns:
+//   - response: The response body unmarshalled into the specified type.
+//   - *ResponseInfo: The status code, header and final URL of the response.
+//   - error: An error if any occurred during the request or response
+//     processing, otherwise nil.
+func DoReqFull[response any](url string, data []byte, method string, headers map[string]string, opts *RequestOptions) (response, *ResponseInfo, error) {
 	var result response
+	info := &ResponseInfo{}
+
+	if opts == nil {
+		opts = &RequestOptions{}
+	}
+
+	log := requestLogger(opts, method, url)
 
-	if len(data) > maxMessageSize {
-		return result, http.StatusBadRequest, catcher.Error("cannot convert to object",
-			errors.New("data size exceeds limit"), map[string]any{
-				"size":  fmt.Sprintf("%d bytes", len(data)),
-				"limit": fmt.Sprintf("%d bytes", maxMessageSize),
+	if limit := opts.maxRequestSize(); limit >= 0 && int64(len(data)) > limit {
+		return result, info.status(http.StatusRequestEntityTooLarge), log.Error("request body exceeds size limit",
+			fmt.Errorf("request body of %d bytes exceeds the limit of %d bytes", len(data), limit), map[string]any{
+				"size":   fmt.Sprintf("%d bytes", len(data)),
+				"limit":  fmt.Sprintf("%d bytes", limit),
+				"status": http.StatusRequestEntityTooLarge,
 			})
 	}
 
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
-	if err != nil {
-		return result, http.StatusInternalServerError, catcher.Error("error creating request", err, nil)
+	payload := data
+	compressed := opts.CompressRequest && len(data) > opts.compressThreshold()
+	if compressed {
+		var err error
+		payload, err = gzipBytes(data)
+		if err != nil {
+			return result, info.status(http.StatusInternalServerError), log.Error("error compressing request body", err, nil)
+		}
+	}
+
+	header := opts.header(headers)
+	if compressed {
+		header.Set("Content-Encoding", "gzip")
+	}
+
+	return send[response](log, opts, method, url, requestBody{
+		open:       func() io.Reader { return bytes.NewReader(payload) },
+		length:     int64(len(payload)),
+		replayable: true,
+	}, header, info)
+}
+
+// rawResponse is the response type with which send returns the raw body, see DoRawReq.
+type rawResponse []byte
+
+// DoRawReq behaves like DoReqFull but returns the raw response body, without decoding it whatever its
+// Content-Type, e.g. to parse it with gjson or a streaming decoder. A response without body returns nil.
+//
+// Parameters:
+//   - url: The URL to which the request is sent.
+//   - data: The request payload as a byte slice.
+//   - method: The HTTP method to use for the request (e.g., "GET", "POST").
+//   - headers: A map of headers to include in the request.
+//   - opts: Optional settings for the request, may be nil.
+//
+// Returns:
+//   - []byte: The response body.
+//   - *ResponseInfo: The status code, header and final URL of the response.
+//   - error: An error if any occurred during the request, otherwise nil.
+func DoRawReq(url string, data []byte, method string, headers map[string]string, opts *RequestOptions) ([]byte, *ResponseInfo, error) {
+	body, info, err := DoReqFull[rawResponse](url, data, method, headers, opts)
+	return body, info, err
+}
+
+// DoReqStream sends an HTTP request whose body is streamed from an io.Reader instead of being held in
+// memory, and processes the response like DoReq. See DoReqStreamWithOptions.
+//
+// Type Parameters:
+//   - response: The type into which the response body will be unmarshalled.
+//
+// Parameters:
+//   - url: The URL to which the request is sent.
+//   - body: The reader from which the request payload is streamed.
+//   - contentLength: The size of the payload in bytes, or a negative value if unknown.
+//   - method: The HTTP method to use for the request (e.g., "POST", "PUT").
+//   - headers: A map of headers to include in the request.
+//
+// Returns:
+//   - response: The response body unmarshalled into the specified type.
+//   - int: The HTTP status code of the response.
+//   - error: An error if any occurred during the request or response
+//     processing, otherwise nil.
+func DoReqStream[response any](url string, body io.Reader, contentLength int64, method string, headers map[string]string) (response, int, error) {
+	return DoReqStreamWithOptions[response](url, body, contentLength, method, headers, nil)
+}
+
+// DoReqStreamWithOptions behaves like DoReqStream but accepts RequestOptions to customize how the request
+// is sent. When contentLength is negative, the body is sent with chunked transfer encoding. Since the body
+// can only be read once, the request is never retried and CompressRequest is ignored; the per-attempt
+// timeout also bounds the upload, so large uploads may need a longer PerAttemptTimeout.
+// A nil options value uses the defaults of DoReq.
+func DoReqStreamWithOptions[response any](url string, body io.Reader, contentLength int64, method string, headers map[string]string, opts *RequestOptions) (response, int, error) {
+	if opts == nil {
+		opts = &RequestOptions{}
 	}
 
-	for k, v := range headers {
-		req.Header.Add(k, v)
+	result, info, err := send[response](requestLogger(opts, method, url), opts, method, url, requestBody{
+		open:   func() io.Reader { return body },
+		length: contentLength,
+	}, opts.header(headers), &ResponseInfo{})
+
+	return result, info.StatusCode, err
+}
+
+// requestBody describes the payload of a request.
+type requestBody struct {
+	// open returns the reader of the payload for a new attempt.
+	open func() io.Reader
+	// length is the size of the payload in bytes, negative if unknown.
+	length int64
+	// replayable reports whether open returns a fresh reader on every call, allowing retries.
+	replayable bool
+}
+
+// requestLogger returns the logger of the errors of a request, adding its method and URL, without the
+// password if any, to the fields of every error.
+func requestLogger(opts *RequestOptions, method, rawURL string) *catcher.ContextLogger {
+	if u, err := neturl.Parse(rawURL); err == nil {
+		rawURL = u.Redacted()
 	}
 
-	// Configure HTTP client with security settings
+	return catcher.LoggerCtx(opts.context()).With(map[string]any{"method": method, "url": rawURL})
+}
+
+// send sends the request, retrying it as configured, and decodes the response into the result. Its errors
+// include the number of attempts made besides the method and URL added by requestLogger.
+func send[response any](log *catcher.ContextLogger, opts *RequestOptions, method, url string, payload requestBody, header http.Header, info *ResponseInfo) (response, *ResponseInfo, error) {
+	var result response
+
+	// Configure HTTP client with security settings, timeouts are enforced per attempt through the context
 	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				MinVersion: tls.VersionTLS12,
-			},
-			DisableCompression: true,
-		},
+		Transport: opts.transport(),
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return result, http.StatusInternalServerError, catcher.Error("error doing request", err, nil)
+	ctx := opts.context()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
 	}
 
-	defer func() { _ = resp.Body.Close() }()
+	var resp *http.Response
+	var buf *bytes.Buffer
+	var err error
+
+	// The response body is read into a pooled buffer, released once it has been decoded
+	defer func() { putBuffer(buf) }()
+
+	var attempts int
+
+	for attempts = 1; ; attempts++ {
+		resp, buf, err = doAttempt(ctx, client, method, url, payload, header, opts.perAttemptTimeout(), opts.bodyReadTimeout())
+		if !payload.replayable || !opts.shouldRetry(resp, err) || !opts.canRetry(ctx, attempts) {
+			break
+		}
+
+		putBuffer(buf)
+		buf = nil
+
+		if !sleepContext(ctx, opts.Retry.WaitTime) {
+			err = ctx.Err()
+			break
+		}
+	}
+
+	log = log.With(map[string]any{"attempts": attempts})
 
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return result, http.StatusInternalServerError, catcher.Error("error reading response body", err, nil)
+		var truncated *truncatedResponseError
+
+		switch {
+		case errors.As(err, &truncated):
+			return result, info.status(http.StatusBadGateway), log.Error(ErrTruncatedResponse.Error(), err, map[string]any{
+				"received":      truncated.received,
+				"contentLength": truncated.contentLength,
+				"status":        http.StatusBadGateway,
+			})
+		case errors.Is(err, ErrBodyReadTimeout):
+			return result, info.status(http.StatusGatewayTimeout), log.Error("response body read timed out", err, map[string]any{
+				"bodyReadTimeout": opts.bodyReadTimeout().String(),
+				"status":          http.StatusGatewayTimeout,
+			})
+		case errors.Is(err, ErrURLNotAllowed):
+			return result, info.status(http.StatusForbidden), log.Error("request blocked by URL policy", err, map[string]any{
+				"status": http.StatusForbidden,
+			})
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			return result, info.status(http.StatusGatewayTimeout), log.Error("request timeout exceeded", err, map[string]any{
+				"timeout": opts.Timeout.String(),
+			})
+		case errors.Is(err, context.DeadlineExceeded):
+			return result, info.status(http.StatusGatewayTimeout), log.Error("request attempt timed out", err, map[string]any{
+				"perAttemptTimeout": opts.perAttemptTimeout().String(),
+			})
+		default:
+			return result, info.status(http.StatusInternalServerError), log.Error("error doing request", err, nil)
+		}
 	}
 
+	info.StatusCode = resp.StatusCode
+	info.Header = resp.Header
+	info.FinalURL = resp.Request.URL.String()
+
+	body := buf.Bytes()
+
 	if resp.StatusCode >= 400 {
-		return result, resp.StatusCode, catcher.Error("error response", nil, map[string]interface{}{
+		return result, info, log.Error("error response", nil, map[string]interface{}{
 			"response": string(body),
 			"status":   resp.StatusCode,
 		})
 	}
 
 	if resp.StatusCode == http.StatusNoContent {
-		return result, resp.StatusCode, nil
+		return result, info, nil
+	}
+
+	// A raw result receives a copy of the body, the buffer returns to the pool
+	if raw, ok := any(&result).(*rawResponse); ok {
+		*raw = bytes.Clone(body)
+		return result, info, nil
+	}
+
+	decode := ResponseDecoder(jsonDecoder)
+	if !opts.JSONOnly {
+		decode = responseDecoder(resp.Header.Get("Content-Type"))
+	}
+
+	err = decode(body, &result)
+	if err != nil && isUnexpectedEnd(err) {
+		return result, info, log.Error(ErrTruncatedResponse.Error(), &truncatedResponseError{
+			received:      len(body),
+			contentLength: resp.ContentLength,
+			cause:         err,
+		}, map[string]any{
+			"received":      len(body),
+			"contentLength": resp.ContentLength,
+			"contentType":   resp.Header.Get("Content-Type"),
+		})
 	}
 
-	err = json.Unmarshal(body, &result)
 	if err != nil {
-		return result, resp.StatusCode, catcher.Error("error parsing response", err, nil)
+		return result, info, log.Error("error parsing response", err, map[string]any{
+			"contentType": resp.Header.Get("Content-Type"),
+		})
 	}
 
-	return result, resp.StatusCode, nil
+	return result, info, nil
 }
 
-// Download downloads the content from the specified URL and saves it to the specified file.
-// It returns an error if any error occurs during the process.
-//
-// Parameters:
-//   - url: The URL from which to download the content.
-//   - file: The path to the file where the content should be saved.
-//
-// Returns:
-//   - error: An error object if an error occurs, otherwise nil.
-func Download(url, file string) error {
-	out, err := os.Create(file)
+// doAttempt sends a single request attempt bounded by the given timeout and reads the whole response body
+// into a buffer taken from the pool, which the caller must release with putBuffer. Reading the body is also
+// bounded by bodyTimeout, enforced by cancelling the attempt even if the transport does not time out.
+func doAttempt(ctx context.Context, client *http.Client, method, url string, payload requestBody, header http.Header, timeout, bodyTimeout time.Duration) (*http.Response, *bytes.Buffer, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ctx, cancelBody := context.WithCancelCause(ctx)
+	defer cancelBody(nil)
+
+	req, err := http.NewRequestWithContext(ctx, method, url, payload.open())
 	if err != nil {
-		return catcher.Error("error creating file", err, map[string]interface{}{"file": file})
+		return nil, nil, err
 	}
 
-	defer func() { _ = out.Close() }()
-
-	// Add secure HTTP client configuration
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				MinVersion: tls.VersionTLS12,
-			},
-		},
+	req.Header = header.Clone()
+	if req.Body != nil && req.Body != http.NoBody {
+		// A negative length sends the body with chunked transfer encoding
+		req.ContentLength = max(payload.length, -1)
 	}
 
-	resp, err := client.Get(url)
+	resp, err := client.Do(req)
 	if err != nil {
-		return catcher.Error("error downloading file", err, map[string]any{"url": url})
+		return nil, nil, err
 	}
 
-	defer func() { _ = resp.Body.Close() }()
+	// The network body is closed even though resp.Body is replaced by the buffered copy below
+	body := resp.Body
+	defer func() { _ = body.Close() }()
 
-	_, err = io.Copy(out, resp.Body)
+	timer := time.AfterFunc(bodyTimeout, func() { cancelBody(ErrBodyReadTimeout) })
+	defer timer.Stop()
+
+	buf := getBuffer()
+
+	_, err = buf.ReadFrom(body)
 	if err != nil {
-		return catcher.Error("error saving file", err, map[string]any{"file": file})
+		defer putBuffer(buf)
+
+		if errors.Is(context.Cause(ctx), ErrBodyReadTimeout) {
+			return nil, nil, fmt.Errorf("%w after %s, received %d bytes: %w", ErrBodyReadTimeout, bodyTimeout, buf.Len(), err)
+		}
+
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil, &truncatedResponseError{received: buf.Len(), contentLength: resp.ContentLength, cause: err}
+		}
+
+		return nil, nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	// The body stays readable from the buffer, e.g. for RequestOptions.RetryIf
+	resp.Body = io.NopCloser(bytes.NewReader(buf.Bytes()))
+
+	return resp, buf, nil
+}
+
+// sleepContext waits for the given duration and reports whether the context was still alive afterward.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// gzipBytes compresses the given data using gzip.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/threatwinds/go-sdk/catcher"
+	"go.opentelemetry.io/otel/trace"
+	"net"
+	"net/http"
+	"time"
+)
+
+// IdempotencyKeyHeader is the header carrying the idempotency key of a request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// DefaultAccept is the Accept header sent when neither the caller headers nor RequestOptions.Accept set one.
+const DefaultAccept = "application/json"
+
+// DefaultRequestTimeout is the timeout applied to each request attempt when no other value is configured.
+const DefaultRequestTimeout = 30 * time.Second
+
+// DefaultMaxRequestSize is the maximum size, in bytes, of the request body sent by DoReq when
+// RequestOptions.MaxRequestSize is zero.
+const DefaultMaxRequestSize = maxMessageSize
+
+// DefaultCompressThreshold is the minimum body size, in bytes, compressed when
+// RequestOptions.CompressRequest is enabled and no threshold is configured.
+const DefaultCompressThreshold = 1024
+
+// RequestOptions defines optional behaviour for DoReqWithOptions.
+// The zero value preserves the behaviour of DoReq.
+type RequestOptions struct {
+	// CompressRequest gzips the request body and sets the Content-Encoding header
+	// when the body is larger than CompressThreshold.
+	CompressRequest bool
+	// CompressThreshold is the minimum body size, in bytes, to compress.
+	// When zero, DefaultCompressThreshold is used.
+	CompressThreshold int
+	// Context is the parent context of the request. When nil, context.Background is used.
+	Context context.Context
+	// Retry enables retrying attempts that fail with a network error, a 429 or a 5xx status.
+	// MaxRetries bounds the total number of attempts and WaitTime is the pause between attempts. A zero
+	// MaxRetries makes unlimited attempts bounded by Timeout or the deadline of Context, and no retries when
+	// the call has neither. When nil, a single attempt is made.
+	Retry *catcher.RetryConfig
+	// RetryIf decides whether an attempt is retried, replacing the default of retrying network errors,
+	// 429 and 5xx statuses. It is called after each attempt with either the response, whose body can be
+	// read, or the error of the attempt. Retry still bounds the attempts and sets the wait between them.
+	// Requests blocked by URLPolicy are never retried and not passed to RetryIf.
+	RetryIf func(resp *http.Response, err error) bool
+	// PerAttemptTimeout bounds each attempt, including reading the response body.
+	// When zero, DefaultRequestTimeout is used.
+	PerAttemptTimeout time.Duration
+	// Timeout bounds the whole call across all attempts and waits between them.
+	// When zero, only PerAttemptTimeout applies.
+	Timeout time.Duration
+	// BodyReadTimeout bounds reading the response body of each attempt, from the moment the response
+	// headers are received, so a server stalling mid-body cannot hold the call for the whole
+	// PerAttemptTimeout. When zero or negative, the body can be read for as long as the attempt lasts,
+	// bounded by PerAttemptTimeout like the rest of the attempt.
+	BodyReadTimeout time.Duration
+	// TLS customizes the TLS settings of the connection. When nil, TLS 1.2 or newer is required
+	// and server certificates are verified.
+	TLS *TLSOptions
+	// IdempotencyKey is sent in the Idempotency-Key header of every attempt, so servers supporting
+	// idempotency keys can deduplicate retried requests. Use NewIdempotencyKey to generate one per
+	// logical request. A key already present in the request headers takes precedence.
+	IdempotencyKey string
+	// AutoIdempotencyKey generates a new idempotency key for the call when IdempotencyKey is empty.
+	// The same key is reused across all the retries of the call.
+	AutoIdempotencyKey bool
+	// Resolver overrides the DNS resolver used to resolve host names. When nil, the system resolver is used.
+	Resolver *net.Resolver
+	// HostOverrides maps host names to the IP addresses to dial instead of resolving them,
+	// e.g. to target mock servers or a specific interface. TLS verification still uses the original host name.
+	HostOverrides map[string]string
+	// JSONOnly decodes every response as JSON, ignoring its Content-Type.
+	JSONOnly bool
+	// MaxRequestSize is the maximum size, in bytes, of the request body, DefaultMaxRequestSize if zero.
+	// A negative value disables the limit. Larger bodies are rejected with 413 before sending the request.
+	MaxRequestSize int64
+	// Accept is the Accept header sent when the caller headers do not set one, DefaultAccept if empty.
+	// The response is decoded according to the Content-Type the server answers with, so the media types
+	// listed here should have a decoder registered with RegisterResponseDecoder, otherwise JSON is used.
+	Accept string
+	// URLPolicy restricts the schemes, hosts and IPs the request and its redirects can reach.
+	// When nil, any destination is allowed.
+	URLPolicy *URLPolicy
+	// Middleware is the chain of functions executed around every HTTP request sent, including each
+	// retry attempt and redirect. The first function is the outermost one.
+	Middleware []RoundTripFunc
+	// Tracer wraps every HTTP request sent, including each retry attempt and redirect, in an OpenTelemetry
+	// client span, outside of Middleware. When nil, the tracer set with SetRequestTracer is used, if any.
+	Tracer trace.Tracer
+}
+
+// TLSOptions defines the TLS settings used by DoReqWithOptions.
+type TLSOptions struct {
+	// MinVersion is the minimum accepted TLS version (e.g. tls.VersionTLS13). Defaults to tls.VersionTLS12.
+	MinVersion uint16
+	// MaxVersion is the maximum accepted TLS version. Defaults to the newest version supported.
+	MaxVersion uint16
+	// InsecureSkipVerify disables the verification of the server certificate chain and host name.
+	// It should only be used against test servers, a warning is logged every time it is applied.
+	InsecureSkipVerify bool
+	// ServerName overrides the host name used to verify the server certificate and for SNI.
+	ServerName string
+}
+
+// compressThreshold returns the configured compression threshold or the default one.
+func (o *RequestOptions) compressThreshold() int {
+	if o.CompressThreshold > 0 {
+		return o.CompressThreshold
+	}
+	return DefaultCompressThreshold
+}
+
+// maxRequestSize returns the maximum size of the request body, or a negative value if unlimited.
+func (o *RequestOptions) maxRequestSize() int64 {
+	if o.MaxRequestSize == 0 {
+		return DefaultMaxRequestSize
+	}
+	return o.MaxRequestSize
+}
+
+// context returns the configured parent context or context.Background.
+func (o *RequestOptions) context() context.Context {
+	if o.Context != nil {
+		return o.Context
+	}
+	return context.Background()
+}
+
+// perAttemptTimeout returns the configured per-attempt timeout or the default one.
+func (o *RequestOptions) perAttemptTimeout() time.Duration {
+	if o.PerAttemptTimeout > 0 {
+		return o.PerAttemptTimeout
+	}
+	return DefaultRequestTimeout
+}
+
+// bodyReadTimeout returns the configured body read timeout or the per-attempt timeout, so callers raising
+// PerAttemptTimeout to read large bodies are not cut short by a lower default.
+func (o *RequestOptions) bodyReadTimeout() time.Duration {
+	if o.BodyReadTimeout > 0 {
+		return o.BodyReadTimeout
+	}
+	return o.perAttemptTimeout()
+}
+
+// canRetry reports whether another attempt is allowed after the given number of attempts of a call bounded
+// by ctx, see retryAllowed.
+func (o *RequestOptions) canRetry(ctx context.Context, attempts int) bool {
+	return retryAllowed(ctx, o.Retry, attempts)
+}
+
+// retryAllowed reports whether another attempt is allowed after the given number of attempts. A MaxRetries
+// of zero or less only allows unlimited attempts when ctx has a deadline, otherwise a failing server would
+// keep the call retrying forever, so no retries are made.
+func retryAllowed(ctx context.Context, retry *catcher.RetryConfig, attempts int) bool {
+	if retry == nil {
+		return false
+	}
+
+	if retry.MaxRetries <= 0 {
+		_, hasDeadline := ctx.Deadline()
+		return hasDeadline
+	}
+
+	return attempts < retry.MaxRetries
+}
+
+// shouldRetry reports whether the outcome of an attempt is considered transient, as decided by RetryIf if set.
+// Requests blocked by the URLPolicy are never retried.
+func (o *RequestOptions) shouldRetry(resp *http.Response, err error) bool {
+	if errors.Is(err, ErrURLNotAllowed) {
+		return false
+	}
+
+	if o.RetryIf != nil {
+		return o.RetryIf(resp, err)
+	}
+
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// tlsConfig builds the TLS configuration of the request client.
+func (o *RequestOptions) tlsConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if o.TLS == nil {
+		return config
+	}
+
+	if o.TLS.MinVersion != 0 {
+		config.MinVersion = o.TLS.MinVersion
+	}
+
+	config.MaxVersion = o.TLS.MaxVersion
+	config.ServerName = o.TLS.ServerName
+
+	if o.TLS.InsecureSkipVerify {
+		catcher.Info("TLS certificate verification is disabled", map[string]any{
+			"advice": "do not use InsecureSkipVerify outside of test environments",
+			"status": 400,
+		})
+		config.InsecureSkipVerify = true
+	}
+
+	return config
+}
+
+// dialContext returns the dial function of the request client, applying the host overrides and the resolver.
+func (o *RequestOptions) dialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   DefaultRequestTimeout,
+		KeepAlive: 30 * time.Second,
+		Resolver:  o.Resolver,
+	}
+
+	if o.URLPolicy != nil {
+		dialer.Control = o.URLPolicy.control
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, port, err := net.SplitHostPort(addr); err == nil {
+			if ip, ok := o.HostOverrides[host]; ok {
+				addr = net.JoinHostPort(ip, port)
+			}
+		}
+
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// transport builds the HTTP transport of the request client, wrapped by the configured middleware and,
+// when a tracer is configured, by the tracing middleware.
+func (o *RequestOptions) transport() http.RoundTripper {
+	var base http.RoundTripper = &http.Transport{
+		DialContext:        o.dialContext(),
+		TLSClientConfig:    o.tlsConfig(),
+		DisableCompression: true,
+	}
+
+	if o.URLPolicy != nil {
+		base = &policyTransport{base: base, policy: o.URLPolicy}
+	}
+
+	middleware := o.Middleware
+	if tracer := o.tracer(); tracer != nil {
+		middleware = append([]RoundTripFunc{TracingMiddleware(tracer)}, middleware...)
+	}
+
+	return chainMiddleware(base, middleware)
+}
+
+// header builds the header of the request from the given headers and the options.
+func (o *RequestOptions) header(headers map[string]string) http.Header {
+	header := make(http.Header)
+	for k, v := range headers {
+		header.Add(k, v)
+	}
+
+	if header.Get("Accept") == "" {
+		header.Set("Accept", o.accept())
+	}
+
+	if key := o.idempotencyKey(); key != "" && header.Get(IdempotencyKeyHeader) == "" {
+		header.Set(IdempotencyKeyHeader, key)
+	}
+
+	return header
+}
+
+// accept returns the default Accept header of the call.
+func (o *RequestOptions) accept() string {
+	if o.Accept == "" {
+		return DefaultAccept
+	}
+	return o.Accept
+}
+
+// NewIdempotencyKey generates a random key suitable for the Idempotency-Key header.
+func NewIdempotencyKey() string {
+	return uuid.NewString()
+}
+
+// idempotencyKey returns the idempotency key of the call, generating one if requested.
+func (o *RequestOptions) idempotencyKey() string {
+	if o.IdempotencyKey == "" && o.AutoIdempotencyKey {
+		return NewIdempotencyKey()
+	}
+	return o.IdempotencyKey
+}
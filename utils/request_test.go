@@ -0,0 +1,985 @@
+package utils
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threatwinds/go-sdk/catcher"
+	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestDoReqWithOptionsCompression(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = zr
+		}
+
+		raw, err := io.ReadAll(body)
+		require.NoError(t, err)
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"encoding": r.Header.Get("Content-Encoding"),
+			"length":   r.ContentLength,
+			"size":     len(raw),
+		})
+	}))
+	defer server.Close()
+
+	large := []byte(`{"payload":"` + strings.Repeat("a", 4096) + `"}`)
+	small := []byte(`{"payload":"a"}`)
+
+	type echo struct {
+		Encoding string `json:"encoding"`
+		Length   int    `json:"length"`
+		Size     int    `json:"size"`
+	}
+
+	opts := &RequestOptions{CompressRequest: true}
+
+	got, status, err := DoReqWithOptions[echo](server.URL, large, http.MethodPost, nil, opts)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "gzip", got.Encoding)
+	assert.Equal(t, len(large), got.Size)
+	assert.Less(t, got.Length, len(large))
+
+	got, _, err = DoReqWithOptions[echo](server.URL, small, http.MethodPost, nil, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "", got.Encoding)
+	assert.Equal(t, len(small), got.Length)
+}
+
+func TestDoReqWithOptionsRetry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	opts := &RequestOptions{Retry: &catcher.RetryConfig{MaxRetries: 3, WaitTime: time.Millisecond}}
+
+	got, status, err := DoReqWithOptions[map[string]bool](server.URL, nil, http.MethodGet, nil, opts)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, got["ok"])
+	assert.Equal(t, int32(3), calls.Load())
+
+	calls.Store(0)
+	opts.Retry.MaxRetries = 2
+
+	_, status, err = DoReqWithOptions[map[string]bool](server.URL, nil, http.MethodGet, nil, opts)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Unlimited attempts require an overall deadline, without it a single attempt is made
+	calls.Store(0)
+	opts.Retry.MaxRetries = 0
+
+	_, status, err = DoReqWithOptions[map[string]bool](server.URL, nil, http.MethodGet, nil, opts)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, int32(1), calls.Load())
+
+	calls.Store(0)
+	opts.Timeout = time.Second
+
+	_, status, err = DoReqWithOptions[map[string]bool](server.URL, nil, http.MethodGet, nil, opts)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestDoReqWithOptionsRetryIf(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			_, _ = w.Write([]byte(`{"ok":false,"code":"BUSY"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	var outcomes []string
+	opts := &RequestOptions{
+		Retry: &catcher.RetryConfig{MaxRetries: 5, WaitTime: time.Millisecond},
+		RetryIf: func(resp *http.Response, err error) bool {
+			if err != nil {
+				return false
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			outcomes = append(outcomes, gjson.GetBytes(body, "code").String())
+
+			return gjson.GetBytes(body, "code").String() == "BUSY"
+		},
+	}
+
+	got, status, err := DoReqWithOptions[map[string]any](server.URL, nil, http.MethodGet, nil, opts)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, true, got["ok"])
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, []string{"BUSY", "BUSY", ""}, outcomes)
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	calls.Store(0)
+	opts.RetryIf = func(*http.Response, error) bool { return false }
+
+	_, status, err = DoReqWithOptions[map[string]any](unavailable.URL, nil, http.MethodGet, nil, opts)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestDoReqErrorContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	target := strings.Replace(server.URL, "http://", "http://user:secret@", 1) + "/path"
+
+	_, status, err := DoReqWithOptions[map[string]any](target, nil, http.MethodPost, nil, &RequestOptions{
+		Retry: &catcher.RetryConfig{MaxRetries: 2, WaitTime: time.Millisecond},
+	})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	args := catcher.ToSdkError(err).Args
+	assert.Equal(t, http.MethodPost, args["method"])
+	assert.Equal(t, strings.Replace(target, "secret", "xxxxx", 1), args["url"])
+	assert.Equal(t, http.StatusServiceUnavailable, args["status"])
+	assert.Equal(t, 2, args["attempts"])
+
+	_, _, err = DoReqStreamWithOptions[map[string]any](target, strings.NewReader("{}"), 2, http.MethodPut, nil, nil)
+	require.Error(t, err)
+
+	args = catcher.ToSdkError(err).Args
+	assert.Equal(t, http.MethodPut, args["method"])
+	assert.Equal(t, 1, args["attempts"])
+}
+
+func TestDoReqWithOptionsTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	_, _, err := DoReqWithOptions[map[string]any](server.URL, nil, http.MethodGet, nil, &RequestOptions{
+		PerAttemptTimeout: 20 * time.Millisecond,
+	})
+	require.Error(t, err)
+	assert.Equal(t, "request attempt timed out", catcher.ToSdkError(err).Msg)
+
+	_, _, err = DoReqWithOptions[map[string]any](server.URL, nil, http.MethodGet, nil, &RequestOptions{
+		Retry:             &catcher.RetryConfig{WaitTime: time.Millisecond},
+		PerAttemptTimeout: 20 * time.Millisecond,
+		Timeout:           100 * time.Millisecond,
+	})
+	require.Error(t, err)
+	assert.Equal(t, "request timeout exceeded", catcher.ToSdkError(err).Msg)
+}
+
+func TestDoReqWithOptionsTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	_, _, err := DoReq[map[string]bool](server.URL, nil, http.MethodGet, nil)
+	assert.Error(t, err)
+
+	got, _, err := DoReqWithOptions[map[string]bool](server.URL, nil, http.MethodGet, nil, &RequestOptions{
+		TLS: &TLSOptions{InsecureSkipVerify: true},
+	})
+	require.NoError(t, err)
+	assert.True(t, got["ok"])
+
+	_, _, err = DoReqWithOptions[map[string]bool](server.URL, nil, http.MethodGet, nil, &RequestOptions{
+		TLS: &TLSOptions{InsecureSkipVerify: true, MinVersion: tls.VersionTLS13},
+	})
+	assert.Error(t, err)
+}
+
+func TestDoReqWithOptionsIdempotencyKey(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+		if len(keys)%2 == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	opts := &RequestOptions{
+		AutoIdempotencyKey: true,
+		Retry:              &catcher.RetryConfig{MaxRetries: 2, WaitTime: time.Millisecond},
+	}
+
+	_, _, err := DoReqWithOptions[map[string]any](server.URL, []byte(`{}`), http.MethodPost, nil, opts)
+	require.NoError(t, err)
+	_, _, err = DoReqWithOptions[map[string]any](server.URL, []byte(`{}`), http.MethodPost, nil, opts)
+	require.NoError(t, err)
+
+	require.Len(t, keys, 4)
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	assert.Equal(t, keys[2], keys[3])
+	assert.NotEqual(t, keys[0], keys[2])
+
+	keys = nil
+	_, _, err = DoReqWithOptions[map[string]any](server.URL, nil, http.MethodPost,
+		map[string]string{IdempotencyKeyHeader: "caller"}, &RequestOptions{IdempotencyKey: "option"})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"caller"}, keys)
+}
+
+func TestDoReqWithOptionsHostOverrides(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"host":"` + r.Host + `"}`))
+	}))
+	defer server.Close()
+
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+
+	url := "http://api.example.invalid:" + port
+
+	_, _, err = DoReq[map[string]string](url, nil, http.MethodGet, nil)
+	assert.Error(t, err)
+
+	got, _, err := DoReqWithOptions[map[string]string](url, nil, http.MethodGet, nil, &RequestOptions{
+		HostOverrides: map[string]string{"api.example.invalid": "127.0.0.1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "api.example.invalid:"+port, got["host"])
+}
+
+func TestDoReqContentTypeDecoding(t *testing.T) {
+	bodies := map[string]string{
+		"/json":    `{"name":"json"}`,
+		"/problem": `{"name":"problem"}`,
+		"/xml":     `<item><name>xml</name></item>`,
+		"/yaml":    "name: yaml\n",
+		"/unknown": `{"name":"fallback"}`,
+		"/custom":  `name=custom`,
+	}
+	types := map[string]string{
+		"/json":    "application/json; charset=utf-8",
+		"/problem": "application/problem+json",
+		"/xml":     "application/xml",
+		"/yaml":    "application/yaml",
+		"/unknown": "text/plain",
+		"/custom":  "application/x-custom",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", types[r.URL.Path])
+		_, _ = w.Write([]byte(bodies[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	type item struct {
+		Name string `json:"name" xml:"name"`
+	}
+
+	RegisterResponseDecoder("application/x-custom", func(data []byte, v any) error {
+		v.(*item).Name = strings.TrimPrefix(string(data), "name=")
+		return nil
+	})
+	t.Cleanup(func() {
+		responseDecodersMutex.Lock()
+		delete(responseDecoders, "application/x-custom")
+		responseDecodersMutex.Unlock()
+	})
+
+	for path, want := range map[string]string{
+		"/json": "json", "/problem": "problem", "/xml": "xml", "/yaml": "yaml", "/unknown": "fallback", "/custom": "custom",
+	} {
+		got, _, err := DoReq[item](server.URL+path, nil, http.MethodGet, nil)
+		require.NoError(t, err, path)
+		assert.Equal(t, want, got.Name, path)
+	}
+
+	_, _, err := DoReqWithOptions[item](server.URL+"/xml", nil, http.MethodGet, nil, &RequestOptions{JSONOnly: true})
+	assert.Error(t, err)
+}
+
+func TestDoReqFullFinalURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "/middle", http.StatusFound)
+		case "/middle":
+			http.Redirect(w, r, "/end?x=1", http.StatusMovedPermanently)
+		default:
+			w.Header().Set("X-Landed", "yes")
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer server.Close()
+
+	result, info, err := DoReqFull[map[string]bool](server.URL+"/start", nil, http.MethodGet, nil, nil)
+	require.NoError(t, err)
+	assert.True(t, result["ok"])
+	assert.Equal(t, http.StatusOK, info.StatusCode)
+	assert.Equal(t, server.URL+"/end?x=1", info.FinalURL)
+	assert.Equal(t, "yes", info.Header.Get("X-Landed"))
+
+	_, info, err = DoReqFull[map[string]bool]("http://127.0.0.1:1/unreachable", nil, http.MethodGet, nil, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusInternalServerError, info.StatusCode)
+	assert.Empty(t, info.FinalURL)
+}
+
+func TestDoReqWithOptionsMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"auth": r.Header.Get("Authorization")})
+	}))
+	defer server.Close()
+
+	var order []string
+	var statuses []int
+
+	opts := &RequestOptions{
+		Middleware: []RoundTripFunc{
+			func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+				order = append(order, "outer")
+				resp, err := next(req)
+				if err == nil {
+					statuses = append(statuses, resp.StatusCode)
+				}
+				return resp, err
+			},
+			func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+				order = append(order, "inner")
+				req.Header.Set("Authorization", "Bearer fresh")
+				return next(req)
+			},
+		},
+	}
+
+	result, status, err := DoReqWithOptions[map[string]string](server.URL, nil, http.MethodGet, nil, opts)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Bearer fresh", result["auth"])
+	assert.Equal(t, []string{"outer", "inner"}, order)
+	assert.Equal(t, []int{http.StatusOK}, statuses)
+
+	shortCircuit := &RequestOptions{
+		Middleware: []RoundTripFunc{
+			func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": []string{"application/json"}},
+					Body:       io.NopCloser(strings.NewReader(`{"auth":"cached"}`)),
+					Request:    req,
+				}, nil
+			},
+		},
+	}
+
+	result, _, err = DoReqWithOptions[map[string]string](server.URL, nil, http.MethodGet, nil, shortCircuit)
+	require.NoError(t, err)
+	assert.Equal(t, "cached", result["auth"])
+}
+
+func TestDoReqWithOptionsLogsContextIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	ctx := catcher.WithRequestID(catcher.WithTraceID(context.Background(), "trace-1"), "req-1")
+
+	_, status, err := DoReqWithOptions[map[string]any](server.URL, nil, http.MethodGet, nil, &RequestOptions{Context: ctx})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadGateway, status)
+
+	sdkErr := catcher.ToSdkError(err)
+	require.NotNil(t, sdkErr)
+	assert.Equal(t, "trace-1", sdkErr.Args["traceId"])
+	assert.Equal(t, "req-1", sdkErr.Args["requestId"])
+}
+
+func TestDoReqStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"size":          len(body),
+			"contentLength": r.ContentLength,
+			"chunked":       slices.Contains(r.TransferEncoding, "chunked"),
+		})
+	}))
+	defer server.Close()
+
+	payload := strings.Repeat("x", 64*1024)
+
+	result, status, err := DoReqStream[map[string]any](server.URL, strings.NewReader(payload), int64(len(payload)), http.MethodPost, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(len(payload)), result["size"])
+	assert.Equal(t, float64(len(payload)), result["contentLength"])
+	assert.Equal(t, false, result["chunked"])
+
+	// Hide the concrete type so the length cannot be detected
+	reader := io.MultiReader(strings.NewReader(payload))
+
+	result, _, err = DoReqStream[map[string]any](server.URL, reader, -1, http.MethodPost, nil)
+	require.NoError(t, err)
+	assert.Equal(t, float64(len(payload)), result["size"])
+	assert.Equal(t, float64(-1), result["contentLength"])
+	assert.Equal(t, true, result["chunked"])
+}
+
+func TestDoReqStreamIsNotRetried(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	opts := &RequestOptions{Retry: &catcher.RetryConfig{MaxRetries: 3, WaitTime: time.Millisecond}}
+
+	_, status, err := DoReqStreamWithOptions[map[string]any](server.URL, strings.NewReader("data"), 4, http.MethodPost, nil, opts)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestDoReqWithOptionsURLPolicy(t *testing.T) {
+	var hits atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, strings.Replace(server.URL, "127.0.0.1", "internal.test", 1)+"/", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	overrides := map[string]string{"internal.test": "127.0.0.1", "public.test": "127.0.0.1"}
+
+	tests := []struct {
+		name    string
+		url     string
+		policy  *URLPolicy
+		blocked bool
+	}{
+		{"allowed", server.URL, &URLPolicy{AllowedSchemes: []string{"http"}, AllowedNetworks: []string{"127.0.0.0/8"}}, false},
+		{"scheme", server.URL, &URLPolicy{AllowedSchemes: []string{"https"}}, true},
+		{"private literal ip", server.URL, &URLPolicy{DenyPrivate: true}, true},
+		{"private resolved ip", strings.Replace(server.URL, "127.0.0.1", "public.test", 1), &URLPolicy{DenyPrivate: true}, true},
+		{"denied network", server.URL, &URLPolicy{DeniedNetworks: []string{"127.0.0.0/8"}}, true},
+		{"not allowed host", server.URL, &URLPolicy{AllowedHosts: []string{"*.example.com"}}, true},
+		{"denied redirect hop", server.URL + "/redirect", &URLPolicy{DeniedHosts: []string{"*.test"}}, true},
+		{"allowed redirect hop", server.URL + "/redirect", &URLPolicy{AllowedHosts: []string{"127.0.0.1", "internal.test"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &RequestOptions{URLPolicy: tt.policy, HostOverrides: overrides, Retry: &catcher.RetryConfig{MaxRetries: 3}}
+
+			result, status, err := DoReqWithOptions[map[string]bool](tt.url, nil, http.MethodGet, nil, opts)
+			if !tt.blocked {
+				require.NoError(t, err)
+				assert.True(t, result["ok"])
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, http.StatusForbidden, status)
+			assert.Equal(t, "request blocked by URL policy", catcher.ToSdkError(err).Msg)
+		})
+	}
+
+	hits.Store(0)
+	_, _, _ = DoReqWithOptions[map[string]bool](server.URL, nil, http.MethodGet, nil, &RequestOptions{URLPolicy: &URLPolicy{DenyPrivate: true}})
+	assert.Zero(t, hits.Load())
+
+	// A custom RetryIf cannot retry a blocked request
+	var retryIfCalls int
+	_, status, err := DoReqWithOptions[map[string]bool](server.URL, nil, http.MethodGet, nil, &RequestOptions{
+		URLPolicy: &URLPolicy{DenyPrivate: true},
+		Retry:     &catcher.RetryConfig{MaxRetries: 3, WaitTime: time.Millisecond},
+		RetryIf: func(*http.Response, error) bool {
+			retryIfCalls++
+			return true
+		},
+	})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, 1, catcher.ToSdkError(err).Args["attempts"])
+	assert.Zero(t, retryIfCalls)
+}
+
+func TestDoReqRawBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`not: [valid json`))
+	}))
+	defer server.Close()
+
+	body, info, err := DoRawReq(server.URL, nil, http.MethodGet, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, info.StatusCode)
+	assert.Equal(t, "not: [valid json", string(body))
+
+	// DoReq still decodes a []byte response, as a base64 JSON string
+	encoded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`"aGVsbG8="`))
+	}))
+	defer encoded.Close()
+
+	decoded, _, err := DoReq[[]byte](encoded.URL, nil, http.MethodGet, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(decoded))
+}
+
+// closeRecorder is a response body recording whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+// Close records that the body was closed.
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls the function.
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestDoAttemptClosesBody(t *testing.T) {
+	body := &closeRecorder{Reader: strings.NewReader(`{"ok":true}`)}
+	client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: body, Request: req}, nil
+	})}
+
+	resp, buf, err := doAttempt(context.Background(), client, http.MethodGet, "http://example.test", requestBody{
+		open: func() io.Reader { return nil },
+	}, http.Header{}, time.Second, time.Second)
+	require.NoError(t, err)
+	defer putBuffer(buf)
+
+	assert.True(t, body.closed)
+
+	// The buffered copy stays readable
+	got, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, string(got))
+}
+
+func TestDoReqPooledBuffersAreNotShared(t *testing.T) {
+	var counter atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"n":%d}`, counter.Add(1))
+	}))
+	defer server.Close()
+
+	first, _, err := DoRawReq(server.URL, nil, http.MethodGet, nil, nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, _, err = DoReq[map[string]int](server.URL, nil, http.MethodGet, nil)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, `{"n":1}`, string(first))
+}
+
+func BenchmarkDoReq(b *testing.B) {
+	payload := []byte(`{"data":"` + strings.Repeat("x", 64<<10) + `"}`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(payload)
+	}))
+	defer server.Close()
+
+	// A shared client keeps the connection setup out of the measurements, and the body is not decoded, so
+	// they are dominated by the reading of the body into a pooled buffer or a new slice
+	client := &http.Client{Transport: (&RequestOptions{}).transport()}
+	get := requestBody{open: func() io.Reader { return nil }}
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			_, buf, err := doAttempt(context.Background(), client, http.MethodGet, server.URL, get, http.Header{}, time.Minute, time.Minute)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			putBuffer(buf)
+		}
+	})
+
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			_, err = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestDoReqAccept(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "application/yaml" {
+			w.Header().Set("Content-Type", "application/yaml")
+			_, _ = w.Write([]byte("accept: " + r.Header.Get("Accept")))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"accept":"` + r.Header.Get("Accept") + `"}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		opts    *RequestOptions
+		want    string
+	}{
+		{"default", nil, nil, DefaultAccept},
+		{"option", nil, &RequestOptions{Accept: "application/yaml"}, "application/yaml"},
+		{"caller header", map[string]string{"accept": "application/yaml"}, &RequestOptions{Accept: "text/plain"}, "application/yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _, err := DoReqWithOptions[map[string]string](server.URL, nil, http.MethodGet, tt.headers, tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, result["accept"])
+		})
+	}
+}
+
+func TestDoReqMap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/invalid":
+			_, _ = w.Write([]byte(`{"id":`))
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			_, _ = w.Write([]byte(`{"id":9007199254740993,"z":1,"a":2,"items":[{"name":"first"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	result, status, err := DoReqMap(server.URL, nil, http.MethodGet, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "9007199254740993", result.Get("id").Raw)
+	assert.Equal(t, "first", result.Get("items.0.name").String())
+
+	var keys []string
+	result.ForEach(func(key, _ gjson.Result) bool {
+		keys = append(keys, key.String())
+		return true
+	})
+	assert.Equal(t, []string{"id", "z", "a", "items"}, keys)
+
+	result, status, err = DoReqMap(server.URL+"/empty", nil, http.MethodGet, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.False(t, result.Exists())
+
+	_, _, err = DoReqMap(server.URL+"/invalid", nil, http.MethodGet, nil)
+	assert.Error(t, err)
+}
+
+func TestDoReqJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"contentType": r.Header.Get("Content-Type"),
+			"token":       r.Header.Get("X-Token"),
+			"body":        string(body),
+		})
+	}))
+	defer server.Close()
+
+	type request struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	headers := map[string]string{"X-Token": "secret"}
+
+	got, status, err := DoReqJSON[request, map[string]string](server.URL, request{Name: "a", Count: 2}, http.MethodPost, headers)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "application/json", got["contentType"])
+	assert.Equal(t, "secret", got["token"])
+	assert.JSONEq(t, `{"name":"a","count":2}`, got["body"])
+	assert.Equal(t, map[string]string{"X-Token": "secret"}, headers)
+
+	got, _, err = DoReqJSON[map[string]any, map[string]string](server.URL, map[string]any{"op": "add"}, http.MethodPatch,
+		map[string]string{"content-type": "application/merge-patch+json"})
+	require.NoError(t, err)
+	assert.Equal(t, "application/merge-patch+json", got["contentType"])
+
+	target := strings.Replace(server.URL, "http://", "http://user:secret@", 1)
+
+	_, status, err = DoReqJSON[chan int, map[string]string](target, make(chan int), http.MethodPost, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusInternalServerError, status)
+
+	args := catcher.ToSdkError(err).Args
+	assert.Equal(t, http.MethodPost, args["method"])
+	assert.Equal(t, strings.Replace(target, "secret", "xxxxx", 1), args["url"])
+}
+
+func TestDoReqMaxRequestSize(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	body := make([]byte, 2048)
+
+	_, status, err := DoReqWithOptions[map[string]any](server.URL, body, http.MethodPost, nil, &RequestOptions{MaxRequestSize: 1024})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Contains(t, *catcher.ToSdkError(err).Cause, "2048 bytes")
+	assert.Contains(t, *catcher.ToSdkError(err).Cause, "1024 bytes")
+	assert.Zero(t, received.Load())
+
+	_, status, err = DoReqWithOptions[map[string]any](server.URL, body, http.MethodPost, nil, &RequestOptions{MaxRequestSize: 2048})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	large := make([]byte, DefaultMaxRequestSize+1)
+
+	_, status, err = DoReq[map[string]any](server.URL, large, http.MethodPost, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+
+	_, status, err = DoReqWithOptions[map[string]any](server.URL, large, http.MethodPost, nil, &RequestOptions{MaxRequestSize: -1})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int32(2), received.Load())
+}
+
+func TestDoReqWithOptionsTracing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"traceparent": r.Header.Get("traceparent")})
+	}))
+	defer server.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := provider.Tracer("test")
+
+	t.Run("disabled by default", func(t *testing.T) {
+		result, _, err := DoReqWithOptions[map[string]string](server.URL, nil, http.MethodGet, nil, nil)
+		require.NoError(t, err)
+		assert.Empty(t, result["traceparent"])
+		assert.Empty(t, recorder.Ended())
+	})
+
+	t.Run("options tracer", func(t *testing.T) {
+		ctx, parent := tracer.Start(context.Background(), "parent")
+		defer parent.End()
+
+		var inner []string
+		opts := &RequestOptions{
+			Context: ctx,
+			Tracer:  tracer,
+			Middleware: []RoundTripFunc{
+				func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+					inner = append(inner, req.Header.Get("traceparent"))
+					return next(req)
+				},
+			},
+		}
+
+		result, _, err := DoReqWithOptions[map[string]string](server.URL+"/ok", nil, http.MethodGet, nil, opts)
+		require.NoError(t, err)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 1)
+
+		span := spans[0]
+		assert.Equal(t, "HTTP GET", span.Name())
+		assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+		assert.Equal(t, parent.SpanContext().TraceID(), span.SpanContext().TraceID())
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+		assert.Contains(t, span.Attributes(), attribute.String("http.request.method", http.MethodGet))
+		assert.Contains(t, span.Attributes(), attribute.String("url.full", server.URL+"/ok"))
+		assert.Contains(t, span.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+		assert.Equal(t, codes.Unset, span.Status().Code)
+
+		assert.Contains(t, result["traceparent"], span.SpanContext().SpanID().String())
+		assert.Equal(t, []string{result["traceparent"]}, inner)
+	})
+
+	t.Run("global tracer", func(t *testing.T) {
+		SetRequestTracer(tracer)
+		defer SetRequestTracer(nil)
+
+		before := len(recorder.Ended())
+
+		_, status, _ := DoReqWithOptions[map[string]string](server.URL+"/fail", nil, http.MethodPost, nil, nil)
+		assert.Equal(t, http.StatusBadGateway, status)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, before+1)
+
+		span := spans[before]
+		assert.Equal(t, "HTTP POST", span.Name())
+		assert.Contains(t, span.Attributes(), attribute.Int("http.response.status_code", http.StatusBadGateway))
+		assert.Contains(t, span.Attributes(), attribute.String("error.type", "502"))
+		assert.Equal(t, codes.Error, span.Status().Code)
+	})
+}
+
+func TestDoReqTruncatedResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		status   int
+		cause    string
+	}{
+		{
+			name:     "shorter than Content-Length",
+			response: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 100\r\n\r\n{\"items\":[1,2",
+			status:   http.StatusBadGateway,
+			cause:    "received 13 of 100 bytes",
+		},
+		{
+			name:     "closed without Content-Length",
+			response: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nConnection: close\r\n\r\n{\"items\":[1,2",
+			status:   http.StatusOK,
+			cause:    "received 13 bytes without Content-Length",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				require.NoError(t, err)
+				_, _ = conn.Write([]byte(tt.response))
+				_ = conn.Close()
+			}))
+			defer server.Close()
+
+			_, status, err := DoReq[map[string]any](server.URL, nil, http.MethodGet, nil)
+			require.Error(t, err)
+			assert.Equal(t, tt.status, status)
+			assert.True(t, IsTruncatedResponse(err))
+			assert.Contains(t, *catcher.ToSdkError(err).Cause, tt.cause)
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"items":`))
+		_, _ = w.Write([]byte(`oops}`))
+	}))
+	defer server.Close()
+
+	_, _, err := DoReq[map[string]any](server.URL, nil, http.MethodGet, nil)
+	require.Error(t, err)
+	assert.False(t, IsTruncatedResponse(err))
+}
+
+func TestDoReqWithOptionsBodyReadTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte(`{"items":[`))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	opts := &RequestOptions{PerAttemptTimeout: 10 * time.Second, BodyReadTimeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	_, status, err := DoReqWithOptions[map[string]any](server.URL, nil, http.MethodGet, nil, opts)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Equal(t, http.StatusGatewayTimeout, status)
+	assert.Equal(t, "response body read timed out", catcher.ToSdkError(err).Msg)
+	assert.Contains(t, *catcher.ToSdkError(err).Cause, "received 10 bytes")
+	assert.Equal(t, http.StatusGatewayTimeout, catcher.ToSdkError(err).Args["status"])
+
+	// Without BodyReadTimeout, the body can be read for as long as the attempt lasts
+	assert.Equal(t, DefaultRequestTimeout, (&RequestOptions{}).bodyReadTimeout())
+	assert.Equal(t, 10*time.Minute, (&RequestOptions{PerAttemptTimeout: 10 * time.Minute}).bodyReadTimeout())
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/threatwinds/go-sdk/catcher"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// SchemaViolation is a violation of a JSON Schema found by ValidateJSONSchema.
+type SchemaViolation struct {
+	// Path is the JSON pointer of the offending value in the document, e.g. "/plugins/geo/apiKey".
+	// The root of the document is "/".
+	Path string
+	// Message describes the violation.
+	Message string
+}
+
+// Error implements the error interface.
+func (v *SchemaViolation) Error() string {
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// ValidateJSONSchema validates a JSON document against a JSON Schema and returns every violation found,
+// each one as a *SchemaViolation carrying the path of the offending value. Drafts 4 to 2020-12 are
+// supported, the draft being selected by the $schema keyword of the schema.
+//
+// Parameters:
+//
+//	doc: The JSON document to validate.
+//	schema: The JSON Schema.
+//
+// Returns:
+//
+//	[]error: The violations found, or a single error if the document or the schema cannot be parsed.
+//	Nil when the document is valid.
+func ValidateJSONSchema(doc []byte, schema []byte) []error {
+	schemaDoc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schema))
+	if err != nil {
+		return []error{catcher.Error("error parsing JSON schema", err, nil)}
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("schema.json", schemaDoc); err != nil {
+		return []error{catcher.Error("invalid JSON schema", err, nil)}
+	}
+
+	compiled, err := compiler.Compile("schema.json")
+	if err != nil {
+		return []error{catcher.Error("invalid JSON schema", err, nil)}
+	}
+
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(doc))
+	if err != nil {
+		return []error{catcher.Error("error parsing JSON document", err, nil)}
+	}
+
+	err = compiled.Validate(instance)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []error{catcher.Error("error validating JSON document", err, nil)}
+	}
+
+	var violations []error
+	collectViolations(validationErr, message.NewPrinter(language.English), &violations)
+
+	return violations
+}
+
+// ValidateYAMLSchema behaves like ValidateJSONSchema but accepts a YAML document and a YAML or JSON schema,
+// converting both to JSON first.
+func ValidateYAMLSchema(doc []byte, schema []byte) []error {
+	jsonDoc, err := k8syaml.YAMLToJSON(doc)
+	if err != nil {
+		return []error{catcher.Error("error parsing YAML document", err, nil)}
+	}
+
+	jsonSchema, err := k8syaml.YAMLToJSON(schema)
+	if err != nil {
+		return []error{catcher.Error("error parsing YAML schema", err, nil)}
+	}
+
+	return ValidateJSONSchema(jsonDoc, jsonSchema)
+}
+
+// collectViolations appends the leaves of a validation error tree, which are the actual violations.
+func collectViolations(err *jsonschema.ValidationError, printer *message.Printer, violations *[]error) {
+	if len(err.Causes) == 0 {
+		*violations = append(*violations, &SchemaViolation{
+			Path:    "/" + strings.Join(err.InstanceLocation, "/"),
+			Message: err.ErrorKind.LocalizedString(printer),
+		})
+		return
+	}
+
+	for _, cause := range err.Causes {
+		collectViolations(cause, printer, violations)
+	}
+}
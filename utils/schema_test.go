@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["apiKey", "port"],
+	"properties": {
+		"apiKey": {"type": "string", "minLength": 8},
+		"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+		"hosts": {"type": "array", "items": {"type": "string"}}
+	}
+}`
+
+func TestValidateJSONSchema(t *testing.T) {
+	assert.Nil(t, ValidateJSONSchema([]byte(`{"apiKey":"0123456789","port":443}`), []byte(testSchema)))
+
+	errs := ValidateJSONSchema([]byte(`{"apiKey":"short","port":70000,"hosts":["a",1]}`), []byte(testSchema))
+	require.Len(t, errs, 3)
+
+	paths := make(map[string]string)
+	for _, err := range errs {
+		var violation *SchemaViolation
+		require.ErrorAs(t, err, &violation)
+		paths[violation.Path] = violation.Message
+	}
+
+	assert.Contains(t, paths, "/apiKey")
+	assert.Contains(t, paths, "/port")
+	assert.Contains(t, paths, "/hosts/1")
+
+	errs = ValidateJSONSchema([]byte(`{}`), []byte(testSchema))
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "/: ")
+
+	assert.Len(t, ValidateJSONSchema([]byte(`{`), []byte(testSchema)), 1)
+	assert.Len(t, ValidateJSONSchema([]byte(`{}`), []byte(`{"type": 5}`)), 1)
+}
+
+func TestValidateYAMLSchema(t *testing.T) {
+	schema := []byte(`
+type: object
+required: [port]
+properties:
+  port:
+    type: integer
+`)
+
+	assert.Nil(t, ValidateYAMLSchema([]byte("port: 8080\n"), schema))
+
+	errs := ValidateYAMLSchema([]byte("port: http\n"), schema)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "/port")
+
+	errs = ValidateYAMLSchema([]byte("port: 8080\n"), []byte(testSchema))
+	require.Len(t, errs, 1)
+}
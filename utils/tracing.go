@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerHolder wraps the tracer set with SetRequestTracer, as atomic.Pointer cannot hold an interface.
+type tracerHolder struct {
+	tracer trace.Tracer
+}
+
+var requestTracer atomic.Pointer[tracerHolder]
+
+// tracePropagator injects the W3C trace context of the client spans in the outgoing request headers.
+var tracePropagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// SetRequestTracer sets the OpenTelemetry tracer used to trace the requests whose RequestOptions do not set
+// one. Passing nil disables the instrumentation, which is the default.
+func SetRequestTracer(tracer trace.Tracer) {
+	if tracer == nil {
+		requestTracer.Store(nil)
+		return
+	}
+
+	requestTracer.Store(&tracerHolder{tracer: tracer})
+}
+
+// tracer returns the tracer of the call, falling back to the one set with SetRequestTracer, or nil.
+func (o *RequestOptions) tracer() trace.Tracer {
+	if o.Tracer != nil {
+		return o.Tracer
+	}
+
+	if holder := requestTracer.Load(); holder != nil {
+		return holder.tracer
+	}
+
+	return nil
+}
+
+// TracingMiddleware returns a middleware wrapping every HTTP request sent in an OpenTelemetry client span
+// with the standard HTTP attributes, and propagating the trace context in the W3C traceparent header.
+// The span is a child of the span in the request context, if any. Responses with a 4xx or 5xx status and
+// transport errors mark the span as failed.
+func TracingMiddleware(tracer trace.Tracer) RoundTripFunc {
+	return func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+		ctx, span := tracer.Start(req.Context(), "HTTP "+req.Method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(req.Method),
+				semconv.URLFull(req.URL.Redacted()),
+				semconv.ServerAddress(req.URL.Hostname()),
+			),
+		)
+		defer span.End()
+
+		req = req.Clone(ctx)
+		tracePropagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+		resp, err := next(req)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return resp, err
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		if resp.StatusCode >= 400 {
+			span.SetAttributes(attribute.String("error.type", strconv.Itoa(resp.StatusCode)))
+			span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+		}
+
+		return resp, nil
+	}
+}
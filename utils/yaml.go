@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"github.com/threatwinds/go-sdk/catcher"
+	"io"
+	"maps"
 	"os"
 
 	"gopkg.in/yaml.v3"
@@ -68,3 +72,133 @@ func ReadYaml[t any](f string, jsonMode bool) (*t, error) {
 
 	return value, nil
 }
+
+// MustReadYAML behaves like ReadYaml but panics if the file cannot be read or parsed.
+// It is intended for fail-fast loading of known-good configuration at startup (e.g. in init functions
+// or test fixtures), never for request paths.
+func MustReadYAML[t any](f string, jsonMode bool) *t {
+	value, err := ReadYaml[t](f, jsonMode)
+	if err != nil {
+		panic(fmt.Errorf("cannot read YAML file %q: %w", f, err))
+	}
+
+	return value
+}
+
+// ReadYAMLRaw reads a YAML file into a generic map, without requiring its concrete type.
+// It is useful for tooling that needs to introspect a file (e.g. listing the plugin names
+// of a pipeline file) before knowing or importing its schema.
+//
+// Parameters:
+//
+//	f: The file path to the YAML file.
+//
+// Returns:
+//
+//	map[string]any: The decoded document, empty if the file has no content.
+//	error: An error object if an error occurs, otherwise nil.
+func ReadYAMLRaw(f string) (map[string]any, error) {
+	value, err := ReadYaml[map[string]any](f, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if *value == nil {
+		return map[string]any{}, nil
+	}
+
+	return *value, nil
+}
+
+// StreamYAML decodes the YAML documents of a file one at a time, invoking fn for each of them.
+// Unlike ReadYaml, the file is never fully loaded in memory, which keeps memory usage bounded
+// for large multi-document files. Processing stops at the first decoding error or at the
+// first error returned by fn.
+//
+// Type Parameters:
+//
+//	t: The type into which each YAML document will be decoded.
+//
+// Parameters:
+//
+//	f: The file path to the YAML file.
+//	fn: The function invoked with each decoded document.
+//
+// Returns:
+//
+//	error: An error object including the document index if an error occurs, otherwise nil.
+func StreamYAML[t any](f string, fn func(*t) error) error {
+	file, err := os.Open(f)
+	if err != nil {
+		return catcher.Error("error opening file", err, map[string]any{"file": f})
+	}
+	defer func() { _ = file.Close() }()
+
+	return streamYAML(file, map[string]any{"file": f}, fn)
+}
+
+// streamYAML implements StreamYAML over a reader, args are added to the errors returned.
+func streamYAML[t any](r io.Reader, args map[string]any, fn func(*t) error) error {
+	decoder := yaml.NewDecoder(r)
+
+	for index := 0; ; index++ {
+		var value = new(t)
+
+		errArgs := map[string]any{"document": index}
+		maps.Copy(errArgs, args)
+
+		err := decoder.Decode(value)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return catcher.Error("error decoding file", err, errArgs)
+		}
+
+		err = fn(value)
+		if err != nil {
+			return catcher.Error("error processing document", err, errArgs)
+		}
+	}
+}
+
+// StreamPbYaml streams the YAML documents of a file one at a time, converting each of them to JSON
+// before invoking fn. It is the multi-document, bounded-memory counterpart of ReadPbYaml.
+// Empty documents are skipped.
+//
+// Parameters:
+//   - f: The file path of the YAML file to be read.
+//   - fn: The function invoked with the JSON bytes of each document.
+//
+// Returns:
+//   - error: An error object including the document index if an error occurs, otherwise nil.
+func StreamPbYaml(f string, fn func([]byte) error) error {
+	return StreamYAML(f, pbYamlDocument(fn))
+}
+
+// StreamPbYamlReader behaves like StreamPbYaml but reads the YAML documents from r,
+// e.g. the body of an HTTP response.
+func StreamPbYamlReader(r io.Reader, fn func([]byte) error) error {
+	return streamYAML(r, nil, pbYamlDocument(fn))
+}
+
+// pbYamlDocument returns the document handler converting each non-empty YAML document to JSON before invoking fn.
+func pbYamlDocument(fn func([]byte) error) func(*yaml.Node) error {
+	return func(doc *yaml.Node) error {
+		if len(doc.Content) == 0 {
+			return nil
+		}
+
+		content, err := yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+
+		bytes, err := k8syaml.YAMLToJSON(content)
+		if err != nil {
+			return err
+		}
+
+		return fn(bytes)
+	}
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamYAML(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "docs.yaml")
+	require.NoError(t, os.WriteFile(f, []byte("name: a\n---\nname: b\n---\nname: c\n"), 0644))
+
+	type doc struct {
+		Name string `yaml:"name"`
+	}
+
+	var names []string
+	err := StreamYAML(f, func(d *doc) error {
+		names = append(names, d.Name)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	var docs []string
+	err = StreamPbYaml(f, func(b []byte) error {
+		docs = append(docs, string(b))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"name":"a"}`, `{"name":"b"}`, `{"name":"c"}`}, docs)
+}
+
+func TestStreamYAMLReportsDocumentIndex(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "bad.yaml")
+	require.NoError(t, os.WriteFile(f, []byte("name: a\n---\nname: [b\n"), 0644))
+
+	err := StreamYAML(f, func(d *map[string]any) error { return nil })
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"document":1`)
+}
+
+func TestReadYAMLRaw(t *testing.T) {
+	dir := t.TempDir()
+
+	f := filepath.Join(dir, "pipeline.yaml")
+	require.NoError(t, os.WriteFile(f, []byte("plugins:\n  geolocation:\n    apiKey: x\n  inputs: {}\ndisabledRules: [1, 2]\n"), 0644))
+
+	raw, err := ReadYAMLRaw(f)
+	require.NoError(t, err)
+	assert.Contains(t, raw["plugins"], "geolocation")
+	assert.Contains(t, raw["plugins"], "inputs")
+	assert.Equal(t, []any{1, 2}, raw["disabledRules"])
+
+	empty := filepath.Join(dir, "empty.yaml")
+	require.NoError(t, os.WriteFile(empty, nil, 0644))
+
+	raw, err = ReadYAMLRaw(empty)
+	require.NoError(t, err)
+	assert.Empty(t, raw)
+
+	_, err = ReadYAMLRaw(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestMustReadYAMLAndJSON(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlFile := filepath.Join(dir, "cfg.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte("name: a\n"), 0644))
+
+	jsonFile := filepath.Join(dir, "cfg.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{"name":"b"}`), 0644))
+
+	type cfg struct {
+		Name string `json:"name" yaml:"name"`
+	}
+
+	assert.Equal(t, "a", MustReadYAML[cfg](yamlFile, false).Name)
+	assert.Equal(t, "a", MustReadYAML[cfg](yamlFile, true).Name)
+	assert.Equal(t, "b", MustReadJSON[cfg](jsonFile).Name)
+
+	assert.Panics(t, func() { MustReadYAML[cfg]("missing.yaml", false) })
+	assert.Panics(t, func() { MustReadJSON[cfg](yamlFile) })
+}